@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"pharmacy/config"
+	"pharmacy/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cliActor is recorded as the actor of changes made from the command line
+var cliActor = models.SystemActor("cli")
+
+// runCreateAdmin implements "create-admin -name N -phone P -password X"
+func runCreateAdmin(cfg *config.Config, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	name := fs.String("name", "", "admin name (required)")
+	phone := fs.String("phone", "", "phone number used to log in (required)")
+	password := fs.String("password", "", "password (required)")
+	email := fs.String("email", "", "email address")
+	firmName := fs.String("firm", "", "firm name")
+	fs.Parse(args)
+
+	if *name == "" || *phone == "" || *password == "" {
+		fs.Usage()
+		return errors.New("name, phone and password are required")
+	}
+
+	if err := checkSchema(cfg, db); err != nil {
+		return err
+	}
+	repos, _ := newServices(cfg, db)
+
+	if existing, _ := repos.Users.GetByPhone(*phone); existing != nil {
+		return fmt.Errorf("phone number %s is already in use by user %d", *phone, existing.ID)
+	}
+
+	user, err := repos.Users.CreateAdmin(*name, *email, *phone, *password, *firmName, cliActor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s (id %d)\n", user.Name, user.ID)
+	return nil
+}
+
+// runImportMedicines implements "import-medicines FILE"
+func runImportMedicines(cfg *config.Config, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("import-medicines", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: import-medicines FILE\n\nFILE is a CSV with the columns Name,Description,CompanyName and a header row.")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one CSV file is required")
+	}
+
+	if err := checkSchema(cfg, db); err != nil {
+		return err
+	}
+	repos, _ := newServices(cfg, db)
+
+	if err := repos.Medicines.ImportCSV(fs.Arg(0), cliActor); err != nil {
+		return err
+	}
+
+	fmt.Printf("imported medicines from %s\n", fs.Arg(0))
+	return nil
+}
+
+// runResetPassword implements "reset-password -phone P -password X"
+func runResetPassword(cfg *config.Config, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	phone := fs.String("phone", "", "phone number of the user (required)")
+	password := fs.String("password", "", "new password (required)")
+	fs.Parse(args)
+
+	if *phone == "" || *password == "" {
+		fs.Usage()
+		return errors.New("phone and password are required")
+	}
+
+	if err := checkSchema(cfg, db); err != nil {
+		return err
+	}
+	repos, auth := newServices(cfg, db)
+
+	user, err := repos.Users.GetByPhone(*phone)
+	if err != nil {
+		return fmt.Errorf("no user with phone number %s", *phone)
+	}
+
+	if err := auth.SetPassword(user.ID, *password, cliActor); err != nil {
+		return err
+	}
+
+	fmt.Printf("password reset for %s (id %d); all sessions were logged out\n", user.Name, user.ID)
+	return nil
+}
+
+// runExportOrders implements "export-orders [-out FILE] [-from DATE] [-to DATE] [-status S]"
+func runExportOrders(cfg *config.Config, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("export-orders", flag.ExitOnError)
+	out := fs.String("out", "", "output file (default stdout)")
+	from := fs.String("from", "", "only orders created on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only orders created before the end of this date (YYYY-MM-DD)")
+	status := fs.String("status", "", "only orders with this status")
+	fs.Parse(args)
+
+	var fromTime, toTime time.Time
+	var err error
+	if *from != "" {
+		if fromTime, err = time.Parse("2006-01-02", *from); err != nil {
+			return fmt.Errorf("invalid -from date: %w", err)
+		}
+	}
+	if *to != "" {
+		if toTime, err = time.Parse("2006-01-02", *to); err != nil {
+			return fmt.Errorf("invalid -to date: %w", err)
+		}
+		toTime = toTime.AddDate(0, 0, 1)
+	}
+
+	if err := checkSchema(cfg, db); err != nil {
+		return err
+	}
+	repos, _ := newServices(cfg, db)
+
+	orders, err := repos.Orders.List(0, true, false)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"order_id", "created_at", "status", "user_id", "customer_name", "firm_name", "phone", "medicine_id", "medicine_name", "company_id", "company_name", "quantity"})
+
+	rows := 0
+	for _, order := range orders {
+		if *status != "" && order.Status != *status {
+			continue
+		}
+		if !fromTime.IsZero() && order.CreatedAt.Before(fromTime) {
+			continue
+		}
+		if !toTime.IsZero() && !order.CreatedAt.Before(toTime) {
+			continue
+		}
+
+		var customer models.UserDetails
+		if order.UserDetails != nil {
+			customer = *order.UserDetails
+		}
+		for _, item := range order.Items {
+			writer.Write([]string{
+				strconv.Itoa(int(order.OrderID)),
+				order.CreatedAt.Format(time.RFC3339),
+				order.Status,
+				strconv.Itoa(int(order.UserID)),
+				customer.Name,
+				customer.FirmName,
+				customer.Phone,
+				strconv.Itoa(int(item.MedicineID)),
+				item.MedicineName,
+				strconv.Itoa(int(item.CompanyID)),
+				item.CompanyName,
+				strconv.Itoa(item.Quantity),
+			})
+			rows++
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	if *out != "" {
+		fmt.Printf("exported %d order lines to %s\n", rows, *out)
+	}
+	return nil
+}
+
+// seedCatalog is the sample data added by "seed"
+var seedCatalog = []struct {
+	company     string
+	description string
+	medicines   []string
+}{
+	{"Cipla", "Sample company", []string{"Paracetamol 500mg", "Azithromycin 250mg", "Cetirizine 10mg"}},
+	{"Sun Pharma", "Sample company", []string{"Pantoprazole 40mg", "Metformin 500mg"}},
+	{"Dr. Reddy's", "Sample company", []string{"Omeprazole 20mg", "Amlodipine 5mg"}},
+}
+
+// runSeed implements "seed", adding sample catalog data to an empty database
+func runSeed(cfg *config.Config, db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	fs.Parse(args)
+
+	if err := checkSchema(cfg, db); err != nil {
+		return err
+	}
+	repos, _ := newServices(cfg, db)
+
+	companies, err := repos.Companies.List(false)
+	if err != nil {
+		return err
+	}
+	if len(companies) > 0 {
+		fmt.Println("catalog already has companies, nothing to seed")
+		return nil
+	}
+
+	medicines := 0
+	for _, entry := range seedCatalog {
+		company, err := repos.Companies.Create(entry.company, entry.description, "", cliActor)
+		if err != nil {
+			return err
+		}
+		for _, name := range entry.medicines {
+			if _, err := repos.Medicines.Create(name, "", company.ID, 0, "", cliActor); err != nil {
+				return err
+			}
+			medicines++
+		}
+	}
+
+	fmt.Printf("seeded %d companies and %d medicines\n", len(seedCatalog), medicines)
+	return nil
+}
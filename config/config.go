@@ -0,0 +1,427 @@
+// Package config loads application settings from an optional YAML file and
+// environment variables. Environment variables take precedence over the file,
+// which takes precedence over the defaults.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds all application settings
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Upload   UploadConfig   `yaml:"upload"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+	Notify   NotifyConfig   `yaml:"notify"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port string `yaml:"port"`
+}
+
+// DatabaseConfig holds the database connection and pool settings
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver"`
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// JWTConfig holds token signing settings
+type JWTConfig struct {
+	Secret          string        `yaml:"secret"`
+	Issuer          string        `yaml:"issuer"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+// CORSConfig lists the origins allowed to call the API from a browser
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// UploadConfig limits file uploads such as the medicines CSV
+type UploadConfig struct {
+	MaxBytes int64  `yaml:"max_bytes"`
+	Dir      string `yaml:"dir"`
+}
+
+// StorageConfig selects where uploaded files such as order attachments are
+// kept: a local directory, or a bucket of an S3-compatible object store
+type StorageConfig struct {
+	Driver string   `yaml:"driver"`
+	Dir    string   `yaml:"dir"`
+	S3     S3Config `yaml:"s3"`
+}
+
+// S3Config holds the connection settings of an S3-compatible object store.
+// Buckets are addressed path-style, which MinIO and most other stores accept.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+// WebhookConfig controls how events are delivered to webhook endpoints.
+// Failed deliveries are retried after RetryBackoff, doubling each time, until
+// MaxAttempts attempts were made.
+type WebhookConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// NotifyConfig controls how notifications are sent to users and which
+// service delivers each channel. Failed notifications are retried after
+// RetryBackoff, doubling each time, until MaxAttempts attempts were made.
+type NotifyConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	LogFile      string        `yaml:"log_file"` // Where the log driver writes; the application log when empty
+	SMS          SMSConfig     `yaml:"sms"`
+	Email        EmailConfig   `yaml:"email"`
+	Push         PushConfig    `yaml:"push"`
+}
+
+// SMSConfig selects the SMS gateway. The http driver POSTs
+// {"to": ..., "message": ...} to URL with APIKey as bearer token.
+type SMSConfig struct {
+	Driver string `yaml:"driver"`
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+}
+
+// EmailConfig holds the SMTP server used to send email. Connections are
+// upgraded with STARTTLS when the server offers it.
+type EmailConfig struct {
+	Driver   string `yaml:"driver"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// PushConfig selects the push service. The fcm driver sends through
+// Firebase Cloud Messaging with a service account key file.
+type PushConfig struct {
+	Driver          string `yaml:"driver"`
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+// LogConfig holds logging settings
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+// Database drivers accepted by DatabaseConfig.Driver. SQLite is meant for
+// local development and tests.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Storage drivers accepted by StorageConfig.Driver
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Notification drivers. Every channel accepts NotifyLog, which writes the
+// messages to the log instead of sending them.
+const (
+	NotifyLog = "log"
+	SMSHTTP   = "http"
+	EmailSMTP = "smtp"
+	PushFCM   = "fcm"
+)
+
+// Log levels accepted by LogConfig.Level
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Default returns the settings used when nothing else is configured
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port: "8080",
+		},
+		Database: DatabaseConfig{
+			Driver:          DriverPostgres,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		JWT: JWTConfig{
+			Issuer:          "pharmacy",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Upload: UploadConfig{
+			MaxBytes: 10 << 20,
+			Dir:      os.TempDir(),
+		},
+		Storage: StorageConfig{
+			Driver: StorageLocal,
+			Dir:    "attachments",
+			S3: S3Config{
+				Region: "us-east-1",
+			},
+		},
+		Webhook: WebhookConfig{
+			PollInterval: 5 * time.Second,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			RetryBackoff: 30 * time.Second,
+		},
+		Notify: NotifyConfig{
+			PollInterval: 5 * time.Second,
+			MaxAttempts:  5,
+			RetryBackoff: time.Minute,
+			SMS:          SMSConfig{Driver: NotifyLog},
+			Email:        EmailConfig{Driver: NotifyLog, Port: 587},
+			Push:         PushConfig{Driver: NotifyLog},
+		},
+		Log: LogConfig{
+			Level: LogLevelInfo,
+		},
+	}
+}
+
+// Load reads the config file at path (skipped when path is empty), applies
+// environment overrides and validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("could not parse config file: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Address returns the listen address for the HTTP server
+func (c *Config) Address() string {
+	return ":" + c.Server.Port
+}
+
+// Validate checks that required settings are present and values are sane
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Database.Driver != DriverPostgres && c.Database.Driver != DriverSQLite {
+		problems = append(problems, fmt.Sprintf("invalid database driver %q", c.Database.Driver))
+	}
+	if c.Database.DSN == "" {
+		problems = append(problems, "database DSN is required (PHARMACY_DB_DSN)")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		problems = append(problems, "database pool sizes must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database max idle connections must not exceed max open connections")
+	}
+	if c.JWT.Secret == "" {
+		problems = append(problems, "JWT secret is required (PHARMACY_JWT_SECRET)")
+	}
+	if c.JWT.AccessTokenTTL <= 0 || c.JWT.RefreshTokenTTL <= 0 {
+		problems = append(problems, "JWT token lifetimes must be positive")
+	}
+	if c.JWT.AccessTokenTTL > c.JWT.RefreshTokenTTL {
+		problems = append(problems, "JWT access token lifetime must not exceed the refresh token lifetime")
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("invalid server port %q", c.Server.Port))
+	}
+	if c.Upload.MaxBytes <= 0 {
+		problems = append(problems, "upload size limit must be positive")
+	}
+	if c.Upload.Dir == "" {
+		problems = append(problems, "upload directory is required")
+	}
+	switch c.Storage.Driver {
+	case StorageLocal:
+		if c.Storage.Dir == "" {
+			problems = append(problems, "storage directory is required (PHARMACY_STORAGE_DIR)")
+		}
+	case StorageS3:
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			problems = append(problems, "S3 endpoint and bucket are required (PHARMACY_S3_ENDPOINT, PHARMACY_S3_BUCKET)")
+		}
+		if c.Storage.S3.AccessKey == "" || c.Storage.S3.SecretKey == "" {
+			problems = append(problems, "S3 credentials are required (PHARMACY_S3_ACCESS_KEY, PHARMACY_S3_SECRET_KEY)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("invalid storage driver %q", c.Storage.Driver))
+	}
+	if c.Webhook.PollInterval <= 0 || c.Webhook.Timeout <= 0 || c.Webhook.RetryBackoff <= 0 {
+		problems = append(problems, "webhook poll interval, timeout and retry backoff must be positive")
+	}
+	if c.Webhook.MaxAttempts <= 0 {
+		problems = append(problems, "webhook max attempts must be positive")
+	}
+	if c.Notify.PollInterval <= 0 || c.Notify.RetryBackoff <= 0 {
+		problems = append(problems, "notification poll interval and retry backoff must be positive")
+	}
+	if c.Notify.MaxAttempts <= 0 {
+		problems = append(problems, "notification max attempts must be positive")
+	}
+	switch c.Notify.SMS.Driver {
+	case NotifyLog:
+	case SMSHTTP:
+		if c.Notify.SMS.URL == "" {
+			problems = append(problems, "SMS gateway URL is required (PHARMACY_SMS_URL)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("invalid SMS driver %q", c.Notify.SMS.Driver))
+	}
+	switch c.Notify.Email.Driver {
+	case NotifyLog:
+	case EmailSMTP:
+		if c.Notify.Email.Host == "" || c.Notify.Email.From == "" {
+			problems = append(problems, "SMTP host and sender are required (PHARMACY_SMTP_HOST, PHARMACY_EMAIL_FROM)")
+		}
+		if c.Notify.Email.Port <= 0 || c.Notify.Email.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("invalid SMTP port %d", c.Notify.Email.Port))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("invalid email driver %q", c.Notify.Email.Driver))
+	}
+	switch c.Notify.Push.Driver {
+	case NotifyLog:
+	case PushFCM:
+		if c.Notify.Push.CredentialsFile == "" {
+			problems = append(problems, "FCM credentials file is required (PHARMACY_FCM_CREDENTIALS_FILE)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("invalid push driver %q", c.Notify.Push.Driver))
+	}
+	switch c.Log.Level {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		problems = append(problems, fmt.Sprintf("invalid log level %q", c.Log.Level))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// applyEnv overrides settings from PHARMACY_* environment variables
+func (c *Config) applyEnv() error {
+	var err error
+	setString := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok && err == nil {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				err = fmt.Errorf("invalid %s: %w", key, err)
+			}
+		}
+	}
+	setInt64 := func(key string, dst *int64) {
+		if v, ok := os.LookupEnv(key); ok && err == nil {
+			if *dst, err = strconv.ParseInt(v, 10, 64); err != nil {
+				err = fmt.Errorf("invalid %s: %w", key, err)
+			}
+		}
+	}
+	setDuration := func(key string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(key); ok && err == nil {
+			if *dst, err = time.ParseDuration(v); err != nil {
+				err = fmt.Errorf("invalid %s: %w", key, err)
+			}
+		}
+	}
+
+	setString("PHARMACY_PORT", &c.Server.Port)
+	setString("PHARMACY_DB_DRIVER", &c.Database.Driver)
+	setString("PHARMACY_DB_DSN", &c.Database.DSN)
+	setInt("PHARMACY_DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	setInt("PHARMACY_DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	setDuration("PHARMACY_DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	setString("PHARMACY_JWT_SECRET", &c.JWT.Secret)
+	setString("PHARMACY_JWT_ISSUER", &c.JWT.Issuer)
+	setDuration("PHARMACY_JWT_ACCESS_TTL", &c.JWT.AccessTokenTTL)
+	setDuration("PHARMACY_JWT_REFRESH_TTL", &c.JWT.RefreshTokenTTL)
+	setInt64("PHARMACY_UPLOAD_MAX_BYTES", &c.Upload.MaxBytes)
+	setString("PHARMACY_UPLOAD_DIR", &c.Upload.Dir)
+	setString("PHARMACY_STORAGE_DRIVER", &c.Storage.Driver)
+	setString("PHARMACY_STORAGE_DIR", &c.Storage.Dir)
+	setString("PHARMACY_S3_ENDPOINT", &c.Storage.S3.Endpoint)
+	setString("PHARMACY_S3_REGION", &c.Storage.S3.Region)
+	setString("PHARMACY_S3_BUCKET", &c.Storage.S3.Bucket)
+	setString("PHARMACY_S3_ACCESS_KEY", &c.Storage.S3.AccessKey)
+	setString("PHARMACY_S3_SECRET_KEY", &c.Storage.S3.SecretKey)
+	setDuration("PHARMACY_WEBHOOK_POLL_INTERVAL", &c.Webhook.PollInterval)
+	setDuration("PHARMACY_WEBHOOK_TIMEOUT", &c.Webhook.Timeout)
+	setInt("PHARMACY_WEBHOOK_MAX_ATTEMPTS", &c.Webhook.MaxAttempts)
+	setDuration("PHARMACY_WEBHOOK_RETRY_BACKOFF", &c.Webhook.RetryBackoff)
+	setDuration("PHARMACY_NOTIFY_POLL_INTERVAL", &c.Notify.PollInterval)
+	setInt("PHARMACY_NOTIFY_MAX_ATTEMPTS", &c.Notify.MaxAttempts)
+	setDuration("PHARMACY_NOTIFY_RETRY_BACKOFF", &c.Notify.RetryBackoff)
+	setString("PHARMACY_NOTIFY_LOG_FILE", &c.Notify.LogFile)
+	setString("PHARMACY_SMS_DRIVER", &c.Notify.SMS.Driver)
+	setString("PHARMACY_SMS_URL", &c.Notify.SMS.URL)
+	setString("PHARMACY_SMS_API_KEY", &c.Notify.SMS.APIKey)
+	setString("PHARMACY_EMAIL_DRIVER", &c.Notify.Email.Driver)
+	setString("PHARMACY_SMTP_HOST", &c.Notify.Email.Host)
+	setInt("PHARMACY_SMTP_PORT", &c.Notify.Email.Port)
+	setString("PHARMACY_SMTP_USERNAME", &c.Notify.Email.Username)
+	setString("PHARMACY_SMTP_PASSWORD", &c.Notify.Email.Password)
+	setString("PHARMACY_EMAIL_FROM", &c.Notify.Email.From)
+	setString("PHARMACY_PUSH_DRIVER", &c.Notify.Push.Driver)
+	setString("PHARMACY_FCM_CREDENTIALS_FILE", &c.Notify.Push.CredentialsFile)
+	setString("PHARMACY_LOG_LEVEL", &c.Log.Level)
+
+	if v, ok := os.LookupEnv("PHARMACY_CORS_ORIGINS"); ok {
+		c.CORS.AllowedOrigins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, origin)
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file to a temporary directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: "9090"
+database:
+  driver: sqlite
+  dsn: file.db
+jwt:
+  secret: from-file
+  access_token_ttl: 5m
+webhook:
+  max_attempts: 3
+`)
+	t.Setenv("PHARMACY_JWT_SECRET", "from-env")
+	t.Setenv("PHARMACY_CORS_ORIGINS", "https://a.example, ,https://b.example")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Address() != ":9090" || cfg.Database.Driver != DriverSQLite || cfg.Database.DSN != "file.db" {
+		t.Fatalf("file settings not applied: %+v", cfg)
+	}
+	if cfg.JWT.Secret != "from-env" {
+		t.Fatalf("JWT secret = %q, want the environment to win", cfg.JWT.Secret)
+	}
+	if cfg.JWT.AccessTokenTTL != 5*time.Minute || cfg.JWT.RefreshTokenTTL != 30*24*time.Hour {
+		t.Fatalf("token lifetimes = %v and %v, want 5m and the default", cfg.JWT.AccessTokenTTL, cfg.JWT.RefreshTokenTTL)
+	}
+	if cfg.Webhook.MaxAttempts != 3 || cfg.Webhook.Timeout != 10*time.Second {
+		t.Fatalf("webhook settings = %+v", cfg.Webhook)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 {
+		t.Fatalf("CORS origins = %v, want two", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadRejectsBadEnv(t *testing.T) {
+	t.Setenv("PHARMACY_DB_DSN", "postgres://localhost/pharmacy")
+	t.Setenv("PHARMACY_JWT_SECRET", "secret")
+	t.Setenv("PHARMACY_WEBHOOK_TIMEOUT", "ten seconds")
+
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "PHARMACY_WEBHOOK_TIMEOUT") {
+		t.Fatalf("Load error = %v, want the bad variable named", err)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("Load succeeded without the config file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := Default()
+		cfg.Database.DSN = "postgres://localhost/pharmacy"
+		cfg.JWT.Secret = "secret"
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("defaults with a DSN and secret: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		change func(*Config)
+		want   string
+	}{
+		"no secret":        {func(c *Config) { c.JWT.Secret = "" }, "JWT secret is required"},
+		"long access":      {func(c *Config) { c.JWT.AccessTokenTTL = 2 * c.JWT.RefreshTokenTTL }, "must not exceed the refresh token lifetime"},
+		"idle over open":   {func(c *Config) { c.Database.MaxIdleConns = 100 }, "must not exceed max open connections"},
+		"bad port":         {func(c *Config) { c.Server.Port = "http" }, `invalid server port "http"`},
+		"s3 without creds": {func(c *Config) { c.Storage.Driver = StorageS3 }, "S3 endpoint and bucket are required"},
+		"sms without url":  {func(c *Config) { c.Notify.SMS.Driver = SMSHTTP }, "SMS gateway URL is required"},
+		"bad log level":    {func(c *Config) { c.Log.Level = "trace" }, `invalid log level "trace"`},
+	} {
+		cfg := valid()
+		tc.change(cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want %q", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Defaults and limits for the analytics reports
+const (
+	defaultSalesDays  = 30
+	maxSalesDays      = 3 * 366
+	maxSalesDayBucket = 366
+	defaultSalesLimit = 10
+	maxSalesLimit     = 100
+	defaultOfferDays  = 90
+	defaultOfferLimit = 20
+)
+
+// AnalyticsHandler serves sales reports to admins
+type AnalyticsHandler struct {
+	sales models.SalesRepo
+	auth  *models.AuthService
+}
+
+// NewAnalyticsHandler creates a new instance of the handler
+func NewAnalyticsHandler(sales models.SalesRepo, auth *models.AuthService) *AnalyticsHandler {
+	return &AnalyticsHandler{sales: sales, auth: auth}
+}
+
+// GetSalesReport aggregates order quantity and value by company, medicine,
+// customer firm or time bucket for a date range, compared with the previous
+// range of the same length
+func (h *AnalyticsHandler) GetSalesReport(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	query, err := salesQuery(c)
+	if err != nil {
+		return err
+	}
+
+	report, err := h.sales.Report(query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetOfferReport compares the ordered volume of medicines before, during and
+// after their offers, with the number of firms that ordered under each offer
+// and the free goods given away
+func (h *AnalyticsHandler) GetOfferReport(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	query := models.OfferQuery{Limit: defaultOfferLimit}
+
+	var err error
+	if query.CompanyID, err = idParam(c, "company_id"); err != nil {
+		return err
+	}
+	if query.MedicineID, err = idParam(c, "medicine_id"); err != nil {
+		return err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to, err := dateParam(c, "to", today)
+	if err != nil {
+		return err
+	}
+	from, err := dateParam(c, "from", to.AddDate(0, 0, 1-defaultOfferDays))
+	if err != nil {
+		return err
+	}
+	if from.After(to) {
+		return models.NewValidationError("from", "must not be after to")
+	}
+	query.From, query.To = from, to.AddDate(0, 0, 1)
+
+	if param := c.QueryParam("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxSalesLimit {
+			return models.NewValidationError("limit", "must be between 1 and "+strconv.Itoa(maxSalesLimit))
+		}
+		query.Limit = n
+	}
+
+	report, err := h.sales.OfferReport(query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// salesQuery reads the report parameters from the query string
+func salesQuery(c echo.Context) (models.SalesQuery, error) {
+	query := models.SalesQuery{
+		GroupBy: c.QueryParam("group_by"),
+		Period:  c.QueryParam("period"),
+		Limit:   defaultSalesLimit,
+	}
+
+	switch query.GroupBy {
+	case "":
+		query.GroupBy = models.SalesGroupCompany
+	case models.SalesGroupCompany, models.SalesGroupMedicine, models.SalesGroupFirm, models.SalesGroupPeriod:
+	default:
+		return query, models.NewValidationError("group_by", "must be one of: company, medicine, firm, period")
+	}
+
+	switch query.Period {
+	case "":
+		query.Period = models.SalesPeriodDay
+	case models.SalesPeriodDay, models.SalesPeriodWeek, models.SalesPeriodMonth:
+	default:
+		return query, models.NewValidationError("period", "must be one of: day, week, month")
+	}
+
+	// Dates are inclusive days in UTC; To is turned into the exclusive end of the range
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to, err := dateParam(c, "to", today)
+	if err != nil {
+		return query, err
+	}
+	from, err := dateParam(c, "from", to.AddDate(0, 0, 1-defaultSalesDays))
+	if err != nil {
+		return query, err
+	}
+	if from.After(to) {
+		return query, models.NewValidationError("from", "must not be after to")
+	}
+	if to.Sub(from) >= maxSalesDays*24*time.Hour {
+		return query, models.NewValidationError("from", "range must not exceed "+strconv.Itoa(maxSalesDays)+" days")
+	}
+	query.From, query.To = from, to.AddDate(0, 0, 1)
+
+	if query.GroupBy == models.SalesGroupPeriod && query.Period == models.SalesPeriodDay &&
+		query.To.Sub(query.From) > maxSalesDayBucket*24*time.Hour {
+		return query, models.NewValidationError("period", "daily buckets are limited to "+strconv.Itoa(maxSalesDayBucket)+" days; use week or month")
+	}
+
+	statuses, err := orderStatusesParam(c)
+	if err != nil {
+		return query, err
+	}
+	query.Statuses = statuses
+
+	if param := c.QueryParam("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxSalesLimit {
+			return query, models.NewValidationError("limit", "must be between 1 and "+strconv.Itoa(maxSalesLimit))
+		}
+		query.Limit = n
+	}
+
+	return query, nil
+}
+
+// dateParam parses a YYYY-MM-DD query parameter, returning fallback when it is absent
+func dateParam(c echo.Context, name string, fallback time.Time) (time.Time, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return fallback, nil
+	}
+	date, err := time.Parse("2006-01-02", param)
+	if err != nil {
+		return time.Time{}, models.NewValidationError(name, "must be a date in YYYY-MM-DD format")
+	}
+	return date, nil
+}
+
+// idParam parses an optional positive ID query parameter, returning 0 when it is absent
+func idParam(c echo.Context, name string) (uint, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(param, 10, 32)
+	if err != nil || id == 0 {
+		return 0, models.NewValidationError(name, "must be a positive integer")
+	}
+	return uint(id), nil
+}
+
+// orderStatusesParam parses the comma-separated ?status= parameter. Without
+// it only placed orders are included, leaving out drafts and cancelled orders.
+func orderStatusesParam(c echo.Context) ([]string, error) {
+	param := c.QueryParam("status")
+	if param == "" {
+		return models.PlacedOrderStatuses, nil
+	}
+
+	var statuses []string
+	for _, status := range strings.Split(param, ",") {
+		status = strings.TrimSpace(status)
+		if !isOrderStatus(status) {
+			return nil, models.NewValidationError("status", "must be a comma-separated list of: "+strings.Join(models.OrderStatuses, ", "))
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func isOrderStatus(status string) bool {
+	for _, known := range models.OrderStatuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"pharmacy/config"
+	"pharmacy/models"
+	"pharmacy/storage"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// attachmentTypes maps the file types that can be attached to an order to
+// the extension they are stored with
+var attachmentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+}
+
+// AttachmentHandler manages the files attached to orders, such as purchase
+// orders and prescriptions
+type AttachmentHandler struct {
+	orders models.OrderRepo
+	store  storage.Store
+	upload config.UploadConfig
+	auth   *models.AuthService
+}
+
+// NewAttachmentHandler creates a new instance of the handler
+func NewAttachmentHandler(orders models.OrderRepo, store storage.Store, upload config.UploadConfig, auth *models.AuthService) *AttachmentHandler {
+	return &AttachmentHandler{orders: orders, store: store, upload: upload, auth: auth}
+}
+
+// UploadAttachment attaches a PDF or image to an order. Customers can attach
+// files to their own orders; admins to any order.
+func (h *AttachmentHandler) UploadAttachment(c echo.Context) error {
+	orderID, userID, _, err := h.authorizeOrder(c)
+	if err != nil {
+		return err
+	}
+
+	kind := c.FormValue("kind")
+	if kind == "" {
+		kind = models.AttachmentKindOther
+	}
+	switch kind {
+	case models.AttachmentKindPurchaseOrder, models.AttachmentKindPrescription, models.AttachmentKindOther:
+	default:
+		return models.NewValidationError("kind", "must be one of: purchase_order, prescription, other")
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "File is required")
+	}
+	if file.Size > h.upload.MaxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "File is too large")
+	}
+	if file.Size == 0 {
+		return models.NewValidationError("file", "must not be empty")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot open uploaded file")
+	}
+	defer src.Close()
+
+	// The type is sniffed from the content rather than trusted from the client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot read uploaded file")
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := attachmentTypes[contentType]
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Only PDF, JPEG, PNG and WebP files can be attached")
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot read uploaded file")
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("orders/%d/%s%s", orderID, hex.EncodeToString(token), ext)
+
+	ctx := c.Request().Context()
+	if err := h.store.Put(ctx, key, src, file.Size, contentType); err != nil {
+		return err
+	}
+
+	attachment := &models.OrderAttachment{
+		OrderID:     orderID,
+		Kind:        kind,
+		FileName:    attachmentFileName(file.Filename, ext),
+		ContentType: contentType,
+		Size:        file.Size,
+		StorageKey:  key,
+	}
+	if err := h.orders.AddAttachment(attachment, models.UserActor(userID, c.RealIP())); err != nil {
+		if err := h.store.Delete(ctx, key); err != nil {
+			c.Logger().Error(err)
+		}
+		return err
+	}
+	return c.JSON(http.StatusCreated, attachment)
+}
+
+// DownloadAttachment streams an attachment of an order
+func (h *AttachmentHandler) DownloadAttachment(c echo.Context) error {
+	orderID, _, _, err := h.authorizeOrder(c)
+	if err != nil {
+		return err
+	}
+	attachmentID, err := strconv.Atoi(c.Param("attachmentId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment ID")
+	}
+
+	attachment, err := h.orders.GetAttachment(orderID, uint(attachmentID))
+	if err != nil {
+		return err
+	}
+
+	file, err := h.store.Get(c.Request().Context(), attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.NewNotFoundError("Attachment file")
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(attachment.Size, 10))
+	return c.Stream(http.StatusOK, attachment.ContentType, file)
+}
+
+// DeleteAttachment removes an attachment from an order. Customers can only
+// remove files they attached themselves.
+func (h *AttachmentHandler) DeleteAttachment(c echo.Context) error {
+	orderID, userID, isAdmin, err := h.authorizeOrder(c)
+	if err != nil {
+		return err
+	}
+	attachmentID, err := strconv.Atoi(c.Param("attachmentId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment ID")
+	}
+
+	actor := models.UserActor(userID, c.RealIP())
+	if !isAdmin {
+		attachment, err := h.orders.GetAttachment(orderID, uint(attachmentID))
+		if err != nil {
+			return err
+		}
+		if attachment.UploadedBy != actor.String() {
+			return echo.NewHTTPError(http.StatusForbidden, "You can only remove files you attached")
+		}
+	}
+
+	attachment, err := h.orders.DeleteAttachment(orderID, uint(attachmentID), actor)
+	if err != nil {
+		return err
+	}
+	// The attachment is gone either way; a file left behind only wastes space
+	if err := h.store.Delete(c.Request().Context(), attachment.StorageKey); err != nil {
+		c.Logger().Error(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// authorizeOrder returns the order ID from the path and the caller, or an
+// error unless the caller is an admin or the customer who owns the order
+func (h *AttachmentHandler) authorizeOrder(c echo.Context) (orderID, userID uint, isAdmin bool, err error) {
+	userID, isAdmin, err = GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return 0, 0, false, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, false, echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	order, err := h.orders.Get(uint(id), false)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !isAdmin && order.UserID != userID {
+		return 0, 0, false, echo.NewHTTPError(http.StatusForbidden, "You can only access the files of your own orders")
+	}
+	return uint(id), userID, isAdmin, nil
+}
+
+// attachmentFileName is the name an uploaded file is offered for download
+// under: the client's file name without any directory, or a generic name
+func attachmentFileName(name, ext string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment" + ext
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+// pngImage is the start of a PNG file, enough for its type to be detected
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+func TestOrderNotes(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+
+	path := fmt.Sprintf("/orders/%d/notes", order.OrderID)
+	s.call(http.MethodPost, path, token, map[string]string{"body": "  "}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, path, otherToken, map[string]string{"body": "Mine now"}, http.StatusForbidden, nil)
+	s.call(http.MethodPost, path, token, map[string]string{"body": "Deliver after 5pm"}, http.StatusCreated, nil)
+	s.call(http.MethodPost, path, adminToken, map[string]string{"body": "Noted"}, http.StatusCreated, nil)
+
+	if got := s.getOrder(token, order.OrderID); len(got.Notes) != 2 {
+		t.Fatalf("notes = %+v, want two", got.Notes)
+	}
+	s.call(http.MethodGet, fmt.Sprintf("/orders/%d", order.OrderID), otherToken, nil, http.StatusForbidden, nil)
+}
+
+func TestOrderAttachments(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+
+	path := fmt.Sprintf("/orders/%d/attachments", order.OrderID)
+	s.call(http.MethodPost, path, token, newMultipart(t, "file", "notes.txt", []byte("plain text"), nil), http.StatusUnsupportedMediaType, nil)
+	s.call(http.MethodPost, path, token, newMultipart(t, "file", "rx.png", pngImage, map[string]string{"kind": "invoice"}), http.StatusBadRequest, nil)
+	s.call(http.MethodPost, path, otherToken, newMultipart(t, "file", "rx.png", pngImage, nil), http.StatusForbidden, nil)
+
+	var attachment models.OrderAttachment
+	s.call(http.MethodPost, path, token, newMultipart(t, "file", "rx.png", pngImage, map[string]string{"kind": "prescription"}), http.StatusCreated, &attachment)
+	if attachment.ContentType != "image/png" || attachment.Kind != models.AttachmentKindPrescription {
+		t.Fatalf("attachment = %+v", attachment)
+	}
+
+	filePath := fmt.Sprintf("%s/%d", path, attachment.ID)
+	rec := s.request(http.MethodGet, filePath, adminToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != string(pngImage) {
+		t.Fatalf("download: status %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	s.call(http.MethodGet, filePath, otherToken, nil, http.StatusForbidden, nil)
+
+	// Customers cannot remove what staff attached
+	var staffFile models.OrderAttachment
+	s.call(http.MethodPost, path, adminToken, newMultipart(t, "file", "po.png", pngImage, nil), http.StatusCreated, &staffFile)
+	s.call(http.MethodDelete, fmt.Sprintf("%s/%d", path, staffFile.ID), token, nil, http.StatusForbidden, nil)
+
+	s.call(http.MethodDelete, filePath, token, nil, http.StatusNoContent, nil)
+	s.call(http.MethodGet, filePath, token, nil, http.StatusNotFound, nil)
+}
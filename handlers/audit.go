@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Page size limits for GET /audit
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 500
+)
+
+// AuditHandler serves the audit log to admins
+type AuditHandler struct {
+	audit models.AuditRepo
+	auth  *models.AuthService
+}
+
+// NewAuditHandler creates a new instance of the handler
+func NewAuditHandler(audit models.AuditRepo, auth *models.AuthService) *AuditHandler {
+	return &AuditHandler{audit: audit, auth: auth}
+}
+
+// GetAuditLog lists audit records, newest first, optionally filtered by
+// entity type (?entity=) and entity ID (?id=)
+func (h *AuditHandler) GetAuditLog(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	entity := c.QueryParam("entity")
+	switch entity {
+	case "", models.AuditEntityUser, models.AuditEntityCompany, models.AuditEntityMedicine, models.AuditEntityOrder, models.AuditEntityWebhook,
+		models.AuditEntityNotificationTemplate, models.AuditEntityCampaign:
+	default:
+		return models.NewValidationError("entity", "must be one of: user, company, medicine, order, webhook, notification_template, campaign")
+	}
+
+	var entityID uint
+	if param := c.QueryParam("id"); param != "" {
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil || id == 0 {
+			return models.NewValidationError("id", "must be a positive integer")
+		}
+		entityID = uint(id)
+	}
+
+	limit := defaultAuditLimit
+	if param := c.QueryParam("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return models.NewValidationError("limit", "must be between 1 and "+strconv.Itoa(maxAuditLimit))
+		}
+		limit = n
+	}
+
+	entries, err := h.audit.List(entity, entityID, limit)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []models.AuditLog{}
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
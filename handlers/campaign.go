@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CampaignHandler lets admins promote offers to targeted customers and
+// follow up on the orders that came in
+type CampaignHandler struct {
+	campaigns models.CampaignRepo
+	auth      *models.AuthService
+}
+
+// NewCampaignHandler creates a new instance of the handler
+func NewCampaignHandler(campaigns models.CampaignRepo, auth *models.AuthService) *CampaignHandler {
+	return &CampaignHandler{campaigns: campaigns, auth: auth}
+}
+
+// CreateCampaign saves a draft campaign
+func (h *CampaignHandler) CreateCampaign(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	campaign, err := bindCampaign(c)
+	if err != nil {
+		return err
+	}
+	created, err := h.campaigns.Create(campaign, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+// GetAllCampaigns lists the campaigns, newest first, optionally filtered by
+// status (?status=)
+func (h *CampaignHandler) GetAllCampaigns(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	status := c.QueryParam("status")
+	switch status {
+	case "", models.CampaignDraft, models.CampaignSent:
+	default:
+		return models.NewValidationError("status", "must be one of: draft, sent")
+	}
+
+	campaigns, err := h.campaigns.List(status)
+	if err != nil {
+		return err
+	}
+	if campaigns == nil {
+		campaigns = []models.Campaign{}
+	}
+	return c.JSON(http.StatusOK, campaigns)
+}
+
+// GetCampaign returns a campaign
+func (h *CampaignHandler) GetCampaign(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	campaign, err := h.campaigns.Get(uint(id))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, campaign)
+}
+
+// UpdateCampaign replaces the offer, message and targeting of a draft
+func (h *CampaignHandler) UpdateCampaign(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	campaign, err := bindCampaign(c)
+	if err != nil {
+		return err
+	}
+	updated, err := h.campaigns.Update(uint(id), campaign, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeleteCampaign removes a draft
+func (h *CampaignHandler) DeleteCampaign(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.campaigns.Delete(uint(id), models.UserActor(adminID, c.RealIP())); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Campaign deleted successfully"})
+}
+
+// PreviewCampaign shows how many customers a campaign would reach on each
+// channel and the messages the first of them would receive
+func (h *CampaignHandler) PreviewCampaign(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	preview, err := h.campaigns.Preview(uint(id))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, preview)
+}
+
+// SendCampaign sends a draft to its audience. The notifications go out in
+// the background.
+func (h *CampaignHandler) SendCampaign(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	campaign, err := h.campaigns.Send(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, campaign)
+}
+
+// GetCampaignReport reports the delivery of a sent campaign and the orders
+// attributed to it
+func (h *CampaignHandler) GetCampaignReport(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	report, err := h.campaigns.Report(uint(id))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// bindCampaign binds and validates a CampaignRequest into a campaign
+func bindCampaign(c echo.Context) (models.Campaign, error) {
+	var req CampaignRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return models.Campaign{}, err
+	}
+
+	cities, err := targetList("cities", req.Cities)
+	if err != nil {
+		return models.Campaign{}, err
+	}
+	tiers, err := targetList("tiers", req.Tiers)
+	if err != nil {
+		return models.Campaign{}, err
+	}
+
+	return models.Campaign{
+		Name:            req.Name,
+		CompanyID:       req.CompanyID,
+		MedicineID:      req.MedicineID,
+		Offer:           req.Offer,
+		Subject:         req.Subject,
+		Body:            req.Body,
+		Channels:        uniqueEvents(req.Channels),
+		Cities:          cities,
+		Tiers:           tiers,
+		PastPurchasers:  req.PastPurchasers,
+		AttributionDays: req.AttributionDays,
+	}, nil
+}
+
+// targetList trims the values of a targeting filter and drops repeats,
+// ignoring case. Values are stored comma-separated, so commas are rejected.
+func targetList(field string, values []string) ([]string, error) {
+	seen := map[string]bool{}
+	var list []string
+	for i, value := range values {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, ",") {
+			return nil, models.NewValidationError(fmt.Sprintf("%s[%d]", field, i), "must not contain commas")
+		}
+		key := strings.ToLower(value)
+		if value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		list = append(list, value)
+	}
+	return list, nil
+}
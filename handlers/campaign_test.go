@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"strings"
+	"testing"
+)
+
+// customer creates an approved customer in a city and tier and returns
+// their ID, phone number and access token
+func (s *testServer) customer(adminToken, city, tier string) (uint, string, string) {
+	s.t.Helper()
+
+	id, token := s.retailer(adminToken)
+	phone := fmt.Sprint(s.phone)
+	s.call(http.MethodPut, fmt.Sprintf("/user/%d", id), adminToken, map[string]interface{}{
+		"name":      "Retailer " + phone,
+		"phone":     phone,
+		"firm_name": "Firm " + phone,
+		"city":      city,
+		"tier":      tier,
+	}, http.StatusOK, nil)
+	return id, phone, token
+}
+
+func TestCampaigns(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	companyID, medicineID := s.catalog(adminToken)
+	otherCompany := s.company(adminToken, "Sun Pharma")
+
+	for _, campaign := range []map[string]interface{}{
+		{"name": "No company", "offer": "10+1"},
+		{"name": "No medicine", "medicine_id": 999},
+		{"name": "Wrong company", "medicine_id": medicineID, "company_id": otherCompany, "offer": "10+1"},
+		{"name": "No offer", "medicine_id": medicineID},
+		{"name": "Bad channel", "company_id": companyID, "offer": "10+1", "channels": []string{"fax"}},
+		{"name": "Bad city", "company_id": companyID, "offer": "10+1", "cities": []string{"Pune, Mumbai"}},
+		{"name": "Bad body", "company_id": companyID, "offer": "10+1", "body": "{{.orderId}}"},
+	} {
+		s.call(http.MethodPost, "/campaigns", adminToken, campaign, http.StatusBadRequest, nil)
+	}
+
+	// The company and offer come from the medicine
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "medicine_id": medicineID, "offer": "10+1"}, http.StatusOK, nil)
+	var created models.Campaign
+	s.call(http.MethodPost, "/campaigns", adminToken, map[string]interface{}{
+		"name":        "Monsoon",
+		"medicine_id": medicineID,
+		"cities":      []string{"Pune", " pune ", "Mumbai"},
+	}, http.StatusCreated, &created)
+	if created.Status != models.CampaignDraft || created.CompanyID != companyID || created.Offer != "10+1" || len(created.Cities) != 2 || created.AttributionDays != 14 {
+		t.Fatalf("campaign = %+v, want a draft of the medicine's offer in two cities", created)
+	}
+
+	path := fmt.Sprintf("/campaigns/%d", created.ID)
+	var updated models.Campaign
+	s.call(http.MethodPut, path, adminToken, map[string]interface{}{
+		"name":             "Monsoon",
+		"company_id":       companyID,
+		"offer":            "5% off",
+		"attribution_days": 7,
+	}, http.StatusOK, &updated)
+	if updated.MedicineID != nil || updated.Offer != "5% off" || len(updated.Cities) != 0 || updated.AttributionDays != 7 {
+		t.Fatalf("updated campaign = %+v, want a company-wide offer without targeting", updated)
+	}
+	s.call(http.MethodGet, path+"/report", adminToken, nil, http.StatusConflict, nil)
+
+	var campaigns []models.Campaign
+	s.call(http.MethodGet, "/campaigns?status=sent", adminToken, nil, http.StatusOK, &campaigns)
+	if len(campaigns) != 0 {
+		t.Fatalf("sent campaigns = %+v, want none", campaigns)
+	}
+	s.call(http.MethodGet, "/campaigns?status=draft", adminToken, nil, http.StatusOK, &campaigns)
+	if len(campaigns) != 1 {
+		t.Fatalf("draft campaigns = %+v, want one", campaigns)
+	}
+	s.call(http.MethodGet, "/campaigns?status=scheduled", adminToken, nil, http.StatusBadRequest, nil)
+
+	s.call(http.MethodDelete, path, adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, path, adminToken, nil, http.StatusNotFound, nil)
+}
+
+func TestCampaignSend(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	companyID, medicineID := s.catalog(adminToken)
+	_, targetPhone, targetToken := s.customer(adminToken, "Pune", "Gold")
+	_, untieredPhone, _ := s.customer(adminToken, "Pune", "")
+	_, elsewherePhone, elsewhereToken := s.customer(adminToken, "Mumbai", "Gold")
+
+	var nobody models.Campaign
+	s.call(http.MethodPost, "/campaigns", adminToken, map[string]interface{}{
+		"name": "Nobody", "company_id": companyID, "offer": "10+1", "cities": []string{"Delhi"},
+	}, http.StatusCreated, &nobody)
+	s.call(http.MethodPost, fmt.Sprintf("/campaigns/%d/send", nobody.ID), adminToken, nil, http.StatusBadRequest, nil)
+
+	var campaign models.Campaign
+	s.call(http.MethodPost, "/campaigns", adminToken, map[string]interface{}{
+		"name":       "Gold in Pune",
+		"company_id": companyID,
+		"offer":      "10+1",
+		"body":       "{{.firmName}}: {{.offer}} on everything from {{.companyName}}",
+		"channels":   []string{models.ChannelSMS},
+		"cities":     []string{"PUNE"},
+		"tiers":      []string{"gold"},
+	}, http.StatusCreated, &campaign)
+	path := fmt.Sprintf("/campaigns/%d", campaign.ID)
+
+	var preview models.CampaignPreview
+	s.call(http.MethodGet, path+"/preview", adminToken, nil, http.StatusOK, &preview)
+	want := fmt.Sprintf("Firm %s: 10+1 on everything from Cipla", targetPhone)
+	if preview.Audience != 1 || preview.Recipients != 1 || preview.Messages[models.ChannelSMS] != 1 || len(preview.Samples) != 1 || preview.Samples[0].Body != want {
+		t.Fatalf("preview = %+v, want one SMS to the Gold customer in Pune", preview)
+	}
+
+	var sent models.Campaign
+	s.call(http.MethodPost, path+"/send", adminToken, nil, http.StatusAccepted, &sent)
+	if sent.Status != models.CampaignSent || sent.SentAt == nil {
+		t.Fatalf("campaign = %+v, want it sent", sent)
+	}
+	s.call(http.MethodPost, path+"/send", adminToken, nil, http.StatusConflict, nil)
+	s.call(http.MethodPut, path, adminToken, map[string]interface{}{"name": "Too late", "company_id": companyID, "offer": "10+1"}, http.StatusConflict, nil)
+	s.call(http.MethodDelete, path, adminToken, nil, http.StatusConflict, nil)
+
+	s.dispatchNotifications(1)
+	if s.sms.messages[targetPhone] != want {
+		t.Fatalf("SMS = %q, want %q", s.sms.messages[targetPhone], want)
+	}
+	for _, phone := range []string{untieredPhone, elsewherePhone} {
+		if strings.Contains(s.sms.messages[phone], "Cipla") {
+			t.Fatalf("%s outside the audience received %q", phone, s.sms.messages[phone])
+		}
+	}
+
+	// Only orders of customers who received the campaign count
+	s.order(targetToken, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+	s.order(elsewhereToken, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 5})
+
+	var report models.CampaignReport
+	s.call(http.MethodGet, path+"/report", adminToken, nil, http.StatusOK, &report)
+	if report.Recipients != 1 || report.Reached != 1 || report.Channels[models.ChannelSMS].Delivered != 1 {
+		t.Fatalf("report = %+v, want one customer reached by SMS", report)
+	}
+	if report.Orders != 1 || report.Customers != 1 || report.Quantity != 3 || report.Revenue != 30 || report.Conversion == nil || *report.Conversion != 100 {
+		t.Fatalf("report = %+v, want the reached customer's order of 3 units", report)
+	}
+}
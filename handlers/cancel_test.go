@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+// cancel asks to cancel an order and returns it when the request succeeds
+func (s *testServer) cancel(token string, id uint, reason, note string, want int) models.OrderRequest {
+	s.t.Helper()
+
+	var order models.OrderRequest
+	var out interface{}
+	if want == http.StatusOK || want == http.StatusAccepted {
+		out = &order
+	}
+	s.call(http.MethodPost, fmt.Sprintf("/orders/%d/cancel", id), token, map[string]string{"reason": reason, "note": note}, want, out)
+	return order
+}
+
+func TestCustomerCancelsOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	s.setStock(adminToken, medicineID, 10)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+
+	s.cancel(token, order.OrderID, "changed_my_mind", "", http.StatusBadRequest)
+	s.cancel(token, order.OrderID, models.CancelReasonOther, " ", http.StatusBadRequest)
+	s.cancel(otherToken, order.OrderID, models.CancelReasonCustomerRequest, "", http.StatusForbidden)
+
+	cancelled := s.cancel(token, order.OrderID, models.CancelReasonDuplicateOrder, "", http.StatusOK)
+	if cancelled.Status != models.OrderStatusCancelled || cancelled.Cancellation == nil || cancelled.Cancellation.Reason != models.CancelReasonDuplicateOrder {
+		t.Fatalf("order = %+v, want cancelled as a duplicate", cancelled)
+	}
+	if got := s.stock(medicineID); got != 10 {
+		t.Fatalf("stock after cancelling = %d, want the 4 units released", got)
+	}
+	s.cancel(token, order.OrderID, models.CancelReasonDuplicateOrder, "", http.StatusConflict)
+}
+
+func TestCustomerCannotCancelProcessingOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK)
+
+	s.cancel(token, order.OrderID, models.CancelReasonCustomerRequest, "", http.StatusForbidden)
+}
+
+func TestCancellationApproval(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, secondAdminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	s.setStock(adminToken, medicineID, 10)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK)
+
+	path := fmt.Sprintf("/orders/%d/cancel", order.OrderID)
+	s.call(http.MethodPost, path+"/approve", adminToken, nil, http.StatusConflict, nil)
+
+	requested := s.cancel(adminToken, order.OrderID, models.CancelReasonOutOfStock, "", http.StatusAccepted)
+	if requested.Status != models.OrderStatusProcessing || requested.Cancellation.Status != models.CancellationRequested {
+		t.Fatalf("order = %+v, want a cancellation waiting for approval", requested)
+	}
+	s.cancel(secondAdminToken, order.OrderID, models.CancelReasonOutOfStock, "", http.StatusConflict)
+
+	// The requesting admin cannot approve their own request
+	s.call(http.MethodPost, path+"/approve", adminToken, nil, http.StatusForbidden, nil)
+	s.call(http.MethodPost, path+"/reject", secondAdminToken, nil, http.StatusOK, nil)
+	if got := s.getOrder(token, order.OrderID); got.Cancellation != nil {
+		t.Fatalf("cancellation after rejecting = %+v, want none", got.Cancellation)
+	}
+
+	s.cancel(adminToken, order.OrderID, models.CancelReasonOutOfStock, "", http.StatusAccepted)
+	var cancelled models.OrderRequest
+	s.call(http.MethodPost, path+"/approve", secondAdminToken, nil, http.StatusOK, &cancelled)
+	if cancelled.Status != models.OrderStatusCancelled || cancelled.Cancellation.Status != models.CancellationDone {
+		t.Fatalf("order = %+v, want cancelled", cancelled)
+	}
+	if got := s.stock(medicineID); got != 10 {
+		t.Fatalf("stock after cancelling = %d, want the 4 units released", got)
+	}
+}
+
+func TestCancelledOrderIsLocked(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	s.setStock(adminToken, medicineID, 10)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+	s.cancel(token, order.OrderID, models.CancelReasonCustomerRequest, "", http.StatusOK)
+
+	// Editing a cancelled order must not reserve stock again
+	update := map[string]interface{}{"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: companyID, Quantity: 6}}}
+	s.call(http.MethodPut, fmt.Sprintf("/orders/%d", order.OrderID), token, update, http.StatusConflict, nil)
+	s.call(http.MethodPut, fmt.Sprintf("/orders/%d", order.OrderID), adminToken, update, http.StatusConflict, nil)
+	if got := s.stock(medicineID); got != 10 {
+		t.Fatalf("stock after editing a cancelled order = %d, want 10", got)
+	}
+
+	// Nor can it be revived through its status
+	s.setStatus(token, order.OrderID, models.OrderStatusPending, http.StatusForbidden)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusPending, http.StatusConflict)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusConflict)
+}
+
+func TestShippedOrderIsLocked(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusShipped, http.StatusOK)
+
+	update := map[string]interface{}{"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: companyID, Quantity: 6}}}
+	s.call(http.MethodPut, fmt.Sprintf("/orders/%d", order.OrderID), adminToken, update, http.StatusConflict, nil)
+	s.cancel(adminToken, order.OrderID, models.CancelReasonPricingError, "", http.StatusConflict)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CartHandler manages the caller's server-side cart
+type CartHandler struct {
+	carts models.CartRepo
+	auth  *models.AuthService
+}
+
+// NewCartHandler creates a new instance of the handler
+func NewCartHandler(carts models.CartRepo, auth *models.AuthService) *CartHandler {
+	return &CartHandler{carts: carts, auth: auth}
+}
+
+// GetCart returns the caller's cart priced with the current prices and offers
+func (h *CartHandler) GetCart(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.carts.Get(actor.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// AddItem adds a medicine to the cart, or increases its quantity if it is already there
+func (h *CartHandler) AddItem(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	var req AddCartItemRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	cart, err := h.carts.AddItem(actor.UserID, req.MedicineID, req.Quantity)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// UpdateItem sets the quantity of a medicine in the cart
+func (h *CartHandler) UpdateItem(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	medicineID, err := strconv.Atoi(c.Param("medicineId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
+	}
+
+	var req SetCartItemRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	cart, err := h.carts.SetItem(actor.UserID, uint(medicineID), req.Quantity)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveItem removes a medicine from the cart
+func (h *CartHandler) RemoveItem(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	medicineID, err := strconv.Atoi(c.Param("medicineId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
+	}
+
+	cart, err := h.carts.RemoveItem(actor.UserID, uint(medicineID))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// ClearCart removes every item from the cart
+func (h *CartHandler) ClearCart(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	if err := h.carts.Clear(actor.UserID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Checkout places the cart as a pending order and empties it
+func (h *CartHandler) Checkout(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	order, err := h.carts.Checkout(actor.UserID, actor)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, order)
+}
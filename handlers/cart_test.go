@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+func TestCart(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	second := s.medicine(adminToken, companyID, "Ibuprofen", 20)
+
+	var cart models.Cart
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("new cart = %+v, want it empty", cart)
+	}
+
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": 999, "quantity": 1}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": medicineID, "quantity": 0}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": medicineID, "quantity": 2}, http.StatusOK, nil)
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": medicineID, "quantity": 3}, http.StatusOK, nil)
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": second, "quantity": 1}, http.StatusOK, &cart)
+	if len(cart.Items) != 2 || cart.Items[0].Quantity != 5 || cart.TotalQuantity != 6 || cart.TotalValue != 70 {
+		t.Fatalf("cart = %+v, want 5 + 1 units worth 70", cart)
+	}
+
+	s.call(http.MethodPut, fmt.Sprintf("/cart/items/%d", second), token, map[string]int{"quantity": 4}, http.StatusOK, &cart)
+	if cart.TotalValue != 130 {
+		t.Fatalf("total after update = %v, want 130", cart.TotalValue)
+	}
+	s.call(http.MethodPut, "/cart/items/999", token, map[string]int{"quantity": 4}, http.StatusNotFound, nil)
+	s.call(http.MethodDelete, fmt.Sprintf("/cart/items/%d", second), token, nil, http.StatusOK, &cart)
+	if len(cart.Items) != 1 {
+		t.Fatalf("cart after removing an item = %+v", cart)
+	}
+	s.call(http.MethodDelete, fmt.Sprintf("/cart/items/%d", second), token, nil, http.StatusNotFound, nil)
+
+	// Carts are private to their owner
+	s.call(http.MethodGet, "/cart", otherToken, nil, http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("another customer's cart = %+v, want it empty", cart)
+	}
+
+	s.call(http.MethodDelete, "/cart", token, nil, http.StatusNoContent, nil)
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("cleared cart = %+v", cart)
+	}
+}
+
+func TestCartLivePricing(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	deleted := s.medicine(adminToken, companyID, "Discontinued", 5)
+
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": medicineID, "quantity": 20}, http.StatusOK, nil)
+	s.call(http.MethodPost, "/cart/items", token, map[string]interface{}{"medicineId": deleted, "quantity": 1}, http.StatusOK, nil)
+
+	s.call(http.MethodPut, fmt.Sprintf("/medicines/%d", medicineID), adminToken, map[string]interface{}{"name": "Paracetamol", "company_id": companyID, "price": 12}, http.StatusOK, nil)
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "medicine_id": medicineID, "offer": "10+1"}, http.StatusOK, nil)
+	s.setStock(adminToken, medicineID, 15)
+	s.call(http.MethodDelete, fmt.Sprintf("/medicines/%d", deleted), adminToken, nil, http.StatusOK, nil)
+
+	var cart models.Cart
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusOK, &cart)
+	line := cart.Items[0]
+	if line.UnitPrice != 12 || line.FreeQuantity != 2 || len(line.Warnings) != 1 {
+		t.Fatalf("line = %+v, want the new price, 2 free units and a stock warning", line)
+	}
+	if cart.Items[1].Available || cart.Warnings != 2 {
+		t.Fatalf("cart = %+v, want the deleted medicine flagged", cart)
+	}
+
+	// Checkout fails until the unavailable medicine is removed
+	s.call(http.MethodPost, "/cart/checkout", token, nil, http.StatusBadRequest, nil)
+	s.call(http.MethodDelete, fmt.Sprintf("/cart/items/%d", deleted), token, nil, http.StatusOK, nil)
+
+	var order models.OrderRequest
+	s.call(http.MethodPost, "/cart/checkout", token, nil, http.StatusCreated, &order)
+	if order.Status != models.OrderStatusPending || len(order.Items) != 1 || order.Items[0].UnitPrice != 12 || order.Items[0].FreeQuantity != 2 {
+		t.Fatalf("order = %+v, want the cart at the current price and offer", order)
+	}
+	if got := s.stock(medicineID); got != 0 {
+		t.Fatalf("stock after checkout = %d, want the 15 units reserved", got)
+	}
+
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("cart after checkout = %+v, want it empty", cart)
+	}
+	s.call(http.MethodPost, "/cart/checkout", token, nil, http.StatusBadRequest, nil)
+}
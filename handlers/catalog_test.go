@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+// newMultipart encodes a file and form fields as multipart/form-data
+func newMultipart(t *testing.T, field, fileName string, content []byte, values map[string]string) *multipartBody {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for key, value := range values {
+		if err := w.WriteField(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := w.CreateFormFile(field, fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &multipartBody{body: &buf, contentType: w.FormDataContentType()}
+}
+
+func TestCompanies(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+
+	s.call(http.MethodPost, "/companies", adminToken, map[string]string{"company_name": ""}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/companies", adminToken, map[string]string{"company_name": "Cipla", "logo_url": "not a url"}, http.StatusBadRequest, nil)
+	id := s.company(adminToken, "Cipla")
+
+	var company models.Company
+	s.call(http.MethodPut, fmt.Sprintf("/companies/%d", id), adminToken, map[string]string{"company_name": "Cipla Ltd", "description": "Generics"}, http.StatusOK, &company)
+	if company.CompanyName != "Cipla Ltd" || company.Description != "Generics" {
+		t.Fatalf("updated company = %+v", company)
+	}
+	s.call(http.MethodGet, fmt.Sprintf("/companies/%d", id), "", nil, http.StatusOK, &company)
+
+	var companies []models.Company
+	s.call(http.MethodGet, "/companies", "", nil, http.StatusOK, &companies)
+	if len(companies) != 1 {
+		t.Fatalf("companies = %+v, want one", companies)
+	}
+
+	s.call(http.MethodDelete, fmt.Sprintf("/companies/%d", id), adminToken, nil, http.StatusNoContent, nil)
+	s.call(http.MethodGet, fmt.Sprintf("/companies/%d", id), "", nil, http.StatusNotFound, nil)
+	s.call(http.MethodGet, "/companies", "", nil, http.StatusOK, &companies)
+	if len(companies) != 0 {
+		t.Fatalf("deleted company is still listed: %+v", companies)
+	}
+	s.call(http.MethodGet, "/companies?include_deleted=true", token, nil, http.StatusForbidden, nil)
+	s.call(http.MethodGet, "/companies?include_deleted=true", adminToken, nil, http.StatusOK, &companies)
+	if len(companies) != 1 {
+		t.Fatalf("companies with deleted = %+v, want one", companies)
+	}
+
+	s.call(http.MethodPost, fmt.Sprintf("/companies/%d/restore", id), adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, fmt.Sprintf("/companies/%d", id), "", nil, http.StatusOK, nil)
+}
+
+func TestMedicines(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID := s.company(adminToken, "Cipla")
+
+	s.call(http.MethodPost, "/medicines", adminToken, map[string]interface{}{"name": "Orphan", "company_id": 999}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/medicines", adminToken, map[string]interface{}{"name": "Negative", "company_id": companyID, "price": -1}, http.StatusBadRequest, nil)
+	id := s.medicine(adminToken, companyID, "Paracetamol", 12.5)
+
+	var medicine models.Medicine
+	s.call(http.MethodPut, fmt.Sprintf("/medicines/%d", id), adminToken, map[string]interface{}{"name": "Paracetamol 500", "company_id": companyID, "price": 14}, http.StatusOK, &medicine)
+	if medicine.Name != "Paracetamol 500" || medicine.Price != 14 {
+		t.Fatalf("updated medicine = %+v", medicine)
+	}
+
+	var listed []models.CompanyMedicinesResponse
+	s.call(http.MethodGet, "/medicines", "", nil, http.StatusOK, &listed)
+	if len(listed) != 1 || len(listed[0].Medicines) != 1 || listed[0].Medicines[0].MedicineID != id {
+		t.Fatalf("medicines = %+v", listed)
+	}
+
+	s.call(http.MethodDelete, fmt.Sprintf("/medicines/%d", id), adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, fmt.Sprintf("/medicines/%d", id), "", nil, http.StatusNotFound, nil)
+	s.call(http.MethodPost, fmt.Sprintf("/medicines/%d/restore", id), token, nil, http.StatusForbidden, nil)
+	s.call(http.MethodPost, fmt.Sprintf("/medicines/%d/restore", id), adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, fmt.Sprintf("/medicines/%d", id), "", nil, http.StatusOK, nil)
+}
+
+func TestSetStock(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	id := s.medicine(adminToken, s.company(adminToken, "Cipla"), "Paracetamol", 10)
+
+	path := fmt.Sprintf("/medicines/%d/stock", id)
+	s.call(http.MethodPut, path, token, map[string]int{"stock": 100}, http.StatusForbidden, nil)
+	s.call(http.MethodPut, path, adminToken, map[string]int{"stock": -1}, http.StatusBadRequest, nil)
+	s.setStock(adminToken, id, 25)
+	if got := s.stock(id); got != 25 {
+		t.Fatalf("stock = %d, want 25", got)
+	}
+
+	var medicine models.Medicine
+	s.call(http.MethodPut, path, adminToken, map[string]interface{}{"stock": nil}, http.StatusOK, &medicine)
+	if medicine.Stock != nil {
+		t.Fatalf("stock = %d, want untracked", *medicine.Stock)
+	}
+}
+
+func TestUpdateOffer(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	companyID := s.company(adminToken, "Cipla")
+	first := s.medicine(adminToken, companyID, "Paracetamol", 10)
+	second := s.medicine(adminToken, companyID, "Ibuprofen", 20)
+
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "offer": "10+1"}, http.StatusOK, nil)
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "medicine_id": second, "offer": "5+1"}, http.StatusOK, nil)
+
+	otherCompany := s.company(adminToken, "Sun Pharma")
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": 999, "offer": "2+1"}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": otherCompany, "medicine_id": first, "offer": "2+1"}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "medicine_id": 999, "offer": "2+1"}, http.StatusNotFound, nil)
+
+	for id, want := range map[uint]string{first: "10+1", second: "5+1"} {
+		var medicine models.Medicine
+		s.call(http.MethodGet, fmt.Sprintf("/medicines/%d", id), "", nil, http.StatusOK, &medicine)
+		if medicine.Offer != want {
+			t.Errorf("offer of medicine %d = %q, want %q", id, medicine.Offer, want)
+		}
+	}
+}
+
+func TestUploadMedicinesCSV(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	s.company(adminToken, "Cipla")
+
+	s.call(http.MethodPost, "/medicines/upload", adminToken, nil, http.StatusBadRequest, nil)
+
+	csv := []byte("Name,Description,CompanyName\nParacetamol,Fever,Cipla\nCetirizine,Allergy,Cipla\n")
+	s.call(http.MethodPost, "/medicines/upload", adminToken, newMultipart(t, "file", "medicines.csv", csv, nil), http.StatusOK, nil)
+
+	var listed []models.CompanyMedicinesResponse
+	s.call(http.MethodGet, "/medicines", "", nil, http.StatusOK, &listed)
+	if len(listed) != 1 || len(listed[0].Medicines) != 2 {
+		t.Fatalf("medicines after upload = %+v", listed)
+	}
+}
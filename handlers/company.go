@@ -9,25 +9,33 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-// CompanyHandler holds the database connection and provides methods to handle HTTP requests
-type CompanyHandler struct{}
+// CompanyHandler holds the company repository and provides methods to handle HTTP requests
+type CompanyHandler struct {
+	companies models.CompanyRepo
+	auth      *models.AuthService
+}
 
 // NewCompanyHandler creates a new instance of the handler
-func NewCompanyHandler() *CompanyHandler {
-	return &CompanyHandler{}
+func NewCompanyHandler(companies models.CompanyRepo, auth *models.AuthService) *CompanyHandler {
+	return &CompanyHandler{companies: companies, auth: auth}
 }
 
 // CreateCompany handles POST requests to create a new company
 func (h *CompanyHandler) CreateCompany(c echo.Context) error {
-	var company models.Company
-	if err := c.Bind(&company); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid data"})
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	var req CompanyRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// Call the model's CreateCompany function to insert the company
-	createdCompany, err := models.CreateCompany(company.CompanyName, company.Description, company.UpdatedBy, company.LogoUrl)
+	// Call the repository's Create function to insert the company
+	createdCompany, err := h.companies.Create(req.CompanyName, req.Description, req.LogoUrl, actor)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not create company"})
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, createdCompany)
@@ -37,12 +45,12 @@ func (h *CompanyHandler) CreateCompany(c echo.Context) error {
 func (h *CompanyHandler) GetCompany(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid company ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid company ID")
 	}
 
-	company, err := models.GetCompany(uint(id))
+	company, err := h.companies.Get(uint(id))
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Company not found"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, company)
@@ -50,20 +58,25 @@ func (h *CompanyHandler) GetCompany(c echo.Context) error {
 
 // UpdateCompany handles PUT requests to update an existing company
 func (h *CompanyHandler) UpdateCompany(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid company ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid company ID")
 	}
 
-	var company models.Company
-	if err := c.Bind(&company); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid data"})
+	var req CompanyRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// Call the model's UpdateCompany function to update the company
-	updatedCompany, err := models.UpdateCompany(uint(id), company.CompanyName, company.Description, company.UpdatedBy, company.LogoUrl)
+	// Call the repository's Update function to update the company
+	updatedCompany, err := h.companies.Update(uint(id), req.CompanyName, req.Description, req.LogoUrl, actor)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not update company"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, updatedCompany)
@@ -71,24 +84,54 @@ func (h *CompanyHandler) UpdateCompany(c echo.Context) error {
 
 // DeleteCompany handles DELETE requests to remove a company
 func (h *CompanyHandler) DeleteCompany(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid company ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid company ID")
 	}
 
-	// Call the model's DeleteCompany function to delete the company
-	if err := models.DeleteCompany(uint(id)); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not delete company"})
+	// Call the repository's Delete function to delete the company
+	if err := h.companies.Delete(uint(id), actor); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusNoContent, nil)
 }
 
+// RestoreCompany handles POST requests to undo the deletion of a company
+func (h *CompanyHandler) RestoreCompany(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid company ID")
+	}
+
+	company, err := h.companies.Restore(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, company)
+}
+
 // GetAllCompanies handles GET requests to retrieve all companies
 func (h *CompanyHandler) GetAllCompanies(c echo.Context) error {
-	companies, err := models.GetAllCompanies()
+	withDeleted, err := includeDeleted(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	companies, err := h.companies.List(withDeleted)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not retrieve companies"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, companies)
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorResponse is the JSON body of every error returned by the API
+type ErrorResponse struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+// Error codes, one per HTTP status the API returns
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "service_unavailable",
+}
+
+// HTTPErrorHandler writes errors returned by handlers and middleware as an
+// ErrorResponse. Domain errors from the models package get their matching
+// status; any other error is logged and reported as a generic 500 so that
+// database details never reach the client.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, response := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+	response.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, response)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// errorResponse maps an error to its HTTP status and response body
+func errorResponse(err error) (int, ErrorResponse) {
+	var (
+		httpErr       *echo.HTTPError
+		notFoundErr   *models.NotFoundError
+		conflictErr   *models.ConflictError
+		validationErr *models.ValidationError
+		forbiddenErr  *models.ForbiddenError
+	)
+
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest, ErrorResponse{
+			Code:    "validation_failed",
+			Message: validationErr.Message,
+			Details: validationErr.Fields,
+		}
+	case errors.As(err, &notFoundErr):
+		return newErrorResponse(http.StatusNotFound, notFoundErr.Error())
+	case errors.As(err, &conflictErr):
+		return newErrorResponse(http.StatusConflict, conflictErr.Message)
+	case errors.As(err, &forbiddenErr):
+		return newErrorResponse(http.StatusForbidden, forbiddenErr.Message)
+	case errors.As(err, &httpErr):
+		message, ok := httpErr.Message.(string)
+		if !ok {
+			message = fmt.Sprint(httpErr.Message)
+		}
+		return newErrorResponse(httpErr.Code, message)
+	}
+
+	return newErrorResponse(http.StatusInternalServerError, "Internal server error")
+}
+
+func newErrorResponse(status int, message string) (int, ErrorResponse) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = "error"
+	}
+	return status, ErrorResponse{Code: code, Message: message}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+// fulfil records the fulfilment of an order
+func (s *testServer) fulfil(adminToken string, id uint, items []FulfilItemInput, want int) models.OrderRequest {
+	s.t.Helper()
+
+	var order models.OrderRequest
+	var out interface{}
+	if want == http.StatusOK {
+		out = &order
+	}
+	s.call(http.MethodPost, fmt.Sprintf("/orders/%d/fulfilment", id), adminToken, map[string]interface{}{"items": items}, want, out)
+	return order
+}
+
+func TestFulfilOrderInFull(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+
+	s.call(http.MethodPost, fmt.Sprintf("/orders/%d/fulfilment", order.OrderID), token, map[string]interface{}{}, http.StatusForbidden, nil)
+
+	shipped := s.fulfil(adminToken, order.OrderID, nil, http.StatusOK)
+	if shipped.Status != models.OrderStatusShipped || shipped.BackorderID != nil {
+		t.Fatalf("order = %+v, want shipped without a backorder", shipped)
+	}
+	if item := shipped.Items[0]; item.FulfilledQuantity != 4 || item.LineStatus != models.LineStatusShipped {
+		t.Fatalf("item = %+v, want 4 units shipped", item)
+	}
+	s.fulfil(adminToken, order.OrderID, nil, http.StatusConflict)
+}
+
+func TestFulfilOrderWithBackorder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	s.setStock(adminToken, medicineID, 10)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 10})
+	if got := s.stock(medicineID); got != 0 {
+		t.Fatalf("stock after ordering = %d, want 0", got)
+	}
+
+	s.fulfil(adminToken, order.OrderID, []FulfilItemInput{{MedicineID: 999, Fulfilled: 1}}, http.StatusBadRequest)
+	s.fulfil(adminToken, order.OrderID, []FulfilItemInput{{MedicineID: medicineID, Fulfilled: 8, Cancelled: 3}}, http.StatusBadRequest)
+	s.fulfil(adminToken, order.OrderID, []FulfilItemInput{{MedicineID: medicineID, Cancelled: 2}}, http.StatusBadRequest)
+
+	partial := s.fulfil(adminToken, order.OrderID, []FulfilItemInput{{MedicineID: medicineID, Fulfilled: 6, Cancelled: 1}}, http.StatusOK)
+	if partial.Status != models.OrderStatusPartiallyShipped || partial.BackorderID == nil {
+		t.Fatalf("order = %+v, want partially shipped with a backorder", partial)
+	}
+	item := partial.Items[0]
+	if item.FulfilledQuantity != 6 || item.CancelledQuantity != 1 || item.BackorderedQuantity != 3 {
+		t.Fatalf("item = %+v, want 6 shipped, 1 cancelled and 3 backordered", item)
+	}
+
+	backorder := s.getOrder(token, *partial.BackorderID)
+	if backorder.Status != models.OrderStatusPending || backorder.BackorderOf == nil || *backorder.BackorderOf != order.OrderID {
+		t.Fatalf("backorder = %+v, want a pending backorder of order %d", backorder, order.OrderID)
+	}
+	if len(backorder.Items) != 1 || backorder.Items[0].Quantity != 3 || backorder.Items[0].UnitPrice != 10 {
+		t.Fatalf("backorder items = %+v, want 3 units at the original price", backorder.Items)
+	}
+
+	// The cancelled unit goes back to stock; the backordered ones stay reserved
+	if got := s.stock(medicineID); got != 1 {
+		t.Fatalf("stock after fulfilment = %d, want 1", got)
+	}
+}
+
+func TestFulfilledOrderIsLocked(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 10})
+	s.fulfil(adminToken, order.OrderID, []FulfilItemInput{{MedicineID: medicineID, Fulfilled: 4}}, http.StatusOK)
+
+	update := map[string]interface{}{"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: companyID, Quantity: 1}}}
+	s.call(http.MethodPut, fmt.Sprintf("/orders/%d", order.OrderID), token, update, http.StatusConflict, nil)
+	s.call(http.MethodPut, fmt.Sprintf("/orders/%d", order.OrderID), adminToken, update, http.StatusConflict, nil)
+
+	// Partially shipped orders only move on through delivery
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusConflict)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusShipped, http.StatusConflict)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusDelivered, http.StatusOK)
+}
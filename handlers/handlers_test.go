@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pharmacy/config"
+	"pharmacy/models"
+	"pharmacy/storage"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// testServer is the API mounted on a private in-memory database
+type testServer struct {
+	t     *testing.T
+	e     *echo.Echo
+	db    *gorm.DB
+	repos *models.Repositories
+	sms   *testSMSSender
+	phone int // Last phone number handed out by newPhone
+}
+
+// testSMSSender keeps the last message sent to each phone
+type testSMSSender struct {
+	messages map[string]string
+}
+
+// SendSMS records the message
+func (s *testSMSSender) SendSMS(phone, message string) error {
+	s.messages[phone] = message
+	return nil
+}
+
+// newTestServer builds the routes the way serve does, on an empty database
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	db, err := models.OpenInMemory()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	cfg := config.Default()
+	cfg.JWT.Secret = "test-secret"
+	cfg.Upload.Dir = t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("opening storage: %v", err)
+	}
+
+	repos := models.NewRepositories(db)
+	sms := &testSMSSender{messages: map[string]string{}}
+	auth := models.NewAuthService(db, repos.Users, cfg.JWT, sms, models.SMSNotifier{Sender: sms})
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	RegisterRoutes(e, cfg, repos, auth, store)
+
+	return &testServer{t: t, e: e, db: db, repos: repos, sms: sms, phone: 9000000000}
+}
+
+// request sends a request with an optional bearer token and body. Bodies
+// that are not already a reader are sent as JSON.
+func (s *testServer) request(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	contentType := echo.MIMEApplicationJSON
+	switch b := body.(type) {
+	case nil:
+	case *multipartBody:
+		reader, contentType = b.body, b.contentType
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encoding body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// call sends a request, checks the status and decodes the response into out
+// when it is not nil
+func (s *testServer) call(method, path, token string, body interface{}, status int, out interface{}) {
+	s.t.Helper()
+
+	rec := s.request(method, path, token, body)
+	if rec.Code != status {
+		s.t.Fatalf("%s %s: status %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+}
+
+// newPhone returns a phone number that has not been used yet
+func (s *testServer) newPhone() string {
+	s.phone++
+	return fmt.Sprint(s.phone)
+}
+
+// login authenticates with a phone number and password and returns the
+// access token
+func (s *testServer) login(phone, password string) string {
+	s.t.Helper()
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	s.call(http.MethodPost, "/authenticate", "", map[string]string{"identifier": phone, "password": password}, http.StatusOK, &resp)
+	return resp.Token
+}
+
+// admin creates an admin account and returns its ID and access token
+func (s *testServer) admin() (uint, string) {
+	s.t.Helper()
+
+	phone := s.newPhone()
+	user, err := s.repos.Users.CreateAdmin("Admin", "", phone, "secret123", "Head Office", models.Actor{Name: "test"})
+	if err != nil {
+		s.t.Fatalf("creating admin: %v", err)
+	}
+	return user.ID, s.login(phone, "secret123")
+}
+
+// retailer signs up a customer, has adminToken approve it and returns its ID
+// and access token
+func (s *testServer) retailer(adminToken string) (uint, string) {
+	s.t.Helper()
+
+	phone := s.newPhone()
+	var resp struct {
+		User models.UserResponse `json:"user"`
+	}
+	s.call(http.MethodPost, "/signup", "", map[string]string{
+		"name":      "Retailer " + phone,
+		"phone":     phone,
+		"password":  "secret123",
+		"firm_name": "Firm " + phone,
+		"city":      "Pune",
+	}, http.StatusCreated, &resp)
+	s.call(http.MethodPut, fmt.Sprintf("/users/%d/approve", resp.User.ID), adminToken, nil, http.StatusOK, nil)
+	return resp.User.ID, s.login(phone, "secret123")
+}
+
+// company creates a company and returns its ID
+func (s *testServer) company(adminToken, name string) uint {
+	s.t.Helper()
+
+	var company models.Company
+	s.call(http.MethodPost, "/companies", adminToken, map[string]string{"company_name": name}, http.StatusCreated, &company)
+	return company.ID
+}
+
+// medicine creates a medicine of a company and returns its ID
+func (s *testServer) medicine(adminToken string, companyID uint, name string, price float64) uint {
+	s.t.Helper()
+
+	var medicine models.Medicine
+	s.call(http.MethodPost, "/medicines", adminToken, map[string]interface{}{
+		"name":       name,
+		"company_id": companyID,
+		"price":      price,
+	}, http.StatusCreated, &medicine)
+	return medicine.ID
+}
+
+// setStock sets the tracked stock of a medicine
+func (s *testServer) setStock(adminToken string, medicineID uint, stock int) {
+	s.t.Helper()
+	s.call(http.MethodPut, fmt.Sprintf("/medicines/%d/stock", medicineID), adminToken, map[string]int{"stock": stock}, http.StatusOK, nil)
+}
+
+// stock returns the tracked stock of a medicine
+func (s *testServer) stock(medicineID uint) int {
+	s.t.Helper()
+
+	var medicine models.Medicine
+	if err := s.db.Unscoped().First(&medicine, medicineID).Error; err != nil {
+		s.t.Fatalf("loading medicine %d: %v", medicineID, err)
+	}
+	if medicine.Stock == nil {
+		s.t.Fatalf("medicine %d does not track stock", medicineID)
+	}
+	return *medicine.Stock
+}
+
+// order places an order for the items and returns it
+func (s *testServer) order(token string, items ...OrderItemInput) models.OrderRequest {
+	s.t.Helper()
+
+	var order models.OrderRequest
+	s.call(http.MethodPost, "/orders", token, map[string]interface{}{"items": items}, http.StatusOK, &order)
+	return order
+}
+
+// getOrder loads an order as the given user
+func (s *testServer) getOrder(token string, id uint) models.OrderRequest {
+	s.t.Helper()
+
+	var order models.OrderRequest
+	s.call(http.MethodGet, fmt.Sprintf("/orders/%d", id), token, nil, http.StatusOK, &order)
+	return order
+}
+
+// setStatus moves an order to a status as the given user
+func (s *testServer) setStatus(token string, id uint, status string, want int) {
+	s.t.Helper()
+	s.call(http.MethodPut, fmt.Sprintf("/orders/%d/status", id), token, map[string]string{"status": status}, want, nil)
+}
+
+// multipartBody is a request body already encoded as multipart/form-data
+type multipartBody struct {
+	body        io.Reader
+	contentType string
+}
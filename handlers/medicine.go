@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"pharmacy/config"
 	"pharmacy/models"
 	"strconv"
 
@@ -12,24 +13,33 @@ import (
 )
 
 // MedicineHandler holds the methods for CRUD operations on Medicine
-type MedicineHandler struct{}
+type MedicineHandler struct {
+	medicines models.MedicineRepo
+	upload    config.UploadConfig
+	auth      *models.AuthService
+}
 
 // NewMedicineHandler creates a new instance of the handler
-func NewMedicineHandler() *MedicineHandler {
-	return &MedicineHandler{}
+func NewMedicineHandler(medicines models.MedicineRepo, upload config.UploadConfig, auth *models.AuthService) *MedicineHandler {
+	return &MedicineHandler{medicines: medicines, upload: upload, auth: auth}
 }
 
 // CreateMedicine handles POST requests to create a new medicine
 func (h *MedicineHandler) CreateMedicine(c echo.Context) error {
-	var medicine models.Medicine
-	if err := c.Bind(&medicine); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid data"})
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	var req MedicineRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// Call the model's CreateMedicine function to insert the medicine
-	createdMedicine, err := models.CreateMedicine(medicine.Name, medicine.Description, medicine.CompanyID, medicine.UpdatedBy, medicine.Offer)
+	// Call the repository's Create function to insert the medicine
+	createdMedicine, err := h.medicines.Create(req.Name, req.Description, req.CompanyID, req.Price, req.Offer, actor)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not create medicine"})
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, createdMedicine)
@@ -37,20 +47,25 @@ func (h *MedicineHandler) CreateMedicine(c echo.Context) error {
 
 // UpdateMedicine handles PUT requests to update an existing medicine
 func (h *MedicineHandler) UpdateMedicine(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid medicine ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
 	}
 
-	var medicine models.Medicine
-	if err := c.Bind(&medicine); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid data"})
+	var req MedicineRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// Call the model's UpdateMedicine function to update the medicine
-	updatedMedicine, err := models.UpdateMedicine(uint(id), medicine.Name, medicine.Description, medicine.CompanyID, medicine.UpdatedBy, medicine.Offer)
+	// Call the repository's Update function to update the medicine
+	updatedMedicine, err := h.medicines.Update(uint(id), req.Name, req.Description, req.CompanyID, req.Price, req.Offer, actor)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not update medicine"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, updatedMedicine)
@@ -58,14 +73,19 @@ func (h *MedicineHandler) UpdateMedicine(c echo.Context) error {
 
 // DeleteMedicine handles DELETE requests to delete a medicine
 func (h *MedicineHandler) DeleteMedicine(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid medicine ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
 	}
 
-	// Call the model's DeleteMedicine function to delete the medicine
-	if err := models.DeleteMedicine(uint(id)); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not delete medicine"})
+	// Call the repository's Delete function to delete the medicine
+	if err := h.medicines.Delete(uint(id), actor); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Medicine deleted successfully"})
@@ -75,12 +95,58 @@ func (h *MedicineHandler) DeleteMedicine(c echo.Context) error {
 func (h *MedicineHandler) GetMedicine(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid medicine ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
 	}
 
-	medicine, err := models.GetMedicine(uint(id))
+	medicine, err := h.medicines.Get(uint(id))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not retrieve medicine"})
+		return err
+	}
+
+	return c.JSON(http.StatusOK, medicine)
+}
+
+// SetStock handles PUT requests to set the units available of a medicine
+// (admin only)
+func (h *MedicineHandler) SetStock(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
+	}
+
+	var req SetStockRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	medicine, err := h.medicines.SetStock(uint(id), req.Stock, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, medicine)
+}
+
+// RestoreMedicine handles POST requests to undo the deletion of a medicine
+func (h *MedicineHandler) RestoreMedicine(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid medicine ID")
+	}
+
+	medicine, err := h.medicines.Restore(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, medicine)
@@ -88,40 +154,55 @@ func (h *MedicineHandler) GetMedicine(c echo.Context) error {
 
 // GetAllMedicines handles GET requests to retrieve all medicines
 func (h *MedicineHandler) GetAllMedicines(c echo.Context) error {
-	medicines, err := models.GetAllMedicines()
+	withDeleted, err := includeDeleted(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	medicines, err := h.medicines.ListByCompany(withDeleted)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not retrieve medicines"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, medicines)
 }
 
 func (h *MedicineHandler) UploadMedicinesCSV(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
 	file, err := c.FormFile("file")
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "CSV file is required"})
+		return echo.NewHTTPError(http.StatusBadRequest, "CSV file is required")
+	}
+
+	if file.Size > h.upload.MaxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "CSV file is too large")
 	}
 
 	src, err := file.Open()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Cannot open uploaded file"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot open uploaded file")
 	}
 	defer src.Close()
 
-	tempPath := "/tmp/" + file.Filename
-	dst, err := os.Create(tempPath)
+	dst, err := os.CreateTemp(h.upload.Dir, "medicines-*.csv")
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Cannot save file"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot save file")
 	}
+	tempPath := dst.Name()
+	defer os.Remove(tempPath)
 	defer dst.Close()
 
 	if _, err := io.Copy(dst, src); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Cannot write file"})
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot write file")
 	}
 
-	// Pass to model logic
-	if err := models.InsertMedicinesFromCSV(tempPath, "admin_user"); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+	// Pass to repository logic
+	if err := h.medicines.ImportCSV(tempPath, actor); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Medicines uploaded successfully"})
@@ -129,33 +210,19 @@ func (h *MedicineHandler) UploadMedicinesCSV(c echo.Context) error {
 
 // UpdateOffer handles PUT requests to update offers for medicines
 func (h *MedicineHandler) UpdateOffer(c echo.Context) error {
-	var request struct {
-		MedicineID uint   `json:"medicine_id"`
-		CompanyID  uint   `json:"company_id"`
-		Offer      string `json:"offer"`
-		UpdatedBy  string `json:"updated_by"`
-	}
-
-	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid data"})
-	}
-
-	// Validate required fields
-	if request.CompanyID == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Company ID is required"})
-	}
-
-	if request.Offer == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Offer is required"})
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
 	}
 
-	if request.UpdatedBy == "" {
-		request.UpdatedBy = "system" // Default value
+	var request UpdateOfferRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
 	}
 
-	// Call the model function to update the offer
-	if err := models.UpdateOfferForMedicine(request.MedicineID, request.CompanyID, request.Offer, request.UpdatedBy); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not update offer"})
+	// Call the repository function to update the offer
+	if err := h.medicines.UpdateOffer(request.MedicineID, request.CompanyID, request.Offer, actor); err != nil {
+		return err
 	}
 
 	var message string
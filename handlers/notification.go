@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Page size limits for the notification history
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 500
+)
+
+// NotificationHandler serves users' notification history, channel
+// preferences and push devices, and lets admins edit the templates
+type NotificationHandler struct {
+	notifications models.NotificationRepo
+	auth          *models.AuthService
+}
+
+// NewNotificationHandler creates a new instance of the handler
+func NewNotificationHandler(notifications models.NotificationRepo, auth *models.AuthService) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications, auth: auth}
+}
+
+// GetMyNotifications lists the notifications sent to the caller, newest
+// first, optionally filtered by status (?status=)
+func (h *NotificationHandler) GetMyNotifications(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	return h.history(c, userID)
+}
+
+// GetUserNotifications lists the notifications sent to a user (admin only)
+func (h *NotificationHandler) GetUserNotifications(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	return h.history(c, uint(id))
+}
+
+// history responds with a user's notifications
+func (h *NotificationHandler) history(c echo.Context, userID uint) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		return models.NewValidationError("status", "must be one of: pending, delivered, failed")
+	}
+	limit, err := intParam(c, "limit", defaultNotificationLimit, 1, maxNotificationLimit)
+	if err != nil {
+		return err
+	}
+
+	notifications, err := h.notifications.History(userID, status, limit)
+	if err != nil {
+		return err
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	return c.JSON(http.StatusOK, notifications)
+}
+
+// GetPreferences returns the channels the caller is notified on for every event
+func (h *NotificationHandler) GetPreferences(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	channels, err := h.notifications.Preferences(userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"channels": channels})
+}
+
+// UpdatePreferences sets the channels the caller is notified on for the
+// given events. An empty list turns an event's notifications off.
+func (h *NotificationHandler) UpdatePreferences(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	var req UpdateNotificationPreferencesRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	for event, channels := range req.Channels {
+		if !isOneOf(event, models.NotificationEventTypes) {
+			return models.NewValidationError("channels", "events must be one of: "+strings.Join(models.NotificationEventTypes, ", "))
+		}
+		for _, channel := range channels {
+			if !isOneOf(channel, models.NotificationChannels) {
+				return models.NewValidationError("channels."+event, "must be one of: "+strings.Join(models.NotificationChannels, ", "))
+			}
+		}
+	}
+
+	channels, err := h.notifications.UpdatePreferences(userID, req.Channels)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"channels": channels})
+}
+
+// RegisterDevice registers a device of the caller for push notifications
+func (h *NotificationHandler) RegisterDevice(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	var req RegisterDeviceRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	device, err := h.notifications.RegisterDevice(userID, req.Token, req.Platform)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, device)
+}
+
+// GetDevices lists the caller's devices
+func (h *NotificationHandler) GetDevices(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	devices, err := h.notifications.Devices(userID)
+	if err != nil {
+		return err
+	}
+	if devices == nil {
+		devices = []models.UserDevice{}
+	}
+	return c.JSON(http.StatusOK, devices)
+}
+
+// RemoveDevice stops push notifications to one of the caller's devices
+func (h *NotificationHandler) RemoveDevice(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.notifications.RemoveDevice(userID, uint(id)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetTemplates lists the template of every event and channel
+func (h *NotificationHandler) GetTemplates(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	templates, err := h.notifications.Templates()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, templates)
+}
+
+// UpdateTemplate saves a custom template for an event and channel
+func (h *NotificationHandler) UpdateTemplate(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	event, channel, err := templateParams(c)
+	if err != nil {
+		return err
+	}
+	var req UpdateNotificationTemplateRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	template, err := h.notifications.UpdateTemplate(event, channel, req.Subject, req.Body, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, template)
+}
+
+// ResetTemplate goes back to the built-in template of an event and channel
+func (h *NotificationHandler) ResetTemplate(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	event, channel, err := templateParams(c)
+	if err != nil {
+		return err
+	}
+
+	template, err := h.notifications.ResetTemplate(event, channel, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, template)
+}
+
+// templateParams validates the :event and :channel path parameters
+func templateParams(c echo.Context) (string, string, error) {
+	event, channel := c.Param("event"), c.Param("channel")
+	if !isOneOf(event, models.NotificationEventTypes) {
+		return "", "", models.NewValidationError("event", "must be one of: "+strings.Join(models.NotificationEventTypes, ", "))
+	}
+	if !isOneOf(channel, models.NotificationChannels) {
+		return "", "", models.NewValidationError("channel", "must be one of: "+strings.Join(models.NotificationChannels, ", "))
+	}
+	return event, channel, nil
+}
+
+// isOneOf reports whether value is in allowed
+func isOneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
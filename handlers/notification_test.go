@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"pharmacy/config"
+	"pharmacy/models"
+	"testing"
+)
+
+// dispatchNotifications runs one round of the notification dispatcher with
+// only the SMS channel able to deliver
+func (s *testServer) dispatchNotifications(maxAttempts int) {
+	s.t.Helper()
+
+	cfg := config.Default().Notify
+	cfg.MaxAttempts = maxAttempts
+	notifiers := map[string]models.Notifier{models.ChannelSMS: models.SMSNotifier{Sender: s.sms}}
+	if err := models.NewNotificationDispatcher(s.db, cfg, notifiers).Dispatch(context.Background()); err != nil {
+		s.t.Fatalf("dispatching notifications: %v", err)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+
+	var prefs struct {
+		Channels map[string][]string `json:"channels"`
+	}
+	s.call(http.MethodGet, "/me/notification-preferences", token, nil, http.StatusOK, &prefs)
+	if got := prefs.Channels[models.EventOrderStatusChanged]; len(got) != 3 {
+		t.Fatalf("default channels = %v, want sms, email and push", got)
+	}
+
+	s.call(http.MethodPut, "/me/notification-preferences", token, map[string]interface{}{"channels": map[string][]string{}}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, "/me/notification-preferences", token, map[string]interface{}{"channels": map[string][]string{"order.deleted": {models.ChannelSMS}}}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, "/me/notification-preferences", token, map[string]interface{}{"channels": map[string][]string{models.EventOrderCreated: {"fax"}}}, http.StatusBadRequest, nil)
+
+	s.call(http.MethodPut, "/me/notification-preferences", token, map[string]interface{}{
+		"channels": map[string][]string{
+			models.EventOrderCreated:  {models.ChannelSMS},
+			models.EventOfferLaunched: {},
+		},
+	}, http.StatusOK, &prefs)
+	if got := prefs.Channels[models.EventOrderCreated]; len(got) != 1 || got[0] != models.ChannelSMS {
+		t.Fatalf("order.created channels = %v, want sms", got)
+	}
+	if got := prefs.Channels[models.EventOfferLaunched]; len(got) != 0 {
+		t.Fatalf("offer.launched channels = %v, want none", got)
+	}
+	if got := prefs.Channels[models.EventOrderStatusChanged]; len(got) != 3 {
+		t.Fatalf("order.status_changed channels = %v, want the defaults kept", got)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+
+	s.call(http.MethodPost, "/me/devices", token, map[string]string{"token": "device-token", "platform": "symbian"}, http.StatusBadRequest, nil)
+
+	var device models.UserDevice
+	s.call(http.MethodPost, "/me/devices", token, map[string]string{"token": "device-token", "platform": models.PlatformAndroid}, http.StatusCreated, &device)
+
+	// Signing in on the same device moves it to the new user
+	var moved models.UserDevice
+	s.call(http.MethodPost, "/me/devices", otherToken, map[string]string{"token": "device-token", "platform": models.PlatformAndroid}, http.StatusCreated, &moved)
+	if moved.ID != device.ID {
+		t.Fatalf("device = %+v, want device %d moved", moved, device.ID)
+	}
+
+	var devices []models.UserDevice
+	s.call(http.MethodGet, "/me/devices", token, nil, http.StatusOK, &devices)
+	if len(devices) != 0 {
+		t.Fatalf("devices = %+v, want none after the move", devices)
+	}
+	s.call(http.MethodGet, "/me/devices", otherToken, nil, http.StatusOK, &devices)
+	if len(devices) != 1 {
+		t.Fatalf("devices = %+v, want one", devices)
+	}
+
+	path := fmt.Sprintf("/me/devices/%d", device.ID)
+	s.call(http.MethodDelete, path, token, nil, http.StatusNotFound, nil)
+	s.call(http.MethodDelete, path, otherToken, nil, http.StatusNoContent, nil)
+	s.call(http.MethodDelete, path, otherToken, nil, http.StatusNotFound, nil)
+}
+
+func TestNotificationTemplates(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+
+	var templates []models.NotificationTemplate
+	s.call(http.MethodGet, "/notifications/templates", adminToken, nil, http.StatusOK, &templates)
+	if len(templates) != len(models.NotificationEventTypes)*len(models.NotificationChannels) {
+		t.Fatalf("got %d templates, want one per event and channel", len(templates))
+	}
+
+	path := "/notifications/templates/" + models.EventOrderCreated + "/" + models.ChannelSMS
+	s.call(http.MethodPut, "/notifications/templates/order.deleted/sms", adminToken, map[string]string{"body": "Hi"}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, "/notifications/templates/"+models.EventOrderCreated+"/fax", adminToken, map[string]string{"body": "Hi"}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, path, adminToken, map[string]string{"body": "Order {{.orderId"}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, path, adminToken, map[string]string{"body": "Order {{.medicineName}}"}, http.StatusBadRequest, nil)
+
+	var template models.NotificationTemplate
+	s.call(http.MethodPut, path, adminToken, map[string]string{"body": "Order #{{.orderId}} is in"}, http.StatusOK, &template)
+	if !template.Custom || template.Body != "Order #{{.orderId}} is in" {
+		t.Fatalf("template = %+v, want the custom body", template)
+	}
+
+	s.call(http.MethodDelete, path, adminToken, nil, http.StatusOK, &template)
+	if template.Custom {
+		t.Fatalf("template = %+v, want the built-in one back", template)
+	}
+	s.call(http.MethodDelete, path, adminToken, nil, http.StatusNotFound, nil)
+}
+
+func TestNotificationDelivery(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	userID, token := s.retailer(adminToken)
+	phone := fmt.Sprint(s.phone)
+	companyID, medicineID := s.catalog(adminToken)
+
+	s.call(http.MethodPost, "/me/devices", token, map[string]string{"token": "device-token", "platform": models.PlatformIOS}, http.StatusCreated, nil)
+	s.call(http.MethodPut, "/me/notification-preferences", token, map[string]interface{}{
+		"channels": map[string][]string{models.EventOrderCreated: {}},
+	}, http.StatusOK, nil)
+	s.call(http.MethodPut, "/notifications/templates/"+models.EventOrderStatusChanged+"/"+models.ChannelSMS, adminToken, map[string]string{
+		"body": "{{.firmName}}: order #{{.orderId}} is {{.status}}",
+	}, http.StatusOK, nil)
+
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 1})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK)
+	s.dispatchNotifications(1)
+
+	if want := fmt.Sprintf("Firm %s: order #%d is processing", phone, order.OrderID); s.sms.messages[phone] != want {
+		t.Fatalf("SMS = %q, want %q", s.sms.messages[phone], want)
+	}
+
+	// The user has no email address and push cannot be delivered here
+	var notifications []models.Notification
+	s.call(http.MethodGet, "/me/notifications", token, nil, http.StatusOK, &notifications)
+	if len(notifications) != 2 {
+		t.Fatalf("notifications = %+v, want an SMS and a push of the status change", notifications)
+	}
+	s.call(http.MethodGet, "/me/notifications?status=failed", token, nil, http.StatusOK, &notifications)
+	if len(notifications) != 1 || notifications[0].Channel != models.ChannelPush {
+		t.Fatalf("failed notifications = %+v, want the push", notifications)
+	}
+	s.call(http.MethodGet, "/me/notifications?status=sent", token, nil, http.StatusBadRequest, nil)
+
+	path := fmt.Sprintf("/users/%d/notifications?status=delivered", userID)
+	s.call(http.MethodGet, path, token, nil, http.StatusForbidden, nil)
+	s.call(http.MethodGet, path, adminToken, nil, http.StatusOK, &notifications)
+	if len(notifications) != 1 || notifications[0].Channel != models.ChannelSMS || notifications[0].SentAt == nil {
+		t.Fatalf("delivered notifications = %+v, want the SMS", notifications)
+	}
+}
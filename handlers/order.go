@@ -11,63 +11,76 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-type OrderHandler struct{}
+type OrderHandler struct {
+	orders  models.OrderRepo
+	updates models.OrderBroker
+	auth    *models.AuthService
+}
 
 // NewOrderHandler creates a new instance of the handler
-func NewOrderHandler() *OrderHandler {
-	return &OrderHandler{}
+func NewOrderHandler(orders models.OrderRepo, updates models.OrderBroker, auth *models.AuthService) *OrderHandler {
+	return &OrderHandler{orders: orders, updates: updates, auth: auth}
 }
 
 func (h *OrderHandler) CreateOrder(c echo.Context) error {
-	userID, _, err := GetUserFromHeader(c)
+	userID, _, err := GetUserFromHeader(c, h.auth)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": err.Error()})
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	var req models.OrderRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request"})
+	var req CreateOrderRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// ✅ Set userID from token
-	req.UserID = userID
-
-	order, err := models.CreateOrderWithItems(req, "api_user") // or fetch updatedBy from token
+	// The owner always comes from the token, never from the body
+	order, err := h.orders.Create(models.OrderRequest{
+		UserID:         userID,
+		Items:          orderItems(req.Items),
+		SplitByCompany: req.SplitByCompany,
+		Note:           strings.TrimSpace(req.Note),
+	}, models.UserActor(userID, c.RealIP()))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to create order"})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, order)
 }
 
 func (h *OrderHandler) GetOrder(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid ID"})
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	// Check if user is admin to include user details
-	_, isAdmin, err := GetUserFromHeader(c)
-	includeUserDetails := false
-	if err == nil && isAdmin {
-		includeUserDetails = true
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
 
-	order, err := models.GetOrderByIDWithUserDetails(uint(id), includeUserDetails)
+	// Admins also see the customer's details
+	order, err := h.orders.Get(uint(id), isAdmin)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "Order not found"})
+		return err
+	}
+	if !isAdmin && order.UserID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "You can only view your own orders")
 	}
 	return c.JSON(http.StatusOK, order)
 }
 
 func (h *OrderHandler) GetAllOrders(c echo.Context) error {
-	userID, isAdmin, err := GetUserFromHeader(c)
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": err.Error()})
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	withDeleted := c.QueryParam("include_deleted") == "true"
+	if withDeleted && !isAdmin {
+		return echo.NewHTTPError(http.StatusForbidden, "Admin access required")
 	}
-	orders, err := models.GetAllOrders(userID, isAdmin)
+	orders, err := h.orders.List(userID, isAdmin, withDeleted)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to fetch orders"})
+		return err
 	}
 	if orders == nil {
 		return c.JSON(http.StatusOK, []models.OrderRequest{})
@@ -75,76 +88,277 @@ func (h *OrderHandler) GetAllOrders(c echo.Context) error {
 	return c.JSON(http.StatusOK, orders)
 }
 
+// UpdateOrder replaces the items of an order. Customers can update their own
+// orders; admins any order.
 func (h *OrderHandler) UpdateOrder(c echo.Context) error {
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
 
-	var req models.OrderRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+	var req UpdateOrderRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	order, err := models.UpdateOrder(uint(id), req, "admin_user")
+	if !isAdmin {
+		existing, err := h.orders.Get(uint(id), false)
+		if err != nil {
+			return err
+		}
+		if existing.UserID != userID {
+			return echo.NewHTTPError(http.StatusForbidden, "You can only update your own orders")
+		}
+	}
+
+	order, err := h.orders.Update(uint(id), models.OrderRequest{Items: orderItems(req.Items)}, models.UserActor(userID, c.RealIP()))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update order"})
+		return err
 	}
 	return c.JSON(http.StatusOK, order)
 }
 
+// UpdateOrderStatus moves an order on to a later status. Only admins change
+// the status of orders, except that customers place their own drafts by
+// setting them to pending.
 func (h *OrderHandler) UpdateOrderStatus(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid ID"})
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	var req struct {
-		Status string `json:"status"`
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+
+	var req UpdateOrderStatusRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// Validate status values
-	validStatuses := []string{"pending", "processing", "shipped", "delivered", "cancelled"}
-	isValid := false
-	for _, validStatus := range validStatuses {
-		if req.Status == validStatus {
-			isValid = true
-			break
+	if !isAdmin {
+		existing, err := h.orders.Get(uint(id), false)
+		if err != nil {
+			return err
+		}
+		if existing.UserID != userID || existing.Status != models.OrderStatusDraft || req.Status != models.OrderStatusPending {
+			return echo.NewHTTPError(http.StatusForbidden, "Only admins can change the status of orders; customers can only place their own drafts")
 		}
 	}
-	if !isValid {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid status. Valid statuses are: pending, processing, shipped, delivered, cancelled"})
+
+	order, err := h.orders.UpdateStatus(uint(id), req.Status, models.UserActor(userID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, order)
+}
+
+// DeleteOrder soft-deletes an order (admin only)
+func (h *OrderHandler) DeleteOrder(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.orders.Delete(uint(id), models.UserActor(adminID, c.RealIP())); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Order deleted successfully"})
+}
+
+// RestoreOrder undoes the deletion of an order (admin only)
+func (h *OrderHandler) RestoreOrder(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
 	}
 
-	userID, _, err := GetUserFromHeader(c)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": err.Error()})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
+	order, err := h.orders.Restore(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
+}
 
-	updatedBy := "user_" + strconv.Itoa(int(userID))
-	order, err := models.UpdateOrderStatus(uint(id), req.Status, updatedBy)
+// SplitOrder splits an order into one child order per company, each with its
+// own status (admin only)
+func (h *OrderHandler) SplitOrder(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update order status"})
+		return err
 	}
 
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	order, err := h.orders.Split(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
 	return c.JSON(http.StatusOK, order)
 }
 
-func (h *OrderHandler) DeleteOrder(c echo.Context) error {
+// FulfilOrder records the shipment of an order, line by line, and puts the
+// units that were not shipped or cancelled on a backorder (admin only)
+func (h *OrderHandler) FulfilOrder(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid ID"})
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
 	}
-	if err := models.DeleteOrder(uint(id)); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to delete order"})
+
+	var req FulfilOrderRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
-	return c.JSON(http.StatusOK, map[string]string{"message": "Order deleted successfully"})
+
+	fulfilments := make([]models.Fulfilment, 0, len(req.Items))
+	for _, item := range req.Items {
+		fulfilments = append(fulfilments, models.Fulfilment{
+			MedicineID: item.MedicineID,
+			Fulfilled:  item.Fulfilled,
+			Cancelled:  item.Cancelled,
+		})
+	}
+
+	order, err := h.orders.Fulfil(uint(id), fulfilments, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
 }
 
-func GetUserFromToken(c echo.Context) (uint, bool, error) {
+// CancelOrder cancels an order for a reason. Customers can cancel their own
+// orders until they are processed; admins can cancel orders until they are
+// shipped, and orders that are being processed once another admin approves.
+func (h *OrderHandler) CancelOrder(c echo.Context) error {
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	var req CancelOrderRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	if req.Reason == models.CancelReasonOther && strings.TrimSpace(req.Note) == "" {
+		return models.NewValidationError("note", "is required when the reason is other")
+	}
+
+	order, err := h.orders.Cancel(uint(id), req.Reason, strings.TrimSpace(req.Note), isAdmin, models.UserActor(userID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	if order.Cancellation != nil && order.Cancellation.Status == models.CancellationRequested {
+		return c.JSON(http.StatusAccepted, order)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// ApproveCancellation cancels an order whose cancellation another admin
+// requested (admin only)
+func (h *OrderHandler) ApproveCancellation(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	order, err := h.orders.ApproveCancellation(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// RejectCancellation withdraws a cancellation that is waiting for approval
+// (admin only)
+func (h *OrderHandler) RejectCancellation(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	order, err := h.orders.RejectCancellation(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// AddOrderNote adds a note to an order. Customers can add notes to their
+// own orders; admins to any order.
+func (h *OrderHandler) AddOrderNote(c echo.Context) error {
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	var req AddOrderNoteRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return models.NewValidationError("body", "is required")
+	}
+
+	if !isAdmin {
+		order, err := h.orders.Get(uint(id), false)
+		if err != nil {
+			return err
+		}
+		if order.UserID != userID {
+			return echo.NewHTTPError(http.StatusForbidden, "You can only add notes to your own orders")
+		}
+	}
+
+	note, err := h.orders.AddNote(uint(id), body, models.UserActor(userID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, note)
+}
+
+func GetUserFromToken(c echo.Context, auth *models.AuthService) (uint, bool, error) {
 	userToken, ok := c.Get("token").(*jwt.Token)
 	if !ok {
 		return 0, false, errors.New("invalid token format")
@@ -155,6 +369,10 @@ func GetUserFromToken(c echo.Context) (uint, bool, error) {
 		return 0, false, errors.New("invalid JWT claims")
 	}
 
+	if err := auth.CheckSessionClaims(claims); err != nil {
+		return 0, false, errors.New("session has been revoked")
+	}
+
 	userIDFloat, ok := claims["userId"].(float64)
 	if !ok {
 		return 0, false, errors.New("userId not found in token")
@@ -168,33 +386,10 @@ func GetUserFromToken(c echo.Context) (uint, bool, error) {
 	return uint(userIDFloat), isAdmin, nil
 }
 
-func GetUserFromHeader(c echo.Context) (uint, bool, error) {
-	authHeader := c.Request().Header.Get("Authorization")
-	if authHeader == "" {
-		return 0, false, errors.New("Authorization header missing")
-	}
-
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		return 0, false, errors.New("Invalid Authorization format")
-	}
-
-	tokenString := parts[1]
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("Unexpected signing method")
-		}
-		return []byte("RaghavSureka"), nil
-	})
-	if err != nil || !token.Valid {
-		return 0, false, errors.New("Invalid or expired token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, false, errors.New("Invalid token claims")
+func GetUserFromHeader(c echo.Context, auth *models.AuthService) (uint, bool, error) {
+	claims, err := getClaimsFromHeader(c, auth)
+	if err != nil {
+		return 0, false, err
 	}
 
 	userIDFloat, ok := claims["userId"].(float64)
@@ -209,3 +404,26 @@ func GetUserFromHeader(c echo.Context) (uint, bool, error) {
 
 	return uint(userIDFloat), isAdmin, nil
 }
+
+// getClaimsFromHeader parses the bearer token and checks that its session has not been revoked
+func getClaimsFromHeader(c echo.Context, auth *models.AuthService) (jwt.MapClaims, error) {
+	authHeader := c.Request().Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errors.New("Authorization header missing")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, errors.New("Invalid Authorization format")
+	}
+
+	claims, err := auth.ParseAccessToken(parts[1])
+	if errors.Is(err, models.ErrSessionRevoked) {
+		return nil, errors.New("Session has been revoked, please log in again")
+	}
+	if err != nil {
+		return nil, errors.New("Invalid or expired token")
+	}
+
+	return claims, nil
+}
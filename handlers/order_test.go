@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+// catalog creates a company with one medicine and returns their IDs
+func (s *testServer) catalog(adminToken string) (companyID, medicineID uint) {
+	s.t.Helper()
+
+	companyID = s.company(adminToken, "Cipla")
+	return companyID, s.medicine(adminToken, companyID, "Paracetamol", 10)
+}
+
+func TestCreateAndGetOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	userID, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+
+	s.call(http.MethodPost, "/orders", token, map[string]interface{}{"items": []OrderItemInput{}}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/orders", token, map[string]interface{}{
+		"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: companyID, Quantity: 0}},
+	}, http.StatusBadRequest, nil)
+
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+	if order.UserID != userID || order.Status != models.OrderStatusPending {
+		t.Fatalf("order = %+v, want a pending order of user %d", order, userID)
+	}
+	if len(order.Items) != 1 || order.Items[0].UnitPrice != 10 {
+		t.Fatalf("items = %+v, want one item at the medicine price", order.Items)
+	}
+
+	if got := s.getOrder(adminToken, order.OrderID); got.UserDetails == nil {
+		t.Fatal("admins do not see the customer of an order")
+	}
+	if got := s.getOrder(token, order.OrderID); got.UserDetails != nil {
+		t.Fatal("customers see the customer details of orders")
+	}
+	s.call(http.MethodGet, fmt.Sprintf("/orders/%d", order.OrderID), otherToken, nil, http.StatusForbidden, nil)
+	s.call(http.MethodGet, fmt.Sprintf("/orders/%d", order.OrderID), "", nil, http.StatusUnauthorized, nil)
+
+	var orders []models.OrderRequest
+	s.call(http.MethodGet, "/orders", token, nil, http.StatusOK, &orders)
+	if len(orders) != 1 {
+		t.Fatalf("orders of the customer = %+v, want one", orders)
+	}
+	s.call(http.MethodGet, "/orders", otherToken, nil, http.StatusOK, &orders)
+	if len(orders) != 0 {
+		t.Fatalf("orders of another customer = %+v, want none", orders)
+	}
+	s.call(http.MethodGet, "/orders", adminToken, nil, http.StatusOK, &orders)
+	if len(orders) != 1 {
+		t.Fatalf("orders seen by admins = %+v, want one", orders)
+	}
+}
+
+func TestCreateOrderRejectsWrongCompany(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, medicineID := s.catalog(adminToken)
+	otherCompanyID := s.company(adminToken, "Sun Pharma")
+
+	s.call(http.MethodPost, "/orders", token, map[string]interface{}{
+		"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: otherCompanyID, Quantity: 1}},
+	}, http.StatusBadRequest, nil)
+}
+
+func TestUpdateOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+
+	path := fmt.Sprintf("/orders/%d", order.OrderID)
+	update := map[string]interface{}{"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: companyID, Quantity: 5}}}
+	s.call(http.MethodPut, path, otherToken, update, http.StatusForbidden, nil)
+
+	var updated models.OrderRequest
+	s.call(http.MethodPut, path, token, update, http.StatusOK, &updated)
+	if len(updated.Items) != 1 || updated.Items[0].Quantity != 5 {
+		t.Fatalf("updated items = %+v, want quantity 5", updated.Items)
+	}
+	s.call(http.MethodPut, "/orders/999", adminToken, update, http.StatusNotFound, nil)
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+
+	s.setStatus(token, order.OrderID, models.OrderStatusShipped, http.StatusForbidden)
+	s.setStatus(adminToken, order.OrderID, "lost", http.StatusBadRequest)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusPending, http.StatusConflict)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusShipped, http.StatusOK)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusConflict)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusDelivered, http.StatusOK)
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusShipped, http.StatusConflict)
+
+	if got := s.getOrder(token, order.OrderID); got.Status != models.OrderStatusDelivered {
+		t.Fatalf("status = %q, want delivered", got.Status)
+	}
+}
+
+func TestDeleteAndRestoreOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+
+	path := fmt.Sprintf("/orders/%d", order.OrderID)
+	s.call(http.MethodDelete, path, token, nil, http.StatusForbidden, nil)
+	s.call(http.MethodDelete, path, adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, path, token, nil, http.StatusNotFound, nil)
+
+	var orders []models.OrderRequest
+	s.call(http.MethodGet, "/orders?include_deleted=true", token, nil, http.StatusForbidden, nil)
+	s.call(http.MethodGet, "/orders?include_deleted=true", adminToken, nil, http.StatusOK, &orders)
+	if len(orders) != 1 || !orders[0].Deleted {
+		t.Fatalf("orders with deleted = %+v, want the deleted order", orders)
+	}
+
+	s.call(http.MethodPost, path+"/restore", adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, path, token, nil, http.StatusOK, nil)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pharmacy/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequestOTP sends a one-time login code to the given phone number
+func (h *UserHandler) RequestOTP(c echo.Context) error {
+	var request RequestOTPRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	if err := h.auth.RequestOTP(request.Phone); err != nil {
+		if errors.Is(err, models.ErrOTPRateLimited) {
+			return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+		}
+		return err
+	}
+
+	// The same response is returned whether or not the phone is registered
+	return c.JSON(http.StatusOK, map[string]string{"message": "If the phone number is registered, an OTP has been sent"})
+}
+
+// VerifyOTP exchanges a valid one-time code for a JWT
+func (h *UserHandler) VerifyOTP(c echo.Context) error {
+	var request VerifyOTPRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	tokens, user, err := h.auth.VerifyOTP(request.Phone, request.OTP)
+	if statusErr := accountStatusError(user, err); statusErr != nil {
+		return statusErr
+	}
+	if errors.Is(err, models.ErrOTPInvalid) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired OTP")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, authResponse(tokens, user))
+}
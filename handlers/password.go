@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pharmacy/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ChangePassword changes the caller's password after verifying the old one.
+// The caller's other sessions are logged out.
+func (h *UserHandler) ChangePassword(c echo.Context) error {
+	claims, err := getClaimsFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	var request ChangePasswordRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	userID, _ := claims["userId"].(float64)
+	sid, _ := claims["sid"].(float64)
+	err = h.auth.ChangePassword(models.UserActor(uint(userID), c.RealIP()), uint(sid), request.OldPassword, request.NewPassword)
+	switch {
+	case errors.Is(err, models.ErrIncorrectPassword):
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	case err != nil:
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Password changed successfully"})
+}
+
+// ForgotPassword sends a one-time password reset token to the user
+func (h *UserHandler) ForgotPassword(c echo.Context) error {
+	var request ForgotPasswordRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	if err := h.auth.RequestPasswordReset(request.Phone); err != nil {
+		if errors.Is(err, models.ErrResetRateLimited) {
+			return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+		}
+		return err
+	}
+
+	// The same response is returned whether or not the phone is registered
+	return c.JSON(http.StatusOK, map[string]string{"message": "If the phone number is registered, a reset token has been sent"})
+}
+
+// ResetPassword sets a new password using a reset token and logs the user out everywhere
+func (h *UserHandler) ResetPassword(c echo.Context) error {
+	var request ResetPasswordRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	err := h.auth.ResetPassword(request.Token, request.NewPassword, models.Actor{IP: c.RealIP()})
+	switch {
+	case errors.Is(err, models.ErrInvalidResetToken):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case err != nil:
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Password reset successfully. Please log in again."})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Defaults and limits for reorder suggestions, in days
+const (
+	defaultReorderLookback  = 180
+	maxReorderLookback      = 730
+	defaultReorderDueWithin = 7
+	maxReorderDueWithin     = 90
+)
+
+// GetReorderSuggestions lists the medicines the caller orders regularly, with
+// their usual quantity and the expected date of the next order
+func (h *OrderHandler) GetReorderSuggestions(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	query, err := reorderQuery(c, userID)
+	if err != nil {
+		return err
+	}
+
+	suggestions, err := h.orders.ReorderSuggestions(query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, suggestions)
+}
+
+// CreateReorderDraft turns the caller's reorder suggestions into a draft
+// order with the usual quantities. The customer reviews it with PUT
+// /orders/:id and places it by setting its status to pending.
+func (h *OrderHandler) CreateReorderDraft(c echo.Context) error {
+	userID, _, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	query, err := reorderQuery(c, userID)
+	if err != nil {
+		return err
+	}
+
+	var req ReorderDraftRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	suggestions, err := h.orders.ReorderSuggestions(query)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[uint]bool, len(req.MedicineIDs))
+	for _, id := range req.MedicineIDs {
+		selected[id] = true
+	}
+
+	var items []models.OrderItemRequest
+	for _, suggestion := range suggestions {
+		if len(selected) > 0 && !selected[suggestion.MedicineID] || len(selected) == 0 && !suggestion.Due {
+			continue
+		}
+		items = append(items, models.OrderItemRequest{
+			MedicineID: suggestion.MedicineID,
+			CompanyID:  suggestion.CompanyID,
+			Quantity:   suggestion.UsualQuantity,
+		})
+	}
+	if len(items) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "No reorder suggestions to add to a draft order")
+	}
+
+	order, err := h.orders.Create(models.OrderRequest{UserID: userID, Status: models.OrderStatusDraft, Items: items}, models.UserActor(userID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, order)
+}
+
+// ReorderOrder copies the items of one of the caller's past orders into a new
+// pending order, or into their cart with ?to=cart, and reports the items that
+// were dropped or changed in price or offer since
+func (h *OrderHandler) ReorderOrder(c echo.Context) error {
+	actor, err := requireActor(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	var toCart bool
+	switch c.QueryParam("to") {
+	case "", "order":
+	case "cart":
+		toCart = true
+	default:
+		return models.NewValidationError("to", "must be one of: order, cart")
+	}
+
+	result, err := h.orders.Reorder(uint(id), actor.UserID, toCart, actor)
+	if err != nil {
+		return err
+	}
+
+	if toCart {
+		return c.JSON(http.StatusOK, result)
+	}
+	return c.JSON(http.StatusCreated, result)
+}
+
+// reorderQuery reads the lookback (?days=), due horizon (?due_within=) and
+// minimum number of orders (?min_orders=) from the query string
+func reorderQuery(c echo.Context, userID uint) (models.ReorderQuery, error) {
+	lookback, err := intParam(c, "days", defaultReorderLookback, 1, maxReorderLookback)
+	if err != nil {
+		return models.ReorderQuery{}, err
+	}
+	dueWithin, err := intParam(c, "due_within", defaultReorderDueWithin, 0, maxReorderDueWithin)
+	if err != nil {
+		return models.ReorderQuery{}, err
+	}
+	minOrders, err := intParam(c, "min_orders", 2, 2, 100)
+	if err != nil {
+		return models.ReorderQuery{}, err
+	}
+
+	now := time.Now()
+	return models.ReorderQuery{
+		UserID:    userID,
+		Since:     now.AddDate(0, 0, -lookback),
+		MinOrders: minOrders,
+		DueBefore: now.AddDate(0, 0, dueWithin),
+	}, nil
+}
+
+// intParam parses an optional integer query parameter within [min, max]
+func intParam(c echo.Context, name string, fallback, min, max int) (int, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(param)
+	if err != nil || n < min || n > max {
+		return 0, models.NewValidationError(name, "must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+func TestReorderSuggestions(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+
+	s.call(http.MethodPost, "/me/reorder-suggestions/draft", token, map[string]interface{}{}, http.StatusBadRequest, nil)
+
+	s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+	s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 4})
+
+	var suggestions []models.ReorderSuggestion
+	s.call(http.MethodGet, "/me/reorder-suggestions?days=0", token, nil, http.StatusBadRequest, nil)
+	s.call(http.MethodGet, "/me/reorder-suggestions", token, nil, http.StatusOK, &suggestions)
+	if len(suggestions) != 1 || suggestions[0].UsualQuantity != 4 || !suggestions[0].Due {
+		t.Fatalf("suggestions = %+v, want one due suggestion of 4 units", suggestions)
+	}
+
+	var draft models.OrderRequest
+	s.call(http.MethodPost, "/me/reorder-suggestions/draft", token, map[string]interface{}{}, http.StatusCreated, &draft)
+	if draft.Status != models.OrderStatusDraft || len(draft.Items) != 1 {
+		t.Fatalf("draft = %+v", draft)
+	}
+
+	// The customer places the draft themselves
+	s.setStatus(token, draft.OrderID, models.OrderStatusPending, http.StatusOK)
+	s.setStatus(token, draft.OrderID, models.OrderStatusProcessing, http.StatusForbidden)
+}
+
+func TestReorderOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	dropped := s.medicine(adminToken, companyID, "Discontinued", 5)
+	order := s.order(token,
+		OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3},
+		OrderItemInput{MedicineID: dropped, CompanyID: companyID, Quantity: 1})
+
+	s.call(http.MethodPut, fmt.Sprintf("/medicines/%d", medicineID), adminToken, map[string]interface{}{"name": "Paracetamol", "company_id": companyID, "price": 12}, http.StatusOK, nil)
+	s.call(http.MethodDelete, fmt.Sprintf("/medicines/%d", dropped), adminToken, nil, http.StatusOK, nil)
+
+	path := fmt.Sprintf("/orders/%d/reorder", order.OrderID)
+	s.call(http.MethodPost, path, otherToken, nil, http.StatusForbidden, nil)
+	s.call(http.MethodPost, path+"?to=elsewhere", token, nil, http.StatusBadRequest, nil)
+
+	var result models.ReorderResult
+	s.call(http.MethodPost, path, token, nil, http.StatusCreated, &result)
+	if result.Order == nil || len(result.Order.Items) != 1 || result.Order.Items[0].UnitPrice != 12 {
+		t.Fatalf("reorder = %+v, want one item at the new price", result.Order)
+	}
+	if len(result.Dropped) != 1 || result.Dropped[0].MedicineID != dropped {
+		t.Fatalf("dropped = %+v, want the deleted medicine", result.Dropped)
+	}
+	if len(result.Changed) != 1 || result.Changed[0].PreviousPrice != 10 {
+		t.Fatalf("changed = %+v, want the repriced medicine", result.Changed)
+	}
+
+	s.call(http.MethodPost, path+"?to=cart", token, nil, http.StatusOK, &result)
+	if result.Cart == nil || len(result.Cart.Items) != 1 {
+		t.Fatalf("cart after reorder = %+v", result.Cart)
+	}
+}
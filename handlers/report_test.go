@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 2})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK)
+
+	s.call(http.MethodGet, "/audit?entity=invoice", adminToken, nil, http.StatusBadRequest, nil)
+	s.call(http.MethodGet, "/audit?limit=0", adminToken, nil, http.StatusBadRequest, nil)
+
+	// The snapshots are left out; only the rows matter here
+	var entries []struct {
+		EntityType string `json:"entity_type"`
+		EntityID   uint   `json:"entity_id"`
+		Action     string `json:"action"`
+	}
+	s.call(http.MethodGet, fmt.Sprintf("/audit?entity=order&id=%d", order.OrderID), adminToken, nil, http.StatusOK, &entries)
+	if len(entries) != 2 {
+		t.Fatalf("audit of the order = %+v, want its creation and status change", entries)
+	}
+	for _, entry := range entries {
+		if entry.EntityType != models.AuditEntityOrder || entry.EntityID != order.OrderID {
+			t.Errorf("entry %+v is not about order %d", entry, order.OrderID)
+		}
+	}
+
+	s.call(http.MethodGet, "/audit?entity=company", adminToken, nil, http.StatusOK, &entries)
+	if len(entries) != 1 || entries[0].EntityID != companyID {
+		t.Fatalf("audit of companies = %+v, want the creation of company %d", entries, companyID)
+	}
+}
+
+func TestSalesReport(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 2})
+	s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 3})
+
+	s.call(http.MethodGet, "/analytics/sales?group_by=region", adminToken, nil, http.StatusBadRequest, nil)
+	s.call(http.MethodGet, "/analytics/sales?from=2024-02-01&to=2024-01-01", adminToken, nil, http.StatusBadRequest, nil)
+
+	var report models.SalesReport
+	s.call(http.MethodGet, "/analytics/sales?group_by=medicine", adminToken, nil, http.StatusOK, &report)
+	if report.Totals.Quantity != 5 || report.Totals.Value != 50 || report.Totals.Orders != 2 {
+		t.Fatalf("totals = %+v, want 5 units worth 50 in 2 orders", report.Totals.SalesFigures)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].ID != medicineID {
+		t.Fatalf("rows = %+v, want one row for medicine %d", report.Rows, medicineID)
+	}
+}
+
+func TestOfferReport(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "medicine_id": medicineID, "offer": "10+1"}, http.StatusOK, nil)
+
+	var order models.OrderRequest
+	s.call(http.MethodPost, "/orders", token, map[string]interface{}{
+		"items": []OrderItemInput{{MedicineID: medicineID, CompanyID: companyID, Quantity: 20}},
+	}, http.StatusOK, &order)
+	if order.Items[0].Offer != "10+1" || order.Items[0].FreeQuantity != 2 {
+		t.Fatalf("item = %+v, want 2 free units under 10+1", order.Items[0])
+	}
+
+	s.call(http.MethodGet, "/analytics/offers?medicine_id=x", adminToken, nil, http.StatusBadRequest, nil)
+
+	var report []models.OfferEffectiveness
+	s.call(http.MethodGet, fmt.Sprintf("/analytics/offers?medicine_id=%d", medicineID), adminToken, nil, http.StatusOK, &report)
+	if len(report) != 1 || !report[0].Active || report[0].During.Quantity != 20 {
+		t.Fatalf("offer report = %+v, want the active offer with 20 units ordered", report)
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import "pharmacy/models"
+
+// Request bodies accepted by the API. Handlers bind into these instead of the
+// GORM models so clients can only set the fields listed here; the validate
+// tags are checked by RequestValidator.
+
+// SignUpRequest is the body of POST /signup
+type SignUpRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"omitempty,email,max=254"`
+	Phone    string `json:"phone" validate:"required,phone"`
+	Password string `json:"password" validate:"required,min=6,max=72"`
+	FirmName string `json:"firm_name" validate:"max=200"`
+	City     string `json:"city" validate:"max=100"`
+}
+
+// UpdateUserRequest is the body of PUT /user/:id
+type UpdateUserRequest struct {
+	Name     string  `json:"name" validate:"required,max=100"`
+	Phone    string  `json:"phone" validate:"required,phone"`
+	FirmName string  `json:"firm_name" validate:"max=200"`
+	City     string  `json:"city" validate:"max=100"`
+	Tier     *string `json:"tier" validate:"omitempty,max=50"` // Left unchanged when omitted
+	IsAdmin  *bool   `json:"is_admin"`                         // Left unchanged when omitted
+}
+
+// AuthenticateRequest is the body of POST /authenticate
+type AuthenticateRequest struct {
+	Identifier string `json:"identifier" validate:"required"` // Email or Phone
+	Password   string `json:"password" validate:"required"`
+}
+
+// RequestOTPRequest is the body of POST /auth/otp/request
+type RequestOTPRequest struct {
+	Phone string `json:"phone" validate:"required"`
+}
+
+// VerifyOTPRequest is the body of POST /auth/otp/verify
+type VerifyOTPRequest struct {
+	Phone string `json:"phone" validate:"required"`
+	OTP   string `json:"otp" validate:"required,len=6,numeric"`
+}
+
+// RefreshTokenRequest is the body of POST /auth/refresh
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// ChangePasswordRequest is the body of POST /auth/password/change
+type ChangePasswordRequest struct {
+	OldPassword string `json:"oldPassword" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,min=6,max=72"`
+}
+
+// ForgotPasswordRequest is the body of POST /auth/password/forgot
+type ForgotPasswordRequest struct {
+	Phone string `json:"phone" validate:"required"`
+}
+
+// ResetPasswordRequest is the body of POST /auth/password/reset
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,min=6,max=72"`
+}
+
+// RejectUserRequest is the body of PUT /users/:id/reject
+type RejectUserRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// CompanyRequest is the body of POST /companies and PUT /companies/:id
+type CompanyRequest struct {
+	CompanyName string `json:"company_name" validate:"required,max=200"`
+	Description string `json:"description" validate:"max=2000"`
+	LogoUrl     string `json:"logo_url" validate:"omitempty,url,max=500"`
+}
+
+// MedicineRequest is the body of POST /medicines and PUT /medicines/:id
+type MedicineRequest struct {
+	Name        string  `json:"name" validate:"required,max=200"`
+	Description string  `json:"description" validate:"max=2000"`
+	CompanyID   uint    `json:"company_id" validate:"required"`
+	Price       float64 `json:"price" validate:"min=0"`
+	Offer       string  `json:"offer" validate:"max=500"`
+}
+
+// UpdateOfferRequest is the body of PUT /medicines/offer. A zero medicine_id
+// applies the offer to every medicine of the company.
+type UpdateOfferRequest struct {
+	MedicineID uint   `json:"medicine_id"`
+	CompanyID  uint   `json:"company_id" validate:"required"`
+	Offer      string `json:"offer" validate:"required,max=500"`
+}
+
+// SetStockRequest is the body of PUT /medicines/:id/stock. A null stock
+// stops tracking the medicine's stock.
+type SetStockRequest struct {
+	Stock *int `json:"stock" validate:"omitempty,min=0"`
+}
+
+// OrderItemInput is one line of an order request
+type OrderItemInput struct {
+	MedicineID uint `json:"medicineId" validate:"required"`
+	CompanyID  uint `json:"companyId" validate:"required"`
+	Quantity   int  `json:"quantity" validate:"gt=0,max=100000"`
+}
+
+// CreateOrderRequest is the body of POST /orders. With SplitByCompany the
+// order is split into one child order per company. Note is added to the
+// order's notes.
+type CreateOrderRequest struct {
+	Items          []OrderItemInput `json:"items" validate:"required,min=1,max=500,dive"`
+	SplitByCompany bool             `json:"splitByCompany"`
+	Note           string           `json:"note" validate:"max=1000"`
+}
+
+// UpdateOrderRequest is the body of PUT /orders/:id
+type UpdateOrderRequest struct {
+	Items []OrderItemInput `json:"items" validate:"required,min=1,max=500,dive"`
+}
+
+// AddCartItemRequest is the body of POST /cart/items
+type AddCartItemRequest struct {
+	MedicineID uint `json:"medicineId" validate:"required"`
+	Quantity   int  `json:"quantity" validate:"gt=0,max=100000"`
+}
+
+// SetCartItemRequest is the body of PUT /cart/items/:medicineId
+type SetCartItemRequest struct {
+	Quantity int `json:"quantity" validate:"gt=0,max=100000"`
+}
+
+// ReorderDraftRequest is the body of POST /me/reorder-suggestions/draft. An
+// empty list orders every suggestion that is due.
+type ReorderDraftRequest struct {
+	MedicineIDs []uint `json:"medicineIds" validate:"max=500,dive,required"`
+}
+
+// FulfilOrderRequest is the body of POST /orders/:id/fulfilment. Medicines
+// that are not listed are shipped in full.
+type FulfilOrderRequest struct {
+	Items []FulfilItemInput `json:"items" validate:"max=500,dive"`
+}
+
+// FulfilItemInput is the number of units of a medicine shipped and cancelled.
+// The remaining units are backordered.
+type FulfilItemInput struct {
+	MedicineID uint `json:"medicineId" validate:"required"`
+	Fulfilled  int  `json:"fulfilled" validate:"min=0,max=100000"`
+	Cancelled  int  `json:"cancelled" validate:"min=0,max=100000"`
+}
+
+// CancelOrderRequest is the body of POST /orders/:id/cancel. A note is
+// required for the reason "other".
+type CancelOrderRequest struct {
+	Reason string `json:"reason" validate:"required,oneof=customer_request duplicate_order out_of_stock pricing_error payment_issue other"`
+	Note   string `json:"note" validate:"max=500"`
+}
+
+// AddOrderNoteRequest is the body of POST /orders/:id/notes
+type AddOrderNoteRequest struct {
+	Body string `json:"body" validate:"required,max=1000"`
+}
+
+// UpdateOrderStatusRequest is the body of PUT /orders/:id/status
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending processing shipped delivered"`
+}
+
+// CreateWebhookRequest is the body of POST /webhooks
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,http_url,max=500"`
+	Description string   `json:"description" validate:"max=200"`
+	Events      []string `json:"events" validate:"required,min=1,max=10,dive,oneof=order.created order.status_changed medicine.updated offer.changed"`
+}
+
+// UpdateWebhookRequest is the body of PUT /webhooks/:id
+type UpdateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,http_url,max=500"`
+	Description string   `json:"description" validate:"max=200"`
+	Events      []string `json:"events" validate:"required,min=1,max=10,dive,oneof=order.created order.status_changed medicine.updated offer.changed"`
+	Active      *bool    `json:"active" validate:"required"`
+}
+
+// UpdateNotificationTemplateRequest is the body of
+// PUT /notifications/templates/:event/:channel
+type UpdateNotificationTemplateRequest struct {
+	Subject string `json:"subject" validate:"max=200"`
+	Body    string `json:"body" validate:"required,max=2000"`
+}
+
+// UpdateNotificationPreferencesRequest is the body of
+// PUT /me/notification-preferences: the channels to use for each event
+type UpdateNotificationPreferencesRequest struct {
+	Channels map[string][]string `json:"channels" validate:"required,min=1"`
+}
+
+// RegisterDeviceRequest is the body of POST /me/devices
+type RegisterDeviceRequest struct {
+	Token    string `json:"token" validate:"required,max=4096"`
+	Platform string `json:"platform" validate:"required,oneof=android ios web"`
+}
+
+// orderItems converts the request lines into the models representation
+func orderItems(inputs []OrderItemInput) []models.OrderItemRequest {
+	items := make([]models.OrderItemRequest, 0, len(inputs))
+	for _, input := range inputs {
+		items = append(items, models.OrderItemRequest{
+			MedicineID: input.MedicineID,
+			CompanyID:  input.CompanyID,
+			Quantity:   input.Quantity,
+		})
+	}
+	return items
+}
+
+// CampaignRequest is the body of POST /campaigns and PUT /campaigns/:id. The
+// company and offer default to those of the medicine.
+type CampaignRequest struct {
+	Name            string   `json:"name" validate:"required,max=100"`
+	CompanyID       uint     `json:"company_id"`
+	MedicineID      *uint    `json:"medicine_id" validate:"omitempty,gt=0"`
+	Offer           string   `json:"offer" validate:"max=500"`
+	Subject         string   `json:"subject" validate:"max=200"`
+	Body            string   `json:"body" validate:"max=2000"`
+	Channels        []string `json:"channels" validate:"max=3,dive,oneof=sms email push"`
+	Cities          []string `json:"cities" validate:"max=50,dive,required,max=100"`
+	Tiers           []string `json:"tiers" validate:"max=20,dive,required,max=50"`
+	PastPurchasers  bool     `json:"past_purchasers"`
+	AttributionDays int      `json:"attribution_days" validate:"omitempty,min=1,max=90"`
+}
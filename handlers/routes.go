@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"pharmacy/config"
+	"pharmacy/models"
+	"pharmacy/storage"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RegisterRoutes builds the handlers from their dependencies and mounts every
+// API route on e
+func RegisterRoutes(e *echo.Echo, cfg *config.Config, repos *models.Repositories, auth *models.AuthService, store storage.Store) {
+	e.Validator = NewRequestValidator()
+
+	userHandler := NewUserHandler(repos.Users, auth)
+	companyHandler := NewCompanyHandler(repos.Companies, auth)
+	medicineHandler := NewMedicineHandler(repos.Medicines, cfg.Upload, auth)
+	orderHandler := NewOrderHandler(repos.Orders, repos.OrderUpdates, auth)
+	attachmentHandler := NewAttachmentHandler(repos.Orders, store, cfg.Upload, auth)
+	cartHandler := NewCartHandler(repos.Carts, auth)
+	auditHandler := NewAuditHandler(repos.Audit, auth)
+	analyticsHandler := NewAnalyticsHandler(repos.Sales, auth)
+	webhookHandler := NewWebhookHandler(repos.Webhooks, auth)
+	notificationHandler := NewNotificationHandler(repos.Notify, auth)
+	campaignHandler := NewCampaignHandler(repos.Campaigns, auth)
+
+	// Define routes
+	e.POST("/signup", userHandler.SignUp)
+	e.POST("/authenticate", userHandler.Authenticate)
+	e.POST("/auth/otp/request", userHandler.RequestOTP)
+	e.POST("/auth/otp/verify", userHandler.VerifyOTP)
+	e.POST("/auth/refresh", userHandler.RefreshToken)
+	e.POST("/auth/logout", userHandler.Logout)
+	e.POST("/auth/password/change", userHandler.ChangePassword)
+	e.POST("/auth/password/forgot", userHandler.ForgotPassword)
+	e.POST("/auth/password/reset", userHandler.ResetPassword)
+	e.PUT("/user/:id", userHandler.UpdateUser)
+	e.GET("/users/pending", userHandler.GetPendingUsers)
+	e.PUT("/users/:id/approve", userHandler.ApproveUser)
+	e.PUT("/users/:id/reject", userHandler.RejectUser)
+	e.POST("/users/:id/sessions/revoke", userHandler.RevokeUserSessions)
+
+	e.POST("/companies", companyHandler.CreateCompany)
+	e.GET("/companies", companyHandler.GetAllCompanies)
+	e.GET("/companies/:id", companyHandler.GetCompany)
+	e.PUT("/companies/:id", companyHandler.UpdateCompany)
+	e.DELETE("/companies/:id", companyHandler.DeleteCompany)
+	e.POST("/companies/:id/restore", companyHandler.RestoreCompany)
+
+	e.POST("/medicines", medicineHandler.CreateMedicine)
+	e.PUT("/medicines/:id", medicineHandler.UpdateMedicine)
+	e.DELETE("/medicines/:id", medicineHandler.DeleteMedicine)
+	e.POST("/medicines/:id/restore", medicineHandler.RestoreMedicine)
+	e.PUT("/medicines/:id/stock", medicineHandler.SetStock)
+	e.GET("/medicines/:id", medicineHandler.GetMedicine)
+	e.GET("/medicines", medicineHandler.GetAllMedicines)
+	e.POST("/medicines/upload", medicineHandler.UploadMedicinesCSV, middleware.BodyLimit(fmt.Sprintf("%dB", cfg.Upload.MaxBytes)))
+
+	e.POST("/orders", orderHandler.CreateOrder)
+	e.GET("/orders/:id", orderHandler.GetOrder)
+	e.PUT("/orders/:id", orderHandler.UpdateOrder)
+	e.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
+	e.DELETE("/orders/:id", orderHandler.DeleteOrder)
+	e.POST("/orders/:id/restore", orderHandler.RestoreOrder)
+	e.POST("/orders/:id/reorder", orderHandler.ReorderOrder)
+	e.POST("/orders/:id/split", orderHandler.SplitOrder)
+	e.POST("/orders/:id/fulfilment", orderHandler.FulfilOrder)
+	e.POST("/orders/:id/cancel", orderHandler.CancelOrder)
+	e.POST("/orders/:id/cancel/approve", orderHandler.ApproveCancellation)
+	e.POST("/orders/:id/cancel/reject", orderHandler.RejectCancellation)
+	e.POST("/orders/:id/notes", orderHandler.AddOrderNote)
+	e.POST("/orders/:id/attachments", attachmentHandler.UploadAttachment, middleware.BodyLimit(fmt.Sprintf("%dB", cfg.Upload.MaxBytes)))
+	e.GET("/orders/:id/attachments/:attachmentId", attachmentHandler.DownloadAttachment)
+	e.DELETE("/orders/:id/attachments/:attachmentId", attachmentHandler.DeleteAttachment)
+	e.GET("/orders", orderHandler.GetAllOrders)
+	e.GET("/orders/stream", orderHandler.StreamOrders)
+	e.GET("/me/reorder-suggestions", orderHandler.GetReorderSuggestions)
+	e.POST("/me/reorder-suggestions/draft", orderHandler.CreateReorderDraft)
+
+	e.GET("/cart", cartHandler.GetCart)
+	e.DELETE("/cart", cartHandler.ClearCart)
+	e.POST("/cart/items", cartHandler.AddItem)
+	e.PUT("/cart/items/:medicineId", cartHandler.UpdateItem)
+	e.DELETE("/cart/items/:medicineId", cartHandler.RemoveItem)
+	e.POST("/cart/checkout", cartHandler.Checkout)
+
+	e.PUT("/medicines/offer", medicineHandler.UpdateOffer)
+
+	e.GET("/audit", auditHandler.GetAuditLog)
+
+	e.GET("/analytics/sales", analyticsHandler.GetSalesReport)
+	e.GET("/analytics/offers", analyticsHandler.GetOfferReport)
+
+	e.POST("/webhooks", webhookHandler.CreateWebhook)
+	e.GET("/webhooks", webhookHandler.GetAllWebhooks)
+	e.GET("/webhooks/:id", webhookHandler.GetWebhook)
+	e.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+	e.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+	e.GET("/webhooks/:id/deliveries", webhookHandler.GetDeliveries)
+	e.POST("/webhooks/deliveries/:deliveryId/redeliver", webhookHandler.RedeliverDelivery)
+
+	e.GET("/me/notifications", notificationHandler.GetMyNotifications)
+	e.GET("/me/notification-preferences", notificationHandler.GetPreferences)
+	e.PUT("/me/notification-preferences", notificationHandler.UpdatePreferences)
+	e.POST("/me/devices", notificationHandler.RegisterDevice)
+	e.GET("/me/devices", notificationHandler.GetDevices)
+	e.DELETE("/me/devices/:id", notificationHandler.RemoveDevice)
+	e.GET("/users/:id/notifications", notificationHandler.GetUserNotifications)
+	e.GET("/notifications/templates", notificationHandler.GetTemplates)
+	e.PUT("/notifications/templates/:event/:channel", notificationHandler.UpdateTemplate)
+	e.DELETE("/notifications/templates/:event/:channel", notificationHandler.ResetTemplate)
+
+	e.POST("/campaigns", campaignHandler.CreateCampaign)
+	e.GET("/campaigns", campaignHandler.GetAllCampaigns)
+	e.GET("/campaigns/:id", campaignHandler.GetCampaign)
+	e.PUT("/campaigns/:id", campaignHandler.UpdateCampaign)
+	e.DELETE("/campaigns/:id", campaignHandler.DeleteCampaign)
+	e.GET("/campaigns/:id/preview", campaignHandler.PreviewCampaign)
+	e.POST("/campaigns/:id/send", campaignHandler.SendCampaign)
+	e.GET("/campaigns/:id/report", campaignHandler.GetCampaignReport)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// anonymousStatus is the status of every route when called without a token
+// and without a body. Public routes fail validation or answer normally; the
+// rest refuse the request.
+var anonymousStatus = map[string]int{
+	"POST /signup":                    http.StatusBadRequest,
+	"POST /authenticate":              http.StatusBadRequest,
+	"POST /auth/otp/request":          http.StatusBadRequest,
+	"POST /auth/otp/verify":           http.StatusBadRequest,
+	"POST /auth/refresh":              http.StatusBadRequest,
+	"POST /auth/logout":               http.StatusUnauthorized,
+	"POST /auth/password/change":      http.StatusUnauthorized,
+	"POST /auth/password/forgot":      http.StatusBadRequest,
+	"POST /auth/password/reset":       http.StatusBadRequest,
+	"PUT /user/:id":                   http.StatusUnauthorized,
+	"GET /users/pending":              http.StatusUnauthorized,
+	"PUT /users/:id/approve":          http.StatusUnauthorized,
+	"PUT /users/:id/reject":           http.StatusUnauthorized,
+	"POST /users/:id/sessions/revoke": http.StatusUnauthorized,
+
+	"POST /companies":             http.StatusUnauthorized,
+	"GET /companies":              http.StatusOK,
+	"GET /companies/:id":          http.StatusNotFound,
+	"PUT /companies/:id":          http.StatusUnauthorized,
+	"DELETE /companies/:id":       http.StatusUnauthorized,
+	"POST /companies/:id/restore": http.StatusUnauthorized,
+
+	"POST /medicines":             http.StatusUnauthorized,
+	"PUT /medicines/:id":          http.StatusUnauthorized,
+	"DELETE /medicines/:id":       http.StatusUnauthorized,
+	"POST /medicines/:id/restore": http.StatusUnauthorized,
+	"PUT /medicines/:id/stock":    http.StatusUnauthorized,
+	"GET /medicines/:id":          http.StatusNotFound,
+	"GET /medicines":              http.StatusOK,
+	"POST /medicines/upload":      http.StatusUnauthorized,
+	"PUT /medicines/offer":        http.StatusUnauthorized,
+
+	"POST /orders":                                 http.StatusUnauthorized,
+	"GET /orders/:id":                              http.StatusUnauthorized,
+	"PUT /orders/:id":                              http.StatusUnauthorized,
+	"PUT /orders/:id/status":                       http.StatusUnauthorized,
+	"DELETE /orders/:id":                           http.StatusUnauthorized,
+	"POST /orders/:id/restore":                     http.StatusUnauthorized,
+	"POST /orders/:id/reorder":                     http.StatusUnauthorized,
+	"POST /orders/:id/split":                       http.StatusUnauthorized,
+	"POST /orders/:id/fulfilment":                  http.StatusUnauthorized,
+	"POST /orders/:id/cancel":                      http.StatusUnauthorized,
+	"POST /orders/:id/cancel/approve":              http.StatusUnauthorized,
+	"POST /orders/:id/cancel/reject":               http.StatusUnauthorized,
+	"POST /orders/:id/notes":                       http.StatusUnauthorized,
+	"POST /orders/:id/attachments":                 http.StatusUnauthorized,
+	"GET /orders/:id/attachments/:attachmentId":    http.StatusUnauthorized,
+	"DELETE /orders/:id/attachments/:attachmentId": http.StatusUnauthorized,
+	"GET /orders":                                  http.StatusUnauthorized,
+	"GET /orders/stream":                           http.StatusUnauthorized,
+	"GET /me/reorder-suggestions":                  http.StatusUnauthorized,
+	"POST /me/reorder-suggestions/draft":           http.StatusUnauthorized,
+
+	"GET /cart":                      http.StatusUnauthorized,
+	"DELETE /cart":                   http.StatusUnauthorized,
+	"POST /cart/items":               http.StatusUnauthorized,
+	"PUT /cart/items/:medicineId":    http.StatusUnauthorized,
+	"DELETE /cart/items/:medicineId": http.StatusUnauthorized,
+	"POST /cart/checkout":            http.StatusUnauthorized,
+
+	"GET /audit":            http.StatusUnauthorized,
+	"GET /analytics/sales":  http.StatusUnauthorized,
+	"GET /analytics/offers": http.StatusUnauthorized,
+
+	"POST /webhooks":                                  http.StatusUnauthorized,
+	"GET /webhooks":                                   http.StatusUnauthorized,
+	"GET /webhooks/:id":                               http.StatusUnauthorized,
+	"PUT /webhooks/:id":                               http.StatusUnauthorized,
+	"DELETE /webhooks/:id":                            http.StatusUnauthorized,
+	"GET /webhooks/:id/deliveries":                    http.StatusUnauthorized,
+	"POST /webhooks/deliveries/:deliveryId/redeliver": http.StatusUnauthorized,
+
+	"GET /me/notifications":                           http.StatusUnauthorized,
+	"GET /me/notification-preferences":                http.StatusUnauthorized,
+	"PUT /me/notification-preferences":                http.StatusUnauthorized,
+	"POST /me/devices":                                http.StatusUnauthorized,
+	"GET /me/devices":                                 http.StatusUnauthorized,
+	"DELETE /me/devices/:id":                          http.StatusUnauthorized,
+	"GET /users/:id/notifications":                    http.StatusUnauthorized,
+	"GET /notifications/templates":                    http.StatusUnauthorized,
+	"PUT /notifications/templates/:event/:channel":    http.StatusUnauthorized,
+	"DELETE /notifications/templates/:event/:channel": http.StatusUnauthorized,
+
+	"POST /campaigns":            http.StatusUnauthorized,
+	"GET /campaigns":             http.StatusUnauthorized,
+	"GET /campaigns/:id":         http.StatusUnauthorized,
+	"PUT /campaigns/:id":         http.StatusUnauthorized,
+	"DELETE /campaigns/:id":      http.StatusUnauthorized,
+	"GET /campaigns/:id/preview": http.StatusUnauthorized,
+	"POST /campaigns/:id/send":   http.StatusUnauthorized,
+	"GET /campaigns/:id/report":  http.StatusUnauthorized,
+}
+
+// routePath fills in the parameters of a route path
+var routePath = strings.NewReplacer(
+	":attachmentId", "1",
+	":medicineId", "1",
+	":deliveryId", "1",
+	":event", "order_status_changed",
+	":channel", "sms",
+	":id", "1",
+)
+
+func TestRoutesWithoutToken(t *testing.T) {
+	s := newTestServer(t)
+
+	registered := map[string]bool{}
+	for _, route := range s.e.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+
+		want, ok := anonymousStatus[key]
+		if !ok {
+			t.Errorf("%s is not covered by the route tests", key)
+			continue
+		}
+		if key == "GET /orders/stream" {
+			continue // Checked below so a mistake cannot leave the stream open
+		}
+		if rec := s.request(route.Method, routePath.Replace(route.Path), "", nil); rec.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", key, rec.Code, want, rec.Body.String())
+		}
+	}
+	for key := range anonymousStatus {
+		if !registered[key] {
+			t.Errorf("%s is not registered", key)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/orders/stream", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /orders/stream: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAdminRoutesRefuseCustomers(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+
+	routes := []struct{ method, path string }{
+		{http.MethodGet, "/users/pending"},
+		{http.MethodPut, "/users/1/approve"},
+		{http.MethodPut, "/users/1/reject"},
+		{http.MethodPost, "/users/1/sessions/revoke"},
+		{http.MethodPost, "/companies/1/restore"},
+		{http.MethodPost, "/medicines/1/restore"},
+		{http.MethodPut, "/medicines/1/stock"},
+		{http.MethodDelete, "/orders/1"},
+		{http.MethodPost, "/orders/1/restore"},
+		{http.MethodPost, "/orders/1/split"},
+		{http.MethodPost, "/orders/1/fulfilment"},
+		{http.MethodGet, "/audit"},
+		{http.MethodGet, "/analytics/sales"},
+		{http.MethodGet, "/analytics/offers"},
+		{http.MethodPost, "/webhooks"},
+		{http.MethodGet, "/webhooks"},
+		{http.MethodGet, "/webhooks/1"},
+		{http.MethodPut, "/webhooks/1"},
+		{http.MethodDelete, "/webhooks/1"},
+		{http.MethodGet, "/webhooks/1/deliveries"},
+		{http.MethodPost, "/webhooks/deliveries/1/redeliver"},
+		{http.MethodGet, "/users/1/notifications"},
+		{http.MethodGet, "/notifications/templates"},
+		{http.MethodPut, "/notifications/templates/order_status_changed/sms"},
+		{http.MethodDelete, "/notifications/templates/order_status_changed/sms"},
+		{http.MethodPost, "/campaigns"},
+		{http.MethodGet, "/campaigns"},
+		{http.MethodGet, "/campaigns/1"},
+		{http.MethodPut, "/campaigns/1"},
+		{http.MethodDelete, "/campaigns/1"},
+		{http.MethodGet, "/campaigns/1/preview"},
+		{http.MethodPost, "/campaigns/1/send"},
+		{http.MethodGet, "/campaigns/1/report"},
+	}
+	for _, route := range routes {
+		if rec := s.request(route.method, route.path, token, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want %d: %s", route.method, route.path, rec.Code, http.StatusForbidden, rec.Body.String())
+		}
+	}
+}
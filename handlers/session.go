@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair
+func (h *UserHandler) RefreshToken(c echo.Context) error {
+	var request RefreshTokenRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	tokens, user, err := h.auth.RefreshSession(request.RefreshToken)
+	if statusErr := accountStatusError(user, err); statusErr != nil {
+		return statusErr
+	}
+	if errors.Is(err, models.ErrInvalidRefreshToken) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired refresh token")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, authResponse(tokens, user))
+}
+
+// Logout revokes the session of the access token used to call it
+func (h *UserHandler) Logout(c echo.Context) error {
+	claims, err := getClaimsFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	sid, _ := claims["sid"].(float64)
+	if err := h.auth.RevokeSession(uint(sid)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// RevokeUserSessions lets an admin end every session of a user,
+// e.g. when a phone is lost or an employee leaves
+func (h *UserHandler) RevokeUserSessions(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	revoked, err := h.auth.RevokeUserSessions(uint(id))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":         "Sessions revoked",
+		"revokedSessions": revoked,
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"testing"
+)
+
+// twoCompanyOrder places an order with one medicine of each of two companies
+func (s *testServer) twoCompanyOrder(adminToken, token string, split bool) models.OrderRequest {
+	s.t.Helper()
+
+	cipla, paracetamol := s.catalog(adminToken)
+	sun := s.company(adminToken, "Sun Pharma")
+	pantoprazole := s.medicine(adminToken, sun, "Pantoprazole", 30)
+
+	var order models.OrderRequest
+	s.call(http.MethodPost, "/orders", token, map[string]interface{}{
+		"items": []OrderItemInput{
+			{MedicineID: paracetamol, CompanyID: cipla, Quantity: 2},
+			{MedicineID: pantoprazole, CompanyID: sun, Quantity: 1},
+		},
+		"splitByCompany": split,
+	}, http.StatusOK, &order)
+	return order
+}
+
+func TestSplitOrderOnCreate(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+
+	order := s.twoCompanyOrder(adminToken, token, true)
+	if len(order.Items) != 2 || len(order.ChildOrders) != 2 {
+		t.Fatalf("order = %+v, want two child orders whose items it lists", order)
+	}
+	for _, child := range order.ChildOrders {
+		if len(child.Items) != 1 || child.ParentOrderID == nil || *child.ParentOrderID != order.OrderID {
+			t.Fatalf("child order = %+v, want one item and parent %d", child, order.OrderID)
+		}
+	}
+}
+
+func TestSplitOrder(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+
+	order := s.twoCompanyOrder(adminToken, token, false)
+	path := fmt.Sprintf("/orders/%d/split", order.OrderID)
+	s.call(http.MethodPost, path, token, nil, http.StatusForbidden, nil)
+
+	var split models.OrderRequest
+	s.call(http.MethodPost, path, adminToken, nil, http.StatusOK, &split)
+	if len(split.ChildOrders) != 2 {
+		t.Fatalf("split order = %+v, want two child orders", split)
+	}
+	s.call(http.MethodPost, path, adminToken, nil, http.StatusConflict, nil)
+	s.call(http.MethodPost, fmt.Sprintf("/orders/%d/split", split.ChildOrders[0].OrderID), adminToken, nil, http.StatusConflict, nil)
+
+	single := s.order(token, OrderItemInput{MedicineID: split.ChildOrders[0].Items[0].MedicineID, CompanyID: split.ChildOrders[0].Items[0].CompanyID, Quantity: 1})
+	s.call(http.MethodPost, fmt.Sprintf("/orders/%d/split", single.OrderID), adminToken, nil, http.StatusConflict, nil)
+}
+
+func TestSplitOrderStatus(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+
+	order := s.twoCompanyOrder(adminToken, token, true)
+	first, second := order.ChildOrders[0].OrderID, order.ChildOrders[1].OrderID
+
+	// The parent follows its children
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusConflict)
+	s.setStatus(adminToken, first, models.OrderStatusProcessing, http.StatusOK)
+	if got := s.getOrder(token, order.OrderID); got.Status != models.OrderStatusPending {
+		t.Fatalf("parent status = %q, want pending while a child is pending", got.Status)
+	}
+	s.setStatus(adminToken, second, models.OrderStatusShipped, http.StatusOK)
+	if got := s.getOrder(token, order.OrderID); got.Status != models.OrderStatusProcessing {
+		t.Fatalf("parent status = %q, want processing", got.Status)
+	}
+	s.setStatus(adminToken, first, models.OrderStatusShipped, http.StatusOK)
+	if got := s.getOrder(token, order.OrderID); got.Status != models.OrderStatusShipped {
+		t.Fatalf("parent status = %q, want shipped", got.Status)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamHeartbeat is how often an idle order stream sends a comment to keep
+// proxies from closing it. The caller's session is checked again at the same
+// time.
+const streamHeartbeat = 25 * time.Second
+
+// streamRetry is the reconnection delay suggested to clients, in milliseconds
+const streamRetry = 5000
+
+// StreamOrders streams order updates as server-sent events: admins receive
+// every new order and status change, other users those of their own orders.
+// The stream ends when the session expires or is revoked, or when the client
+// falls too far behind; clients then reconnect and reload their orders.
+func (h *OrderHandler) StreamOrders(c echo.Context) error {
+	userID, isAdmin, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	updates, cancel := h.updates.Subscribe()
+	defer cancel()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // Disable buffering in nginx
+	res.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", streamRetry); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, _, err := GetUserFromHeader(c, h.auth); err != nil {
+				return nil
+			}
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case update, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if !isAdmin && update.UserID != userID {
+				continue
+			}
+			data, err := json.Marshal(update)
+			if err != nil {
+				return nil
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", update.Type, data); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
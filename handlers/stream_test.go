@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pharmacy/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamOrders(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	_, otherToken := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+
+	// stream collects what a customer's stream receives until it is stopped
+	stream := func(token string) (stop func() string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/orders/stream", nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			s.e.ServeHTTP(rec, req)
+			close(done)
+		}()
+		return func() string {
+			cancel()
+			<-done
+			return rec.Body.String()
+		}
+	}
+
+	stopOwner := stream(token)
+	stopOther := stream(otherToken)
+	time.Sleep(100 * time.Millisecond) // Let both streams subscribe
+
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 1})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK)
+	time.Sleep(100 * time.Millisecond)
+
+	owner := stopOwner()
+	if !strings.Contains(owner, "event: "+models.EventOrderCreated) || !strings.Contains(owner, "event: "+models.EventOrderStatusChanged) {
+		t.Fatalf("owner's stream = %q, want the new order and its status change", owner)
+	}
+	if other := stopOther(); strings.Contains(other, "event:") {
+		t.Fatalf("another customer's stream = %q, want no events", other)
+	}
+}
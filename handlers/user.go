@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"pharmacy/models"
 	"strconv"
@@ -8,93 +9,97 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-// SignUpHandler handles the user sign-up process
-func SignUpHandler(c echo.Context) error {
-	var user models.User
-	if err := c.Bind(&user); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid input")
-	}
+// UserHandler handles signup, login and account management requests
+type UserHandler struct {
+	users models.UserRepo
+	auth  *models.AuthService
+}
 
-	// Check that the required fields are provided
-	if user.Name == "" || user.Phone == "" || user.Password == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Name, Phone, and Password are required")
+// NewUserHandler creates a new instance of the handler
+func NewUserHandler(users models.UserRepo, auth *models.AuthService) *UserHandler {
+	return &UserHandler{users: users, auth: auth}
+}
+
+// SignUp handles the user sign-up process. New accounts are created
+// in the pending_approval state and cannot log in until an admin approves them.
+func (h *UserHandler) SignUp(c echo.Context) error {
+	var req SignUpRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
 	// Check if the phone number already exists
-	token, existingUser, _ := models.AuthenticateUser(user.Phone, "")
-	if existingUser != nil {
+	if existingUser, _ := h.users.GetByPhone(req.Phone); existingUser != nil {
 		return echo.NewHTTPError(http.StatusConflict, "Phone Number already in use")
 	}
 
-	// Create the user with the firm_name and is_admin field
-	token, newUser, err := models.CreateUser(user.Name, user.Email, user.Phone, user.Password, user.FirmName, user.IsAdmin)
+	// New accounts are never admins; only admins can grant the role
+	newUser, err := h.users.Create(req.Name, req.Email, req.Phone, req.Password, req.FirmName, req.City, models.Actor{Name: "signup", IP: c.RealIP()})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-	}
-	userResponse := models.UserResponse{
-		ID:          newUser.ID,
-		PhoneNumber: newUser.Phone,
-		Name:        newUser.Name,
-		Email:       newUser.Email,
-		FirmName:    newUser.FirmName,
-		IsAdmin:     newUser.IsAdmin,
+		return err
 	}
 	response := map[string]interface{}{
-		"token": token,
-		"user":  userResponse,
+		"message": "Signup successful. Your account is pending approval.",
+		"user":    newUser.ToResponse(),
 	}
 	// Return the created user
 	return c.JSON(http.StatusCreated, response)
 }
 
-// UpdateUserHandler handles the user update process
-func UpdateUserHandler(c echo.Context) error {
-	id := c.Param("id")
-	var user models.User
-	if err := c.Bind(&user); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid input")
+// UpdateUser handles the user update process. Users may update their
+// own profile; admins may update anyone and are the only ones who can grant
+// the admin role.
+func (h *UserHandler) UpdateUser(c echo.Context) error {
+	callerID, callerIsAdmin, err := GetUserFromHeader(c, h.auth)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	// Check that required fields are provided
-	if user.Name == "" || user.Phone == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Name and Phone are required")
+	var req UpdateUserRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
 	}
 
-	// Assume "updatedBy" is passed in the request headers (could be set via middleware based on logged-in user)
-	updatedBy := c.Request().Header.Get("X-Updated-By")
-	if updatedBy == "" {
-		updatedBy = "system" // Default value if not provided
+	if !callerIsAdmin {
+		if uint(id) != callerID {
+			return echo.NewHTTPError(http.StatusForbidden, "You can only update your own account")
+		}
+		if req.IsAdmin != nil && *req.IsAdmin {
+			return echo.NewHTTPError(http.StatusForbidden, "Only admins can assign the admin role")
+		}
+		if req.Tier != nil {
+			return echo.NewHTTPError(http.StatusForbidden, "Only admins can assign tiers")
+		}
 	}
-	intId, _ := strconv.Atoi(id)
-	// Update the user with the firm_name and is_admin field
-	updatedUser, err := models.UpdateUser(intId, user.Name, user.Phone, user.FirmName, user.IsAdmin, updatedBy)
+
+	// Update the user with the firm_name and is_admin field. Changing the
+	// role ends the user's sessions.
+	updatedUser, err := h.auth.UpdateUser(uint(id), req.Name, req.Phone, req.FirmName, req.City, req.Tier, req.IsAdmin, models.UserActor(callerID, c.RealIP()))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	// Return the updated user
-	return c.JSON(http.StatusOK, updatedUser)
+	return c.JSON(http.StatusOK, updatedUser.ToResponse())
 }
 
-// AuthenticateHandler authenticates a user based on email or phone number
-func AuthenticateHandler(c echo.Context) error {
-	var request struct {
-		Identifier string `json:"identifier"` // Email or Phone
-		Password   string `json:"password"`   // Password
-	}
-
-	// Bind request payload
-	if err := c.Bind(&request); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid input")
-	}
-
-	// Ensure the identifier and password are provided
-	if request.Identifier == "" || request.Password == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Identifier and Password are required")
+// Authenticate authenticates a user based on email or phone number
+func (h *UserHandler) Authenticate(c echo.Context) error {
+	var request AuthenticateRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
 	}
 
 	// Authenticate the user (either by email or phone)
-	token, user, err := models.AuthenticateUser(request.Identifier, request.Password)
+	tokens, user, err := h.auth.Authenticate(request.Identifier, request.Password)
+	if statusErr := accountStatusError(user, err); statusErr != nil {
+		return statusErr
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
 	}
@@ -104,18 +109,130 @@ func AuthenticateHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
 	}
 
-	userResponse := models.UserResponse{
-		ID:          user.ID,
-		PhoneNumber: user.Phone,
-		Name:        user.Name,
-		Email:       user.Email,
-		FirmName:    user.FirmName,
-		IsAdmin:     user.IsAdmin,
+	// Return the authenticated user
+	return c.JSON(http.StatusOK, authResponse(tokens, user))
+}
+
+// GetPendingUsers lists accounts waiting for admin approval
+func (h *UserHandler) GetPendingUsers(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	users, err := h.users.ListByStatus(models.UserStatusPendingApproval)
+	if err != nil {
+		return err
 	}
-	response := map[string]interface{}{
-		"token": token,
-		"user":  userResponse,
+
+	response := []models.UserResponse{}
+	for _, user := range users {
+		response = append(response, user.ToResponse())
 	}
-	// Return the authenticated user
 	return c.JSON(http.StatusOK, response)
 }
+
+// ApproveUser approves a pending account so it can log in
+func (h *UserHandler) ApproveUser(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	user, err := h.users.Approve(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// RejectUser rejects an account with a reason shown to the user at login
+func (h *UserHandler) RejectUser(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var request RejectUserRequest
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	user, err := h.auth.RejectUser(uint(id), request.Reason, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// authResponse builds the login response with the token pair and user
+func authResponse(tokens *models.TokenPair, user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"user":         user.ToResponse(),
+	}
+}
+
+// accountStatusError converts the login errors for pending and rejected
+// accounts into a 403 response, or returns nil for any other error
+func accountStatusError(user *models.User, err error) error {
+	if errors.Is(err, models.ErrAccountPendingApproval) {
+		return echo.NewHTTPError(http.StatusForbidden, "Account is pending approval")
+	}
+	if errors.Is(err, models.ErrAccountRejected) {
+		message := "Account has been rejected"
+		if user != nil && user.StatusReason != "" {
+			message += ": " + user.StatusReason
+		}
+		return echo.NewHTTPError(http.StatusForbidden, message)
+	}
+	return nil
+}
+
+// requireActor returns the authenticated caller as the actor of a change,
+// or an HTTP error if the request carries no valid token
+func requireActor(c echo.Context, auth *models.AuthService) (models.Actor, error) {
+	userID, _, err := GetUserFromHeader(c, auth)
+	if err != nil {
+		return models.Actor{}, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	return models.UserActor(userID, c.RealIP()), nil
+}
+
+// requireAdmin returns the caller's user ID, or an HTTP error if the caller
+// is not an authenticated admin
+func requireAdmin(c echo.Context, auth *models.AuthService) (uint, error) {
+	userID, isAdmin, err := GetUserFromHeader(c, auth)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	if !isAdmin {
+		return 0, echo.NewHTTPError(http.StatusForbidden, "Admin access required")
+	}
+	return userID, nil
+}
+
+// includeDeleted reports whether the request asks for soft-deleted records
+// with ?include_deleted=true, which only admins may do
+func includeDeleted(c echo.Context, auth *models.AuthService) (bool, error) {
+	if c.QueryParam("include_deleted") != "true" {
+		return false, nil
+	}
+	if _, err := requireAdmin(c, auth); err != nil {
+		return false, err
+	}
+	return true, nil
+}
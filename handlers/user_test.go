@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"regexp"
+	"testing"
+)
+
+// smsCode is the OTP or reset code in a message sent to a phone
+var smsCode = regexp.MustCompile(`code is (\S+)\.`)
+
+// sentCode returns the code in the last message sent to phone
+func (s *testServer) sentCode(phone string) string {
+	s.t.Helper()
+
+	match := smsCode.FindStringSubmatch(s.sms.messages[phone])
+	if match == nil {
+		s.t.Fatalf("no code sent to %s: %q", phone, s.sms.messages[phone])
+	}
+	return match[1]
+}
+
+func TestSignUpApproval(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+
+	var signup struct {
+		User models.UserResponse `json:"user"`
+	}
+	body := map[string]string{"name": "Asha", "phone": "9811111111", "password": "secret123", "firm_name": "Asha Medicals"}
+	s.call(http.MethodPost, "/signup", "", body, http.StatusCreated, &signup)
+	if signup.User.Status != models.UserStatusPendingApproval || signup.User.IsAdmin {
+		t.Fatalf("new user = %+v, want a pending customer", signup.User)
+	}
+	s.call(http.MethodPost, "/signup", "", body, http.StatusConflict, nil)
+
+	login := map[string]string{"identifier": "9811111111", "password": "secret123"}
+	s.call(http.MethodPost, "/authenticate", "", login, http.StatusForbidden, nil)
+
+	var pending []models.UserResponse
+	s.call(http.MethodGet, "/users/pending", adminToken, nil, http.StatusOK, &pending)
+	if len(pending) != 1 || pending[0].ID != signup.User.ID {
+		t.Fatalf("pending users = %+v, want user %d", pending, signup.User.ID)
+	}
+
+	s.call(http.MethodPut, fmt.Sprintf("/users/%d/approve", signup.User.ID), adminToken, nil, http.StatusOK, nil)
+	s.login("9811111111", "secret123")
+	s.call(http.MethodPost, "/authenticate", "", map[string]string{"identifier": "9811111111", "password": "wrong"}, http.StatusUnauthorized, nil)
+}
+
+func TestRejectUser(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+
+	var signup struct {
+		User models.UserResponse `json:"user"`
+	}
+	s.call(http.MethodPost, "/signup", "", map[string]string{"name": "Ravi", "phone": "9822222222", "password": "secret123"}, http.StatusCreated, &signup)
+	path := fmt.Sprintf("/users/%d/reject", signup.User.ID)
+	s.call(http.MethodPut, path, adminToken, map[string]string{}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, path, adminToken, map[string]string{"reason": "Licence not verified"}, http.StatusOK, nil)
+
+	rec := s.request(http.MethodPost, "/authenticate", "", map[string]string{"identifier": "9822222222", "password": "secret123"})
+	if rec.Code != http.StatusForbidden || !regexp.MustCompile("Licence not verified").MatchString(rec.Body.String()) {
+		t.Fatalf("login of rejected user: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	s := newTestServer(t)
+	adminID, adminToken := s.admin()
+	userID, token := s.retailer(adminToken)
+	otherID, _ := s.retailer(adminToken)
+
+	update := map[string]interface{}{"name": "New Name", "phone": s.newPhone(), "firm_name": "New Firm"}
+	var user models.UserResponse
+	s.call(http.MethodPut, fmt.Sprintf("/user/%d", userID), token, update, http.StatusOK, &user)
+	if user.Name != "New Name" || user.FirmName != "New Firm" || user.IsAdmin {
+		t.Fatalf("updated user = %+v", user)
+	}
+
+	s.call(http.MethodPut, fmt.Sprintf("/user/%d", otherID), token, update, http.StatusForbidden, nil)
+	update["is_admin"] = true
+	s.call(http.MethodPut, fmt.Sprintf("/user/%d", userID), token, update, http.StatusForbidden, nil)
+
+	// Admins keep their role when is_admin is left out
+	s.call(http.MethodPut, fmt.Sprintf("/user/%d", adminID), adminToken, map[string]string{"name": "Boss", "phone": s.newPhone()}, http.StatusOK, &user)
+	if !user.IsAdmin {
+		t.Fatalf("admin lost the admin role: %+v", user)
+	}
+	rec := s.request(http.MethodPut, fmt.Sprintf("/user/%d", adminID), adminToken, map[string]string{"name": "Boss", "phone": s.newPhone()})
+	if regexp.MustCompile(`(?i)password`).MatchString(rec.Body.String()) {
+		t.Fatalf("response includes the password: %s", rec.Body.String())
+	}
+}
+
+func TestDemotedAdminLosesAccess(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	demotedID, demotedToken := s.admin()
+	s.call(http.MethodGet, "/users/pending", demotedToken, nil, http.StatusOK, nil)
+
+	phone := s.newPhone()
+	s.call(http.MethodPut, fmt.Sprintf("/user/%d", demotedID), adminToken, map[string]interface{}{"name": "Former Admin", "phone": phone, "is_admin": false}, http.StatusOK, nil)
+
+	// The token still says admin, but its session has ended
+	s.call(http.MethodGet, "/users/pending", demotedToken, nil, http.StatusUnauthorized, nil)
+	s.call(http.MethodGet, "/users/pending", s.login(phone, "secret123"), nil, http.StatusForbidden, nil)
+}
+
+func TestOTPLogin(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	s.retailer(adminToken)
+	phone := fmt.Sprint(s.phone)
+
+	s.call(http.MethodPost, "/auth/otp/request", "", map[string]string{"phone": phone}, http.StatusOK, nil)
+	code := s.sentCode(phone)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	s.call(http.MethodPost, "/auth/otp/verify", "", map[string]string{"phone": phone, "otp": wrong}, http.StatusUnauthorized, nil)
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	s.call(http.MethodPost, "/auth/otp/verify", "", map[string]string{"phone": phone, "otp": code}, http.StatusOK, &resp)
+	if resp.Token == "" {
+		t.Fatal("no token after verifying the OTP")
+	}
+	s.call(http.MethodPost, "/auth/otp/verify", "", map[string]string{"phone": phone, "otp": code}, http.StatusUnauthorized, nil)
+
+	// Unknown numbers get the same answers and no message
+	s.call(http.MethodPost, "/auth/otp/request", "", map[string]string{"phone": "9899999999"}, http.StatusOK, nil)
+	if _, ok := s.sms.messages["9899999999"]; ok {
+		t.Fatal("OTP sent to an unknown number")
+	}
+	for _, number := range []string{phone, "9899999999"} {
+		s.call(http.MethodPost, "/auth/otp/request", "", map[string]string{"phone": number}, http.StatusTooManyRequests, nil)
+	}
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	s.retailer(adminToken)
+	phone := fmt.Sprint(s.phone)
+
+	var tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	s.call(http.MethodPost, "/authenticate", "", map[string]string{"identifier": phone, "password": "secret123"}, http.StatusOK, &tokens)
+
+	var refreshed struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	s.call(http.MethodPost, "/auth/refresh", "", map[string]string{"refreshToken": tokens.RefreshToken}, http.StatusOK, &refreshed)
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	s.call(http.MethodGet, "/cart", refreshed.Token, nil, http.StatusOK, nil)
+
+	// Reusing a rotated refresh token ends the session it was rotated into
+	s.call(http.MethodPost, "/auth/refresh", "", map[string]string{"refreshToken": tokens.RefreshToken}, http.StatusUnauthorized, nil)
+	s.call(http.MethodGet, "/cart", refreshed.Token, nil, http.StatusUnauthorized, nil)
+
+	s.call(http.MethodPost, "/authenticate", "", map[string]string{"identifier": phone, "password": "secret123"}, http.StatusOK, &tokens)
+	s.call(http.MethodPost, "/auth/logout", tokens.Token, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, "/cart", tokens.Token, nil, http.StatusUnauthorized, nil)
+	s.call(http.MethodPost, "/auth/refresh", "", map[string]string{"refreshToken": tokens.RefreshToken}, http.StatusUnauthorized, nil)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	userID, token := s.retailer(adminToken)
+
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusOK, nil)
+	s.call(http.MethodPost, fmt.Sprintf("/users/%d/sessions/revoke", userID), adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusUnauthorized, nil)
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	phone := fmt.Sprint(s.phone)
+
+	s.call(http.MethodPost, "/auth/password/change", token, map[string]string{"oldPassword": "wrong", "newPassword": "newsecret"}, http.StatusUnauthorized, nil)
+	s.call(http.MethodPost, "/auth/password/change", token, map[string]string{"oldPassword": "secret123", "newPassword": "newsecret"}, http.StatusOK, nil)
+
+	s.call(http.MethodPost, "/authenticate", "", map[string]string{"identifier": phone, "password": "secret123"}, http.StatusUnauthorized, nil)
+	s.login(phone, "newsecret")
+}
+
+func TestForgotPassword(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	phone := fmt.Sprint(s.phone)
+
+	s.call(http.MethodPost, "/auth/password/forgot", "", map[string]string{"phone": phone}, http.StatusOK, nil)
+	resetToken := s.sentCode(phone)
+
+	s.call(http.MethodPost, "/auth/password/reset", "", map[string]string{"token": "bogus", "newPassword": "newsecret"}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/auth/password/reset", "", map[string]string{"token": resetToken, "newPassword": "newsecret"}, http.StatusOK, nil)
+	s.call(http.MethodPost, "/auth/password/reset", "", map[string]string{"token": resetToken, "newPassword": "other123"}, http.StatusBadRequest, nil)
+
+	// Resetting the password logs out every session
+	s.call(http.MethodGet, "/cart", token, nil, http.StatusUnauthorized, nil)
+	s.login(phone, "newsecret")
+}
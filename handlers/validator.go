@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pharmacy/models"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// phonePattern accepts 10 to 15 digits with an optional leading +
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{10,15}$`)
+
+// RequestValidator validates request DTOs using their `validate` struct tags
+// and is installed as the Echo validator
+type RequestValidator struct {
+	validate *validator.Validate
+}
+
+// NewRequestValidator creates a validator that reports fields by their JSON
+// names and understands the custom "phone" tag
+func NewRequestValidator() *RequestValidator {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	validate.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phonePattern.MatchString(fl.Field().String())
+	})
+
+	return &RequestValidator{validate: validate}
+}
+
+// Validate checks i and returns a *models.ValidationError listing every invalid field
+func (v *RequestValidator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	validationErr := &models.ValidationError{
+		Message: "Validation failed",
+		Fields:  make(map[string]string, len(fieldErrs)),
+	}
+	for _, fe := range fieldErrs {
+		validationErr.Fields[fieldPath(fe)] = fieldProblem(fe)
+	}
+	return validationErr
+}
+
+// fieldPath returns the JSON path of the field without the struct name,
+// e.g. "items[0].quantity"
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fe.Field()
+}
+
+// fieldProblem describes why the field failed validation
+func fieldProblem(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		return "must be a valid phone number (10 to 15 digits)"
+	case "url":
+		return "must be a valid URL"
+	case "http_url":
+		return "must be a valid http or https URL"
+	case "numeric":
+		return "must contain only digits"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "len":
+		if isString {
+			return fmt.Sprintf("must be exactly %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must contain exactly %s items", fe.Param())
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	}
+	return "is invalid"
+}
+
+// bindAndValidate binds the request body into req and validates it
+func bindAndValidate(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid input")
+	}
+	return c.Validate(req)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"pharmacy/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Page size limits for GET /webhooks/:id/deliveries
+const (
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 500
+)
+
+// WebhookHandler lets admins manage webhook endpoints and inspect their deliveries
+type WebhookHandler struct {
+	webhooks models.WebhookRepo
+	auth     *models.AuthService
+}
+
+// NewWebhookHandler creates a new instance of the handler
+func NewWebhookHandler(webhooks models.WebhookRepo, auth *models.AuthService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks, auth: auth}
+}
+
+// CreateWebhook registers an endpoint. The response carries the signing
+// secret, which is not shown again.
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	var req CreateWebhookRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	endpoint, err := h.webhooks.Create(req.URL, req.Description, uniqueEvents(req.Events), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, endpoint)
+}
+
+// GetAllWebhooks lists the registered endpoints
+func (h *WebhookHandler) GetAllWebhooks(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	endpoints, err := h.webhooks.List()
+	if err != nil {
+		return err
+	}
+	if endpoints == nil {
+		endpoints = []models.WebhookEndpoint{}
+	}
+	return c.JSON(http.StatusOK, endpoints)
+}
+
+// GetWebhook returns an endpoint
+func (h *WebhookHandler) GetWebhook(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	endpoint, err := h.webhooks.Get(uint(id))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, endpoint)
+}
+
+// UpdateWebhook changes an endpoint's URL, subscriptions or activation
+func (h *WebhookHandler) UpdateWebhook(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	var req UpdateWebhookRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	endpoint, err := h.webhooks.Update(uint(id), req.URL, req.Description, uniqueEvents(req.Events), *req.Active, models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, endpoint)
+}
+
+// DeleteWebhook removes an endpoint and gives up its pending deliveries
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.webhooks.Delete(uint(id), models.UserActor(adminID, c.RealIP())); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries lists the deliveries to an endpoint, newest first,
+// optionally filtered by status (?status=)
+func (h *WebhookHandler) GetDeliveries(c echo.Context) error {
+	if _, err := requireAdmin(c, h.auth); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid ID")
+	}
+
+	status := c.QueryParam("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		return models.NewValidationError("status", "must be one of: pending, delivered, failed")
+	}
+	limit, err := intParam(c, "limit", defaultDeliveryLimit, 1, maxDeliveryLimit)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := h.webhooks.Deliveries(uint(id), status, limit)
+	if err != nil {
+		return err
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverDelivery schedules a failed delivery to be sent again
+func (h *WebhookHandler) RedeliverDelivery(c echo.Context) error {
+	adminID, err := requireAdmin(c, h.auth)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("deliveryId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid delivery ID")
+	}
+	delivery, err := h.webhooks.Redeliver(uint(id), models.UserActor(adminID, c.RealIP()))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// uniqueEvents drops repeated event types, keeping the first occurrence
+func uniqueEvents(events []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, event := range events {
+		if !seen[event] {
+			seen[event] = true
+			unique = append(unique, event)
+		}
+	}
+	return unique
+}
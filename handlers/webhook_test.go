@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pharmacy/config"
+	"pharmacy/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is an endpoint that records the deliveries it receives
+// and answers them with status
+type webhookReceiver struct {
+	mu         sync.Mutex
+	status     int
+	payloads   []models.WebhookPayload
+	signatures []string
+	timestamps []string
+	bodies     [][]byte
+}
+
+// ServeHTTP records the delivery
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var payload models.WebhookPayload
+	json.Unmarshal(body, &payload)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, payload)
+	r.signatures = append(r.signatures, req.Header.Get("X-Webhook-Signature"))
+	r.timestamps = append(r.timestamps, req.Header.Get("X-Webhook-Timestamp"))
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+// received returns the payloads received so far
+func (r *webhookReceiver) received() []models.WebhookPayload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.WebhookPayload(nil), r.payloads...)
+}
+
+// respondWith changes the status of later responses
+func (r *webhookReceiver) respondWith(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+// dispatchWebhooks runs one round of the webhook dispatcher
+func (s *testServer) dispatchWebhooks(maxAttempts int) {
+	s.t.Helper()
+
+	cfg := config.Default().Webhook
+	cfg.MaxAttempts = maxAttempts
+	if err := models.NewWebhookDispatcher(s.db, cfg).Dispatch(context.Background()); err != nil {
+		s.t.Fatalf("dispatching webhooks: %v", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+
+	s.call(http.MethodPost, "/webhooks", adminToken, map[string]interface{}{"url": "ftp://example.com", "events": []string{models.EventOrderCreated}}, http.StatusBadRequest, nil)
+	s.call(http.MethodPost, "/webhooks", adminToken, map[string]interface{}{"url": "https://example.com/hook", "events": []string{"order.deleted"}}, http.StatusBadRequest, nil)
+
+	var created models.WebhookEndpoint
+	s.call(http.MethodPost, "/webhooks", adminToken, map[string]interface{}{
+		"url":    "https://example.com/hook",
+		"events": []string{models.EventOrderCreated, models.EventOrderCreated},
+	}, http.StatusCreated, &created)
+	if created.Secret == "" || len(created.Events) != 1 || !created.Active {
+		t.Fatalf("webhook = %+v, want an active endpoint with a secret and one event", created)
+	}
+
+	// The secret is only shown once
+	path := fmt.Sprintf("/webhooks/%d", created.ID)
+	var endpoint models.WebhookEndpoint
+	s.call(http.MethodGet, path, adminToken, nil, http.StatusOK, &endpoint)
+	if endpoint.Secret != "" {
+		t.Fatal("the secret is shown after creation")
+	}
+
+	s.call(http.MethodPut, path, adminToken, map[string]interface{}{
+		"url":    "https://example.com/other",
+		"events": []string{models.EventOrderStatusChanged},
+	}, http.StatusBadRequest, nil)
+	s.call(http.MethodPut, path, adminToken, map[string]interface{}{
+		"url":    "https://example.com/other",
+		"events": []string{models.EventOrderStatusChanged},
+		"active": false,
+	}, http.StatusOK, &endpoint)
+	if endpoint.URL != "https://example.com/other" || endpoint.Active {
+		t.Fatalf("updated webhook = %+v", endpoint)
+	}
+
+	var endpoints []models.WebhookEndpoint
+	s.call(http.MethodGet, "/webhooks", adminToken, nil, http.StatusOK, &endpoints)
+	if len(endpoints) != 1 {
+		t.Fatalf("webhooks = %+v, want one", endpoints)
+	}
+
+	s.call(http.MethodDelete, path, adminToken, nil, http.StatusOK, nil)
+	s.call(http.MethodGet, path, adminToken, nil, http.StatusNotFound, nil)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	var endpoint models.WebhookEndpoint
+	s.call(http.MethodPost, "/webhooks", adminToken, map[string]interface{}{
+		"url":    server.URL,
+		"events": []string{models.EventOrderCreated},
+	}, http.StatusCreated, &endpoint)
+
+	order := s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 2})
+	s.setStatus(adminToken, order.OrderID, models.OrderStatusProcessing, http.StatusOK) // Not subscribed
+	s.dispatchWebhooks(3)
+
+	if received := receiver.received(); len(received) != 1 || received[0].Type != models.EventOrderCreated {
+		t.Fatalf("received %+v, want one order.created event", received)
+	}
+	receiver.mu.Lock()
+	signature, want := receiver.signatures[0], "sha256="+models.SignWebhook(endpoint.Secret, receiver.timestamps[0], receiver.bodies[0])
+	receiver.mu.Unlock()
+	if signature != want {
+		t.Fatalf("signature = %q, want %q", signature, want)
+	}
+
+	var deliveries []models.WebhookDelivery
+	s.call(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries?status=delivered", endpoint.ID), adminToken, nil, http.StatusOK, &deliveries)
+	if len(deliveries) != 1 || deliveries[0].ResponseStatus != http.StatusOK {
+		t.Fatalf("deliveries = %+v, want one delivered", deliveries)
+	}
+
+	// Delivered events are not sent again
+	s.dispatchWebhooks(3)
+	if received := receiver.received(); len(received) != 1 {
+		t.Fatalf("received %d deliveries, want 1", len(received))
+	}
+}
+
+func TestWebhookRedelivery(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+	_, token := s.retailer(adminToken)
+	companyID, medicineID := s.catalog(adminToken)
+
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	var endpoint models.WebhookEndpoint
+	s.call(http.MethodPost, "/webhooks", adminToken, map[string]interface{}{
+		"url":    server.URL,
+		"events": []string{models.EventOrderCreated},
+	}, http.StatusCreated, &endpoint)
+	s.order(token, OrderItemInput{MedicineID: medicineID, CompanyID: companyID, Quantity: 2})
+	s.dispatchWebhooks(1)
+
+	var deliveries []models.WebhookDelivery
+	s.call(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries?status=sent", endpoint.ID), adminToken, nil, http.StatusBadRequest, nil)
+	s.call(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", endpoint.ID), adminToken, nil, http.StatusOK, &deliveries)
+	if len(deliveries) != 1 || deliveries[0].Status != models.DeliveryFailed || deliveries[0].ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("deliveries = %+v, want one failed with status 500", deliveries)
+	}
+
+	receiver.respondWith(http.StatusNoContent)
+	path := fmt.Sprintf("/webhooks/deliveries/%d/redeliver", deliveries[0].ID)
+	var delivery models.WebhookDelivery
+	s.call(http.MethodPost, path, adminToken, nil, http.StatusOK, &delivery)
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 0 {
+		t.Fatalf("delivery = %+v, want pending with fresh attempts", delivery)
+	}
+	s.call(http.MethodPost, path, adminToken, nil, http.StatusConflict, nil)
+
+	time.Sleep(10 * time.Millisecond) // Let the retry fall due
+	s.dispatchWebhooks(1)
+	s.call(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", endpoint.ID), adminToken, nil, http.StatusOK, &deliveries)
+	received := receiver.received()
+	if deliveries[0].Status != models.DeliveryDelivered || len(received) != 2 || received[0].ID != received[1].ID {
+		t.Fatalf("deliveries = %+v, want the same event delivered on the retry", deliveries)
+	}
+}
+
+func TestMedicineWebhookEvents(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.admin()
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	s.call(http.MethodPost, "/webhooks", adminToken, map[string]interface{}{
+		"url":    server.URL,
+		"events": []string{models.EventMedicineUpdated},
+	}, http.StatusCreated, nil)
+
+	// Every path that changes the catalog announces the medicine
+	companyID, medicineID := s.catalog(adminToken)
+	s.call(http.MethodPut, "/medicines/offer", adminToken, map[string]interface{}{"company_id": companyID, "offer": "10+1"}, http.StatusOK, nil)
+	csv := []byte("Name,Description,CompanyName\nCetirizine,Allergy,Cipla\n")
+	s.call(http.MethodPost, "/medicines/upload", adminToken, newMultipart(t, "file", "medicines.csv", csv, nil), http.StatusOK, nil)
+	s.dispatchWebhooks(3)
+
+	var offers []string
+	for _, payload := range receiver.received() {
+		var data struct {
+			MedicineID uint   `json:"medicineId"`
+			Name       string `json:"name"`
+			Offer      string `json:"offer"`
+		}
+		json.Unmarshal(payload.Data, &data)
+		offers = append(offers, fmt.Sprintf("%d %s %s", data.MedicineID, data.Name, data.Offer))
+	}
+	want := []string{
+		fmt.Sprintf("%d Paracetamol ", medicineID),
+		fmt.Sprintf("%d Paracetamol 10+1", medicineID),
+		fmt.Sprintf("%d Cetirizine ", medicineID+1),
+	}
+	if fmt.Sprint(offers) != fmt.Sprint(want) {
+		t.Fatalf("medicine.updated events = %q, want %q", offers, want)
+	}
+}
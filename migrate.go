@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pharmacy/config"
+	"pharmacy/migrations"
+	"pharmacy/models"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// runMigrate implements the "migrate up|down [n]|status" command
+func runMigrate(cfg *config.Config, db *gorm.DB, args []string) error {
+	if cfg.Database.Driver != config.DriverPostgres {
+		return errors.New("versioned migrations are only supported on postgres; sqlite databases are auto-migrated by serve")
+	}
+	if len(args) == 0 {
+		return errors.New("missing migrate action: up, down or status")
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to revert %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q", args[0])
+	}
+	return nil
+}
+
+// checkSchema makes sure the schema is current before serving. SQLite
+// development databases are auto-migrated; Postgres must be migrated
+// explicitly with "migrate up".
+func checkSchema(cfg *config.Config, db *gorm.DB) error {
+	if cfg.Database.Driver == config.DriverSQLite {
+		return models.AutoMigrate(db)
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database has %d pending migration(s), run \"migrate up\" first", len(pending))
+	}
+	return nil
+}
+
+func newMigrator(db *gorm.DB) (*migrations.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return migrations.New(sqlDB)
+}
@@ -0,0 +1,257 @@
+// Package migrations applies the numbered SQL files in sql/ to a Postgres
+// database. Applied versions are recorded in the schema_migrations table, and
+// a session-level advisory lock ensures only one process migrates at a time
+// when several replicas start together.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// advisoryLockKey identifies the migration lock in pg_advisory_lock
+const advisoryLockKey = 7265734761
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change with its up and down SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration has been applied
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Migrator applies and reverts migrations on a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a Migrator for the embedded migrations
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the most recently applied migrations, at most steps of them,
+// and returns the ones reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := run(ctx, conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration with the time it was applied, if any
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := done[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for i, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, m.migrations[i])
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+		return fmt.Errorf("could not acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// run executes a migration script and records it in one transaction
+func run(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// load reads the NNNN_name.up.sql / NNNN_name.down.sql pairs, sorted by version
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
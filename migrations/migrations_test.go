@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Fatalf("migration %d has version %d, want versions numbered from 1 without gaps", i, migration.Version)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	migrations, err := load(fstest.MapFS{
+		"sql/0002_second.up.sql":   file("CREATE TABLE b ();"),
+		"sql/0002_second.down.sql": file("DROP TABLE b;"),
+		"sql/0001_first.up.sql":    file("CREATE TABLE a ();"),
+		"sql/0001_first.down.sql":  file("DROP TABLE a;"),
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Down != "DROP TABLE b;" {
+		t.Fatalf("migrations = %+v, want first and second in order", migrations)
+	}
+
+	for name, tc := range map[string]struct {
+		fsys fstest.MapFS
+		want string
+	}{
+		"bad name": {fstest.MapFS{"sql/first.sql": file("")}, "unexpected migration file name"},
+		"no down":  {fstest.MapFS{"sql/0001_first.up.sql": file("CREATE TABLE a ();")}, "needs both an up and a down file"},
+		"conflicting names": {fstest.MapFS{
+			"sql/0001_first.up.sql":   file("CREATE TABLE a ();"),
+			"sql/0001_other.down.sql": file("DROP TABLE a;"),
+		}, "conflicting names"},
+	} {
+		if _, err := load(tc.fsys); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want %q", name, err, tc.want)
+		}
+	}
+}
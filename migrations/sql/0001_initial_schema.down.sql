@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS order_item;
+DROP TABLE IF EXISTS "order";
+DROP TABLE IF EXISTS medicine;
+DROP TABLE IF EXISTS company;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,60 @@
+-- Baseline schema as previously created by GORM AutoMigrate. Every statement
+-- is idempotent so databases that were auto-migrated can adopt versioned
+-- migrations without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT,
+    email      TEXT,
+    phone      TEXT,
+    password   TEXT,
+    firm_name  TEXT,
+    is_admin   BOOLEAN,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    updated_by TEXT,
+    CONSTRAINT uni_users_phone UNIQUE (phone)
+);
+
+CREATE TABLE IF NOT EXISTS company (
+    id           BIGSERIAL PRIMARY KEY,
+    company_name TEXT,
+    description  TEXT,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    updated_by   TEXT,
+    logo_url     TEXT
+);
+
+CREATE TABLE IF NOT EXISTS medicine (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT,
+    description TEXT,
+    company_id  BIGINT,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    updated_by  TEXT,
+    offer       TEXT,
+    CONSTRAINT fk_medicine_company FOREIGN KEY (company_id) REFERENCES company (id)
+);
+
+CREATE TABLE IF NOT EXISTS "order" (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT,
+    status     TEXT DEFAULT 'pending',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    updated_by TEXT,
+    CONSTRAINT fk_order_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS order_item (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    BIGINT,
+    medicine_id BIGINT,
+    company_id  BIGINT,
+    quantity    BIGINT,
+    CONSTRAINT fk_order_items FOREIGN KEY (order_id) REFERENCES "order" (id),
+    CONSTRAINT fk_order_item_medicine FOREIGN KEY (medicine_id) REFERENCES medicine (id),
+    CONSTRAINT fk_order_item_company FOREIGN KEY (company_id) REFERENCES company (id)
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS password_reset_token;
+DROP TABLE IF EXISTS session;
+DROP TABLE IF EXISTS otp_code;
+
+ALTER TABLE users DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE users DROP COLUMN IF EXISTS status_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
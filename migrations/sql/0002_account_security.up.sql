@@ -0,0 +1,43 @@
+-- Signup approval, OTP login, sessions and password resets
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT DEFAULT 'approved';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reviewed_by TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS otp_code (
+    id          BIGSERIAL PRIMARY KEY,
+    phone       TEXT,
+    code_hash   TEXT,
+    attempts    BIGINT,
+    expires_at  TIMESTAMPTZ,
+    consumed_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_otp_code_phone ON otp_code (phone);
+
+CREATE TABLE IF NOT EXISTS session (
+    id                  BIGSERIAL PRIMARY KEY,
+    user_id             BIGINT,
+    refresh_token_hash  TEXT,
+    previous_token_hash TEXT,
+    expires_at          TIMESTAMPTZ,
+    last_used_at        TIMESTAMPTZ,
+    revoked_at          TIMESTAMPTZ,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_session_user_id ON session (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_session_refresh_token_hash ON session (refresh_token_hash);
+CREATE INDEX IF NOT EXISTS idx_session_previous_token_hash ON session (previous_token_hash);
+
+CREATE TABLE IF NOT EXISTS password_reset_token (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT,
+    token_hash TEXT,
+    expires_at TIMESTAMPTZ,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_token_user_id ON password_reset_token (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_token_token_hash ON password_reset_token (token_hash);
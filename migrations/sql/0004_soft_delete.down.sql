@@ -0,0 +1,6 @@
+-- Soft-deleted rows become visible again once the columns are dropped;
+-- remove them first if that is not wanted.
+
+ALTER TABLE "order" DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE medicine DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE company DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,10 @@
+-- Companies, medicines and orders are soft-deleted so that past orders keep
+-- their medicines and deletions can be undone by an admin.
+
+ALTER TABLE company ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE medicine ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_company_deleted_at ON company (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_medicine_deleted_at ON medicine (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_order_deleted_at ON "order" (deleted_at);
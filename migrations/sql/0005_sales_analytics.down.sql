@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_order_item_order_id;
+DROP INDEX IF EXISTS idx_order_created_at;
+
+ALTER TABLE order_item DROP COLUMN IF EXISTS unit_price;
+ALTER TABLE medicine DROP COLUMN IF EXISTS price;
@@ -0,0 +1,9 @@
+-- Medicines get a unit price, copied onto order items when they are ordered,
+-- so sales can be reported by value. Existing rows start at 0.
+
+ALTER TABLE medicine ADD COLUMN IF NOT EXISTS price NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS unit_price NUMERIC(12, 2) NOT NULL DEFAULT 0;
+
+-- Sales reports filter orders by creation date
+CREATE INDEX IF NOT EXISTS idx_order_created_at ON "order" (created_at);
+CREATE INDEX IF NOT EXISTS idx_order_item_order_id ON order_item (order_id);
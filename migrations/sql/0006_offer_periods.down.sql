@@ -0,0 +1,4 @@
+ALTER TABLE order_item DROP COLUMN IF EXISTS free_quantity;
+ALTER TABLE order_item DROP COLUMN IF EXISTS offer;
+
+DROP TABLE IF EXISTS offer_period;
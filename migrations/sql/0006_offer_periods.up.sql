@@ -0,0 +1,26 @@
+-- Offer periods record when each offer was active on a medicine, and order
+-- items record the offer they were ordered under, for the offer report.
+
+CREATE TABLE IF NOT EXISTS offer_period (
+    id          BIGSERIAL PRIMARY KEY,
+    medicine_id BIGINT NOT NULL,
+    company_id  BIGINT NOT NULL,
+    offer       TEXT NOT NULL,
+    started_at  TIMESTAMPTZ NOT NULL,
+    ended_at    TIMESTAMPTZ,
+    started_by  TEXT,
+    CONSTRAINT fk_offer_period_medicine FOREIGN KEY (medicine_id) REFERENCES medicine (id),
+    CONSTRAINT fk_offer_period_company FOREIGN KEY (company_id) REFERENCES company (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_period_medicine_id ON offer_period (medicine_id);
+
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS offer TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS free_quantity BIGINT NOT NULL DEFAULT 0;
+
+-- Offers that are active now are assumed to have started at the medicine's last update
+INSERT INTO offer_period (medicine_id, company_id, offer, started_at, started_by)
+SELECT id, company_id, offer, COALESCE(updated_at, NOW()), updated_by
+FROM medicine
+WHERE offer <> '' AND deleted_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM offer_period WHERE offer_period.medicine_id = medicine.id);
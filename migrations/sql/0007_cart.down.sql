@@ -0,0 +1,3 @@
+ALTER TABLE medicine DROP COLUMN IF EXISTS stock;
+
+DROP TABLE IF EXISTS cart_item;
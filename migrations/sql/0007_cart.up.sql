@@ -0,0 +1,18 @@
+-- Carts are kept on the server per user; medicines get an optional stock
+-- level that the cart warns about.
+
+CREATE TABLE IF NOT EXISTS cart_item (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL,
+    medicine_id BIGINT NOT NULL,
+    quantity    BIGINT NOT NULL,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    CONSTRAINT fk_cart_item_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_cart_item_medicine FOREIGN KEY (medicine_id) REFERENCES medicine (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_item_user_medicine ON cart_item (user_id, medicine_id);
+
+-- NULL means stock is not tracked for the medicine
+ALTER TABLE medicine ADD COLUMN IF NOT EXISTS stock BIGINT;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_order_parent_id;
+
+ALTER TABLE "order" DROP CONSTRAINT IF EXISTS fk_order_children;
+ALTER TABLE "order" DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,7 @@
+-- Orders can be split into one child order per company. The parent keeps no
+-- items of its own and its status is aggregated from its children.
+
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS parent_id BIGINT;
+ALTER TABLE "order" ADD CONSTRAINT fk_order_children FOREIGN KEY (parent_id) REFERENCES "order" (id);
+
+CREATE INDEX IF NOT EXISTS idx_order_parent_id ON "order" (parent_id);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_order_backorder_of_id;
+
+ALTER TABLE "order" DROP CONSTRAINT IF EXISTS fk_order_backorder_of;
+ALTER TABLE "order" DROP CONSTRAINT IF EXISTS fk_order_backorder;
+ALTER TABLE "order" DROP COLUMN IF EXISTS backorder_of_id;
+ALTER TABLE "order" DROP COLUMN IF EXISTS backorder_id;
+
+ALTER TABLE order_item DROP COLUMN IF EXISTS backordered_quantity;
+ALTER TABLE order_item DROP COLUMN IF EXISTS cancelled_quantity;
+ALTER TABLE order_item DROP COLUMN IF EXISTS fulfilled_quantity;
@@ -0,0 +1,13 @@
+-- Order items record how many units were shipped, cancelled and backordered
+-- when the order was fulfilled; backordered units move to a new order.
+
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS fulfilled_quantity BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS cancelled_quantity BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS backordered_quantity BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS backorder_id BIGINT;
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS backorder_of_id BIGINT;
+ALTER TABLE "order" ADD CONSTRAINT fk_order_backorder FOREIGN KEY (backorder_id) REFERENCES "order" (id);
+ALTER TABLE "order" ADD CONSTRAINT fk_order_backorder_of FOREIGN KEY (backorder_of_id) REFERENCES "order" (id);
+
+CREATE INDEX IF NOT EXISTS idx_order_backorder_of_id ON "order" (backorder_of_id);
@@ -0,0 +1,8 @@
+ALTER TABLE order_item DROP COLUMN IF EXISTS reserved_quantity;
+
+ALTER TABLE "order" DROP COLUMN IF EXISTS cancel_requested_at;
+ALTER TABLE "order" DROP COLUMN IF EXISTS cancel_requested_by;
+ALTER TABLE "order" DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE "order" DROP COLUMN IF EXISTS cancelled_by;
+ALTER TABLE "order" DROP COLUMN IF EXISTS cancel_note;
+ALTER TABLE "order" DROP COLUMN IF EXISTS cancel_reason;
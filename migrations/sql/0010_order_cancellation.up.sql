@@ -0,0 +1,11 @@
+-- Orders record who cancelled them and why, or the cancellation waiting for
+-- approval. Order items record the units reserved from the medicine's stock.
+
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS cancel_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS cancel_note TEXT NOT NULL DEFAULT '';
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS cancelled_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS cancel_requested_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMPTZ;
+
+ALTER TABLE order_item ADD COLUMN IF NOT EXISTS reserved_quantity BIGINT NOT NULL DEFAULT 0;
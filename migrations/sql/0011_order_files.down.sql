@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS order_attachment;
+DROP TABLE IF EXISTS order_note;
@@ -0,0 +1,28 @@
+-- Orders get notes and file attachments. Attachment files are kept in the
+-- configured file store; the table only records where.
+
+CREATE TABLE IF NOT EXISTS order_note (
+    id         BIGSERIAL PRIMARY KEY,
+    order_id   BIGINT NOT NULL,
+    body       TEXT NOT NULL,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ,
+    CONSTRAINT fk_order_notes FOREIGN KEY (order_id) REFERENCES "order" (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_note_order_id ON order_note (order_id);
+
+CREATE TABLE IF NOT EXISTS order_attachment (
+    id           BIGSERIAL PRIMARY KEY,
+    order_id     BIGINT NOT NULL,
+    kind         TEXT NOT NULL,
+    file_name    TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size         BIGINT NOT NULL,
+    storage_key  TEXT NOT NULL,
+    uploaded_by  TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ,
+    CONSTRAINT fk_order_attachments FOREIGN KEY (order_id) REFERENCES "order" (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_attachment_order_id ON order_attachment (order_id);
@@ -0,0 +1,49 @@
+-- Webhook endpoints subscribe to event types. Events are written to the
+-- webhook_event outbox in the same transaction as the change and fanned out
+-- to one webhook_delivery per subscribed endpoint by the dispatcher.
+
+CREATE TABLE IF NOT EXISTS webhook_endpoint (
+    id          BIGSERIAL PRIMARY KEY,
+    url         TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    events      TEXT NOT NULL DEFAULT '',
+    secret      TEXT NOT NULL,
+    active      BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    updated_by  TEXT NOT NULL DEFAULT '',
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoint_deleted_at ON webhook_endpoint (deleted_at);
+
+CREATE TABLE IF NOT EXISTS webhook_event (
+    id            BIGSERIAL PRIMARY KEY,
+    type          TEXT NOT NULL,
+    payload       JSONB,
+    created_at    TIMESTAMPTZ,
+    dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_event_dispatched_at ON webhook_event (dispatched_at);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id              BIGSERIAL PRIMARY KEY,
+    event_id        BIGINT NOT NULL,
+    endpoint_id     BIGINT NOT NULL,
+    event_type      TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,
+    response_status BIGINT NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    delivered_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    CONSTRAINT fk_webhook_delivery_event FOREIGN KEY (event_id) REFERENCES webhook_event (id),
+    CONSTRAINT fk_webhook_delivery_endpoint FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoint (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_event_id ON webhook_delivery (event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_endpoint_id ON webhook_delivery (endpoint_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_next_attempt_at ON webhook_delivery (next_attempt_at);
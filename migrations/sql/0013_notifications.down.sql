@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS notification;
+DROP TABLE IF EXISTS notification_event;
+DROP TABLE IF EXISTS user_device;
+DROP TABLE IF EXISTS notification_preference;
+DROP TABLE IF EXISTS notification_template;
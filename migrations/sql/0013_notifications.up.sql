@@ -0,0 +1,72 @@
+-- Order and offer changes write to the notification_event outbox in the same
+-- transaction. The dispatcher turns each event into one notification per
+-- recipient and channel, which is retried until sent and kept as the user's
+-- history.
+
+CREATE TABLE IF NOT EXISTS notification_template (
+    id         BIGSERIAL PRIMARY KEY,
+    event      TEXT NOT NULL,
+    channel    TEXT NOT NULL,
+    subject    TEXT NOT NULL DEFAULT '',
+    body       TEXT NOT NULL,
+    updated_at TIMESTAMPTZ,
+    updated_by TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notification_template_event_channel ON notification_template (event, channel);
+
+CREATE TABLE IF NOT EXISTS notification_preference (
+    user_id BIGINT NOT NULL,
+    event   TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, event, channel),
+    CONSTRAINT fk_notification_preference_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS user_device (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    token      TEXT NOT NULL,
+    platform   TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    CONSTRAINT fk_user_device_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_device_user_id ON user_device (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_device_token ON user_device (token);
+
+CREATE TABLE IF NOT EXISTS notification_event (
+    id            BIGSERIAL PRIMARY KEY,
+    type          TEXT NOT NULL,
+    user_id       BIGINT,
+    payload       JSONB,
+    created_at    TIMESTAMPTZ,
+    dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_event_dispatched_at ON notification_event (dispatched_at);
+
+CREATE TABLE IF NOT EXISTS notification (
+    id              BIGSERIAL PRIMARY KEY,
+    user_id         BIGINT NOT NULL,
+    event_id        BIGINT NOT NULL,
+    event           TEXT NOT NULL,
+    channel         TEXT NOT NULL,
+    subject         TEXT NOT NULL DEFAULT '',
+    body            TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL,
+    attempts        BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,
+    last_error      TEXT NOT NULL DEFAULT '',
+    sent_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    CONSTRAINT fk_notification_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_notification_event FOREIGN KEY (event_id) REFERENCES notification_event (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_user_id ON notification (user_id);
+CREATE INDEX IF NOT EXISTS idx_notification_event_id ON notification (event_id);
+CREATE INDEX IF NOT EXISTS idx_notification_next_attempt_at ON notification (next_attempt_at);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_notification_campaign_id;
+ALTER TABLE notification DROP COLUMN IF EXISTS campaign_id;
+ALTER TABLE notification_event DROP COLUMN IF EXISTS campaign_id;
+
+DROP TABLE IF EXISTS campaign;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
+ALTER TABLE users DROP COLUMN IF EXISTS city;
@@ -0,0 +1,36 @@
+-- Offer campaigns target customers by city, tier and past purchases. Sending
+-- a campaign writes one notification_event; its notifications carry the
+-- campaign so delivery and attributed orders can be reported.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS city TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS campaign (
+    id               BIGSERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    company_id       BIGINT NOT NULL,
+    medicine_id      BIGINT,
+    offer            TEXT NOT NULL,
+    subject          TEXT NOT NULL DEFAULT '',
+    body             TEXT NOT NULL DEFAULT '',
+    channels         TEXT NOT NULL DEFAULT '',
+    cities           TEXT NOT NULL DEFAULT '',
+    tiers            TEXT NOT NULL DEFAULT '',
+    past_purchasers  BOOLEAN NOT NULL DEFAULT FALSE,
+    attribution_days BIGINT NOT NULL,
+    status           TEXT NOT NULL,
+    sent_at          TIMESTAMPTZ,
+    sent_by          TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    updated_by       TEXT NOT NULL DEFAULT '',
+    CONSTRAINT fk_campaign_company FOREIGN KEY (company_id) REFERENCES company (id),
+    CONSTRAINT fk_campaign_medicine FOREIGN KEY (medicine_id) REFERENCES medicine (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_campaign_company_id ON campaign (company_id);
+
+ALTER TABLE notification_event ADD COLUMN IF NOT EXISTS campaign_id BIGINT REFERENCES campaign (id);
+ALTER TABLE notification ADD COLUMN IF NOT EXISTS campaign_id BIGINT REFERENCES campaign (id);
+
+CREATE INDEX IF NOT EXISTS idx_notification_campaign_id ON notification (campaign_id);
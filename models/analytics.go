@@ -0,0 +1,355 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dimensions a sales report can be grouped by
+const (
+	SalesGroupCompany  = "company"
+	SalesGroupMedicine = "medicine"
+	SalesGroupFirm     = "firm"
+	SalesGroupPeriod   = "period"
+)
+
+// Time buckets for reports grouped by period
+const (
+	SalesPeriodDay   = "day"
+	SalesPeriodWeek  = "week"
+	SalesPeriodMonth = "month"
+)
+
+// SalesQuery selects the orders aggregated by a sales report. Orders are
+// included when From <= created_at < To.
+type SalesQuery struct {
+	GroupBy  string
+	Period   string // Bucket size when GroupBy is SalesGroupPeriod
+	From     time.Time
+	To       time.Time
+	Statuses []string // Order statuses to include
+	Limit    int      // Top-N rows by value; ignored when grouping by period
+}
+
+// SalesFigures are the totals of a set of order items
+type SalesFigures struct {
+	Quantity int64   `json:"quantity"`
+	Value    float64 `json:"value"`
+	Orders   int64   `json:"orders"`
+}
+
+// SalesComparison holds figures for the requested range together with the
+// figures they are compared against
+type SalesComparison struct {
+	SalesFigures
+	Previous       SalesFigures `json:"previous"`
+	QuantityGrowth *float64     `json:"quantityGrowthPercent"` // nil when there is nothing to compare against
+	ValueGrowth    *float64     `json:"valueGrowthPercent"`
+}
+
+// SalesRow is one company, medicine, firm or time bucket of a sales report
+type SalesRow struct {
+	ID          uint   `json:"id,omitempty"`
+	Name        string `json:"name"` // Bucket start date (YYYY-MM-DD) when grouping by period
+	CompanyName string `json:"companyName,omitempty"`
+	SalesComparison
+}
+
+// SalesReport is the result of a sales query. Rows are compared with the same
+// entity in the previous range of equal length, or with the preceding bucket
+// when grouping by period.
+type SalesReport struct {
+	GroupBy      string          `json:"groupBy"`
+	Period       string          `json:"period,omitempty"`
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	PreviousFrom string          `json:"previousFrom"`
+	PreviousTo   string          `json:"previousTo"`
+	Statuses     []string        `json:"statuses"`
+	Totals       SalesComparison `json:"totals"`
+	Rows         []SalesRow      `json:"rows"`
+}
+
+// salesDimension describes how order items are grouped for one SalesGroup* value
+type salesDimension struct {
+	key     string // Column identifying a row, used to fetch previous figures
+	columns string // Selects id, name and company_name
+	groupBy string
+	joins   []string
+}
+
+// salesRecord is a row scanned from an aggregation query
+type salesRecord struct {
+	ID          uint
+	Name        string
+	CompanyName string
+	Quantity    int64
+	Value       float64
+	Orders      int64
+}
+
+// salesRepo is the GORM implementation of SalesRepo
+type salesRepo struct {
+	db *gorm.DB
+}
+
+// NewSalesRepo creates a SalesRepo backed by the given connection
+func NewSalesRepo(db *gorm.DB) SalesRepo {
+	return &salesRepo{db: db}
+}
+
+// Report aggregates the quantity and value of order items for the query
+func (r *salesRepo) Report(q SalesQuery) (*SalesReport, error) {
+	previousFrom := q.From.Add(-q.To.Sub(q.From))
+
+	report := &SalesReport{
+		GroupBy:      q.GroupBy,
+		From:         q.From.Format("2006-01-02"),
+		To:           q.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		PreviousFrom: previousFrom.Format("2006-01-02"),
+		PreviousTo:   q.From.AddDate(0, 0, -1).Format("2006-01-02"),
+		Statuses:     q.Statuses,
+		Rows:         []SalesRow{},
+	}
+
+	current, err := r.totals(q, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := r.totals(q, previousFrom, q.From)
+	if err != nil {
+		return nil, err
+	}
+	report.Totals = compareSales(current, previous)
+
+	if q.GroupBy == SalesGroupPeriod {
+		report.Period = q.Period
+		report.Rows, err = r.periodRows(q)
+	} else {
+		report.Rows, err = r.rankedRows(q, previousFrom)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// totals sums all order items in [from, to)
+func (r *salesRepo) totals(q SalesQuery, from, to time.Time) (SalesFigures, error) {
+	var record salesRecord
+	err := r.salesQuery(q, from, to).
+		Select("COALESCE(SUM(" + netQuantitySQL + "), 0) AS quantity, " +
+			"COALESCE(SUM(" + netQuantitySQL + " * oi.unit_price), 0) AS value, " +
+			"COUNT(DISTINCT oi.order_id) AS orders").
+		Scan(&record).Error
+	return record.figures(), err
+}
+
+// rankedRows returns the top rows by value for a company, medicine or firm
+// grouping, each compared with its figures in the previous range
+func (r *salesRepo) rankedRows(q SalesQuery, previousFrom time.Time) ([]SalesRow, error) {
+	dim := salesDimensions[q.GroupBy]
+
+	current, err := r.group(q, dim, q.From, q.To, func(db *gorm.DB) *gorm.DB {
+		return db.Order("value DESC, quantity DESC, id").Limit(q.Limit)
+	})
+	if err != nil || len(current) == 0 {
+		return []SalesRow{}, err
+	}
+
+	ids := make([]uint, 0, len(current))
+	for _, record := range current {
+		ids = append(ids, record.ID)
+	}
+	previous, err := r.group(q, dim, previousFrom, q.From, func(db *gorm.DB) *gorm.DB {
+		return db.Where(dim.key+" IN ?", ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	previousByID := make(map[uint]SalesFigures, len(previous))
+	for _, record := range previous {
+		previousByID[record.ID] = record.figures()
+	}
+
+	rows := make([]SalesRow, 0, len(current))
+	for _, record := range current {
+		rows = append(rows, SalesRow{
+			ID:              record.ID,
+			Name:            record.Name,
+			CompanyName:     record.CompanyName,
+			SalesComparison: compareSales(record.figures(), previousByID[record.ID]),
+		})
+	}
+	return rows, nil
+}
+
+// periodRows returns one row per time bucket in the range, including buckets
+// without sales, each compared with the bucket before it
+func (r *salesRepo) periodRows(q SalesQuery) ([]SalesRow, error) {
+	bucket := r.bucketExpression(q.Period)
+	dim := salesDimension{
+		columns: bucket + " AS name",
+		groupBy: bucket,
+	}
+
+	records, err := r.group(q, dim, q.From, q.To, nil)
+	if err != nil {
+		return nil, err
+	}
+	byBucket := make(map[string]SalesFigures, len(records))
+	for _, record := range records {
+		byBucket[record.Name] = record.figures()
+	}
+
+	rows := []SalesRow{}
+	var previous *SalesFigures
+	for start := salesBucketStart(q.From, q.Period); start.Before(q.To); start = nextSalesBucket(start, q.Period) {
+		name := start.Format("2006-01-02")
+		figures := byBucket[name]
+
+		row := SalesRow{Name: name, SalesComparison: SalesComparison{SalesFigures: figures}}
+		if previous != nil {
+			row.SalesComparison = compareSales(figures, *previous)
+		}
+		rows = append(rows, row)
+		previous = &figures
+	}
+	return rows, nil
+}
+
+// group runs the aggregation for a dimension over [from, to)
+func (r *salesRepo) group(q SalesQuery, dim salesDimension, from, to time.Time, scope func(*gorm.DB) *gorm.DB) ([]salesRecord, error) {
+	query := r.salesQuery(q, from, to).
+		Select(dim.columns + ", SUM(" + netQuantitySQL + ") AS quantity, " +
+			"SUM(" + netQuantitySQL + " * oi.unit_price) AS value, " +
+			"COUNT(DISTINCT oi.order_id) AS orders").
+		Group(dim.groupBy)
+	for _, join := range dim.joins {
+		query = query.Joins(join)
+	}
+	if scope != nil {
+		query = scope(query)
+	}
+
+	var records []salesRecord
+	if err := query.Scan(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// salesQuery selects the order items of live orders created in [from, to)
+// with one of the requested statuses
+func (r *salesRepo) salesQuery(q SalesQuery, from, to time.Time) *gorm.DB {
+	query := r.db.Table("order_item AS oi").
+		Joins(`JOIN "order" o ON o.id = oi.order_id`).
+		Where("o.deleted_at IS NULL AND o.created_at >= ? AND o.created_at < ?", from.UTC(), to.UTC())
+	if len(q.Statuses) > 0 {
+		query = query.Where("o.status IN ?", q.Statuses)
+	}
+	return query
+}
+
+// bucketExpression returns the SQL for the start date of an order's time
+// bucket as YYYY-MM-DD in UTC. Weeks start on Monday.
+func (r *salesRepo) bucketExpression(period string) string {
+	if r.db.Dialector.Name() == "postgres" {
+		switch period {
+		case SalesPeriodWeek:
+			return "to_char(date_trunc('week', o.created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD')"
+		case SalesPeriodMonth:
+			return "to_char(date_trunc('month', o.created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD')"
+		}
+		return "to_char(o.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	}
+
+	switch period {
+	case SalesPeriodWeek:
+		return "date(o.created_at, '-6 days', 'weekday 1')"
+	case SalesPeriodMonth:
+		return "strftime('%Y-%m-01', o.created_at)"
+	}
+	return "date(o.created_at)"
+}
+
+// salesDimensions maps the company, medicine and firm groupings to their
+// columns. Joins are not scoped so deleted entities keep their sales.
+var salesDimensions = map[string]salesDimension{
+	SalesGroupCompany: {
+		key:     "c.id",
+		columns: "c.id AS id, c.company_name AS name",
+		groupBy: "c.id, c.company_name",
+		joins:   []string{"JOIN company c ON c.id = oi.company_id"},
+	},
+	SalesGroupMedicine: {
+		key:     "m.id",
+		columns: "m.id AS id, m.name AS name, c.company_name AS company_name",
+		groupBy: "m.id, m.name, c.company_name",
+		joins: []string{
+			"JOIN medicine m ON m.id = oi.medicine_id",
+			"JOIN company c ON c.id = oi.company_id",
+		},
+	},
+	SalesGroupFirm: {
+		key:     "u.id",
+		columns: "u.id AS id, COALESCE(NULLIF(u.firm_name, ''), u.name) AS name",
+		groupBy: "u.id, u.firm_name, u.name",
+		joins:   []string{"JOIN users u ON u.id = o.user_id"},
+	},
+}
+
+// salesBucketStart returns the start of the UTC time bucket containing t
+func salesBucketStart(t time.Time, period string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case SalesPeriodWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case SalesPeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// nextSalesBucket returns the start of the bucket after the one starting at start
+func nextSalesBucket(start time.Time, period string) time.Time {
+	switch period {
+	case SalesPeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case SalesPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func (s salesRecord) figures() SalesFigures {
+	return SalesFigures{
+		Quantity: s.Quantity,
+		Value:    math.Round(s.Value*100) / 100,
+		Orders:   s.Orders,
+	}
+}
+
+// compareSales computes the growth of current over previous
+func compareSales(current, previous SalesFigures) SalesComparison {
+	return SalesComparison{
+		SalesFigures:   current,
+		Previous:       previous,
+		QuantityGrowth: growthPercent(float64(current.Quantity), float64(previous.Quantity)),
+		ValueGrowth:    growthPercent(current.Value, previous.Value),
+	}
+}
+
+// growthPercent returns the change from previous to current in percent,
+// rounded to one decimal, or nil if previous is zero
+func growthPercent(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	growth := math.Round((current-previous)/previous*1000) / 10
+	return &growth
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of files attached to an order
+const (
+	AttachmentKindPurchaseOrder = "purchase_order"
+	AttachmentKindPrescription  = "prescription"
+	AttachmentKindOther         = "other"
+)
+
+// OrderNote is an instruction or remark added to an order, such as
+// "deliver after 5pm". Notes cannot be changed once added.
+type OrderNote struct {
+	ID        uint      `json:"noteId" gorm:"primaryKey"`
+	OrderID   uint      `json:"-" gorm:"index"`
+	Body      string    `json:"body"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM to use
+func (OrderNote) TableName() string {
+	return "order_note"
+}
+
+// OrderAttachment is a file attached to an order, such as a purchase order
+// PDF or a prescription image. The file itself is kept in the file store
+// under StorageKey.
+type OrderAttachment struct {
+	ID          uint      `json:"attachmentId" gorm:"primaryKey"`
+	OrderID     uint      `json:"-" gorm:"index"`
+	Kind        string    `json:"kind"`
+	FileName    string    `json:"fileName"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	StorageKey  string    `json:"-"`
+	UploadedBy  string    `json:"uploadedBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM to use
+func (OrderAttachment) TableName() string {
+	return "order_attachment"
+}
+
+// AddNote adds a note to an order
+func (r *orderRepo) AddNote(orderID uint, body string, actor Actor) (*OrderNote, error) {
+	var note *OrderNote
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&Order{}, orderID).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		var err error
+		note, err = createOrderNote(tx, orderID, body, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// createOrderNote inserts a note and records it in the audit log of the order
+func createOrderNote(tx *gorm.DB, orderID uint, body string, actor Actor) (*OrderNote, error) {
+	note := &OrderNote{
+		OrderID:   orderID,
+		Body:      body,
+		CreatedBy: actor.String(),
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(note).Error; err != nil {
+		return nil, err
+	}
+	err := recordAudit(tx, actor, AuditEntityOrder, orderID, AuditActionNote, nil, map[string]interface{}{"note": body})
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// AddAttachment records a file that was put in the file store for an order
+func (r *orderRepo) AddAttachment(attachment *OrderAttachment, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&Order{}, attachment.OrderID).Error; err != nil {
+			return dbError(err, "Order")
+		}
+
+		attachment.UploadedBy = actor.String()
+		attachment.CreatedAt = time.Now()
+		if err := tx.Create(attachment).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityOrder, attachment.OrderID, AuditActionAttach, nil, attachmentAuditState(attachment))
+	})
+}
+
+// GetAttachment retrieves an attachment of an order
+func (r *orderRepo) GetAttachment(orderID, attachmentID uint) (*OrderAttachment, error) {
+	var attachment OrderAttachment
+	if err := r.db.Where("order_id = ?", orderID).First(&attachment, attachmentID).Error; err != nil {
+		return nil, dbError(err, "Attachment")
+	}
+	return &attachment, nil
+}
+
+// DeleteAttachment removes an attachment from an order and returns it, so
+// that the caller can remove the file from the file store
+func (r *orderRepo) DeleteAttachment(orderID, attachmentID uint, actor Actor) (*OrderAttachment, error) {
+	var attachment OrderAttachment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("order_id = ?", orderID).First(&attachment, attachmentID).Error; err != nil {
+			return dbError(err, "Attachment")
+		}
+		if err := tx.Delete(&OrderAttachment{}, attachment.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityOrder, orderID, AuditActionDetach, attachmentAuditState(&attachment), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// attachmentAuditState is the part of an attachment recorded in the audit log
+func attachmentAuditState(attachment *OrderAttachment) map[string]interface{} {
+	return map[string]interface{}{
+		"attachment_id": attachment.ID,
+		"kind":          attachment.Kind,
+		"file_name":     attachment.FileName,
+		"size":          attachment.Size,
+	}
+}
@@ -0,0 +1,275 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entity types recorded in the audit log
+const (
+	AuditEntityUser     = "user"
+	AuditEntityCompany  = "company"
+	AuditEntityMedicine = "medicine"
+	AuditEntityOrder    = "order"
+	AuditEntityWebhook  = "webhook"
+	AuditEntityCampaign = "campaign"
+
+	AuditEntityNotificationTemplate = "notification_template"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionCreate         = "create"
+	AuditActionUpdate         = "update"
+	AuditActionDelete         = "delete"
+	AuditActionRestore        = "restore"
+	AuditActionApprove        = "approve"
+	AuditActionReject         = "reject"
+	AuditActionPasswordChange = "password_change"
+	AuditActionStatusChange   = "status_change"
+	AuditActionOfferChange    = "offer_change"
+	AuditActionSplit          = "split"
+	AuditActionFulfil         = "fulfil"
+	AuditActionCancel         = "cancel"
+	AuditActionCancelRequest  = "cancel_request"
+	AuditActionCancelReject   = "cancel_reject"
+	AuditActionNote           = "note"
+	AuditActionAttach         = "attach"
+	AuditActionDetach         = "detach"
+	AuditActionRedeliver      = "redeliver"
+	AuditActionSend           = "send"
+)
+
+// Actor identifies who made a change. It is stored as UpdatedBy on the
+// changed row and as the actor of its audit record.
+type Actor struct {
+	UserID uint   // Authenticated user, or 0 for anonymous callers and system tasks
+	Name   string // Label for non-user actors, e.g. "cli"
+	IP     string
+}
+
+// UserActor returns the actor for an authenticated user
+func UserActor(userID uint, ip string) Actor {
+	return Actor{UserID: userID, IP: ip}
+}
+
+// SystemActor returns the actor for changes not made by a user, e.g. "cli"
+func SystemActor(name string) Actor {
+	return Actor{Name: name}
+}
+
+// String returns the UpdatedBy value for the actor, e.g. "user_12"
+func (a Actor) String() string {
+	if a.UserID != 0 {
+		return "user_" + strconv.Itoa(int(a.UserID))
+	}
+	if a.Name != "" {
+		return a.Name
+	}
+	return "anonymous"
+}
+
+// AuditLog is an immutable record of one change to a user, company, medicine
+// or order. Before and After hold only the fields that changed.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	EntityType string    `json:"entity_type" gorm:"index:idx_audit_log_entity"`
+	EntityID   uint      `json:"entity_id" gorm:"index:idx_audit_log_entity"`
+	Action     string    `json:"action"`
+	ActorID    *uint     `json:"actor_id"`
+	Actor      string    `json:"actor"`
+	IP         string    `json:"ip"`
+	Before     AuditJSON `json:"before"`
+	After      AuditJSON `json:"after"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName specifies the table name for GORM to use
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+// AuditJSON is a JSON object stored in the database and returned verbatim in responses
+type AuditJSON string
+
+// MarshalJSON writes the stored document as-is, or null when empty
+func (j AuditJSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// Value stores the document as text
+func (j AuditJSON) Value() (driver.Value, error) {
+	if j == "" {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan reads the document from a text or JSON column
+func (j *AuditJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = ""
+	case string:
+		*j = AuditJSON(v)
+	case []byte:
+		*j = AuditJSON(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("cannot scan %T into AuditJSON: %w", value, err)
+		}
+		*j = AuditJSON(data)
+	}
+	return nil
+}
+
+// Fields left out of the audit diff because they change on every write
+// or are derived from other fields
+var auditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"updated_by": true,
+	"company":    true,
+	"medicine":   true,
+	"user":       true,
+}
+
+// Fields whose values are never written to the audit log
+var auditRedactedFields = map[string]bool{
+	"password": true,
+	"secret":   true,
+}
+
+// recordAudit writes an audit record for a change using tx, so that it is
+// committed or rolled back together with the change. before is nil for
+// creates and after is nil for deletes; updates that change nothing are not
+// recorded.
+func recordAudit(tx *gorm.DB, actor Actor, entityType string, entityID uint, action string, before, after interface{}) error {
+	beforeFields, afterFields, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	if before != nil && after != nil && len(beforeFields) == 0 && len(afterFields) == 0 {
+		return nil
+	}
+
+	entry := AuditLog{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Actor:      actor.String(),
+		IP:         actor.IP,
+	}
+	if actor.UserID != 0 {
+		actorID := actor.UserID
+		entry.ActorID = &actorID
+	}
+	if entry.Before, err = auditDocument(beforeFields, before != nil); err != nil {
+		return err
+	}
+	if entry.After, err = auditDocument(afterFields, after != nil); err != nil {
+		return err
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// auditDiff returns the fields of before and after that differ
+func auditDiff(before, after interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key, value := range beforeFields {
+		if afterValue, ok := afterFields[key]; ok && reflect.DeepEqual(value, afterValue) {
+			delete(beforeFields, key)
+			delete(afterFields, key)
+		}
+	}
+
+	for key := range auditRedactedFields {
+		if _, ok := beforeFields[key]; ok {
+			beforeFields[key] = "[redacted]"
+		}
+		if _, ok := afterFields[key]; ok {
+			afterFields[key] = "[redacted]"
+		}
+	}
+
+	return beforeFields, afterFields, nil
+}
+
+// auditFields converts an entity into its JSON fields, without the ignored ones
+func auditFields(entity interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if entity == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for key := range auditIgnoredFields {
+		delete(fields, key)
+	}
+	return fields, nil
+}
+
+func auditDocument(fields map[string]interface{}, present bool) (AuditJSON, error) {
+	if !present {
+		return "", nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return AuditJSON(data), nil
+}
+
+// auditRepo is the GORM implementation of AuditRepo
+type auditRepo struct {
+	db *gorm.DB
+}
+
+// NewAuditRepo creates an AuditRepo backed by the given connection
+func NewAuditRepo(db *gorm.DB) AuditRepo {
+	return &auditRepo{db: db}
+}
+
+// List returns the newest audit records first, optionally restricted to an
+// entity type and ID
+func (r *auditRepo) List(entityType string, entityID uint, limit int) ([]AuditLog, error) {
+	query := r.db.Order("created_at desc, id desc").Limit(limit)
+	if entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID != 0 {
+		query = query.Where("entity_id = ?", entityID)
+	}
+
+	var entries []AuditLog
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"pharmacy/config"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Errors returned by Authenticate for accounts that may not log in
+var (
+	ErrAccountPendingApproval = errors.New("account is pending approval")
+	ErrAccountRejected        = errors.New("account has been rejected")
+)
+
+// AuthService handles logins, sessions, OTPs and password changes. Sessions,
+// OTP codes and reset tokens are stored through its own connection; user
+// accounts go through the UserRepo.
+type AuthService struct {
+	db       *gorm.DB
+	users    UserRepo
+	jwt      config.JWTConfig
+	sms      SMSSender
+	notifier Notifier
+}
+
+// NewAuthService creates an AuthService. OTPs are sent through sms and
+// password reset tokens through notifier.
+func NewAuthService(db *gorm.DB, users UserRepo, jwtConfig config.JWTConfig, sms SMSSender, notifier Notifier) *AuthService {
+	return &AuthService{
+		db:       db,
+		users:    users,
+		jwt:      jwtConfig,
+		sms:      sms,
+		notifier: notifier,
+	}
+}
+
+// GenerateJWT creates a short-lived access token for the given user and session
+func (a *AuthService) GenerateJWT(user *User, sessionID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"userId":   user.ID,
+		"sid":      sessionID,
+		"name":     user.Name,
+		"email":    user.Email,
+		"phone":    user.Phone,
+		"firmName": user.FirmName,
+		"isAdmin":  user.IsAdmin,
+		"iss":      a.jwt.Issuer,
+		"exp":      time.Now().Add(a.jwt.AccessTokenTTL).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(a.jwt.Secret))
+}
+
+// ParseAccessToken validates an access token's signature, issuer, expiry and
+// session, and returns its claims
+func (a *AuthService) ParseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(a.jwt.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidAccessToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !claims.VerifyIssuer(a.jwt.Issuer, a.jwt.Issuer != "") {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if err := a.CheckSessionClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Authenticate authenticates a user by phone and password and starts a new session
+func (a *AuthService) Authenticate(identifier, password string) (*TokenPair, *User, error) {
+	user, err := a.users.GetByPhone(identifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, nil, err // Invalid password
+	}
+
+	// The user is still returned so the caller can report the rejection reason
+	if err := checkCanLogin(user); err != nil {
+		return nil, user, err
+	}
+
+	tokens, err := a.CreateSession(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// RejectUser marks an account as rejected with the given reason and ends its sessions
+func (a *AuthService) RejectUser(id uint, reason string, actor Actor) (*User, error) {
+	user, err := a.users.Reject(id, reason, actor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.RevokeUserSessions(id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateUser updates an account and ends its sessions when the admin role
+// was granted or taken away, so that tokens carrying the old role stop working
+func (a *AuthService) UpdateUser(id uint, name, phone, firmName, city string, tier *string, isAdmin *bool, actor Actor) (*User, error) {
+	before, err := a.users.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.users.Update(id, name, phone, firmName, city, tier, isAdmin, actor)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsAdmin != before.IsAdmin {
+		if _, err := a.RevokeUserSessions(id); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,533 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Campaign statuses
+const (
+	CampaignDraft = "draft" // Can still be edited, previewed or deleted
+	CampaignSent  = "sent"
+)
+
+// defaultAttributionDays is how long orders are attributed to a campaign
+// when it does not say
+const defaultAttributionDays = 14
+
+// campaignPreviewSamples is the number of recipients whose messages are
+// shown in a preview
+const campaignPreviewSamples = 3
+
+// Campaign promotes the offer of a company, or of one of its medicines, to a
+// targeted audience of customers through the notification channels. The
+// targeting filters are combined; a campaign without filters reaches every
+// approved customer.
+type Campaign struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Name            string     `json:"name"`
+	CompanyID       uint       `json:"company_id" gorm:"index"`
+	MedicineID      *uint      `json:"medicine_id"` // nil for an offer on the whole company
+	Offer           string     `json:"offer"`
+	Subject         string     `json:"subject"`          // Empty uses the offer.campaign template
+	Body            string     `json:"body"`             // Empty uses the offer.campaign template
+	Channels        StringList `json:"channels"`         // Empty uses each customer's offer.campaign channels
+	Cities          StringList `json:"cities"`           // Customer cities, ignoring case
+	Tiers           StringList `json:"tiers"`            // Customer tiers, ignoring case
+	PastPurchasers  bool       `json:"past_purchasers"`  // Only customers who ordered from the company before
+	AttributionDays int        `json:"attribution_days"` // Days after sending during which orders count for the campaign
+	Status          string     `json:"status"`
+	SentAt          *time.Time `json:"sent_at"`
+	SentBy          string     `json:"sent_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	UpdatedBy       string     `json:"updated_by"`
+}
+
+// TableName specifies the table name for GORM to use
+func (Campaign) TableName() string {
+	return "campaign"
+}
+
+// CampaignPreview shows who a campaign would reach and what they would receive
+type CampaignPreview struct {
+	Audience   int64             `json:"audience"`   // Customers matching the targeting
+	Recipients int               `json:"recipients"` // Customers reachable on at least one channel
+	Messages   map[string]int    `json:"messages"`   // Notifications per channel
+	Samples    []CampaignMessage `json:"samples"`
+}
+
+// CampaignMessage is the message a customer would receive on a channel
+type CampaignMessage struct {
+	UserID   uint   `json:"userId"`
+	Name     string `json:"name"`
+	FirmName string `json:"firmName"`
+	Channel  string `json:"channel"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+}
+
+// CampaignDelivery counts a campaign's notifications on a channel by status
+type CampaignDelivery struct {
+	Pending   int64 `json:"pending"`
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+}
+
+// CampaignReport measures the delivery of a sent campaign and the orders
+// that followed it. An order is attributed to the campaign when a customer
+// who received it placed the order before the attribution window closed,
+// with at least one line of the campaign's company or medicine. Only those
+// lines are counted; backorders are left out as they deliver units ordered
+// earlier.
+type CampaignReport struct {
+	CampaignID        uint                        `json:"campaignId"`
+	SentAt            time.Time                   `json:"sentAt"`
+	AttributionEndsAt time.Time                   `json:"attributionEndsAt"`
+	Recipients        int64                       `json:"recipients"` // Customers with at least one notification
+	Reached           int64                       `json:"reached"`    // Customers with at least one delivered notification
+	Channels          map[string]CampaignDelivery `json:"channels"`
+	Orders            int64                       `json:"orders"`    // Attributed customer orders
+	Customers         int64                       `json:"customers"` // Reached customers who ordered
+	Quantity          int64                       `json:"quantity"`
+	Revenue           float64                     `json:"revenue"`
+	Conversion        *float64                    `json:"conversionPercent"` // Customers out of reached customers
+}
+
+// campaignRepo is the GORM implementation of CampaignRepo
+type campaignRepo struct {
+	db *gorm.DB
+}
+
+// NewCampaignRepo creates a CampaignRepo backed by the given connection
+func NewCampaignRepo(db *gorm.DB) CampaignRepo {
+	return &campaignRepo{db: db}
+}
+
+// Create saves a draft campaign. The company and offer default to those of
+// the medicine.
+func (r *campaignRepo) Create(campaign Campaign, actor Actor) (*Campaign, error) {
+	campaign.ID = 0
+	campaign.Status = CampaignDraft
+	campaign.SentAt = nil
+	campaign.SentBy = ""
+	campaign.UpdatedBy = actor.String()
+	if campaign.AttributionDays == 0 {
+		campaign.AttributionDays = defaultAttributionDays
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := campaignData(tx, &campaign); err != nil {
+			return err
+		}
+		if err := tx.Create(&campaign).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityCampaign, campaign.ID, AuditActionCreate, nil, &campaign)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// Get retrieves a campaign
+func (r *campaignRepo) Get(id uint) (*Campaign, error) {
+	var campaign Campaign
+	if err := r.db.First(&campaign, id).Error; err != nil {
+		return nil, dbError(err, "Campaign")
+	}
+	return &campaign, nil
+}
+
+// List retrieves the newest campaigns first, optionally only those with the
+// given status
+func (r *campaignRepo) List(status string) ([]Campaign, error) {
+	query := r.db.Order("id desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var campaigns []Campaign
+	if err := query.Find(&campaigns).Error; err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+// Update replaces the offer, message and targeting of a draft campaign
+func (r *campaignRepo) Update(id uint, changes Campaign, actor Actor) (*Campaign, error) {
+	var campaign Campaign
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&campaign, id).Error; err != nil {
+			return dbError(err, "Campaign")
+		}
+		if campaign.Status != CampaignDraft {
+			return NewConflictError("Campaign has already been sent")
+		}
+		before := campaign
+
+		campaign.Name = changes.Name
+		campaign.CompanyID = changes.CompanyID
+		campaign.MedicineID = changes.MedicineID
+		campaign.Offer = changes.Offer
+		campaign.Subject = changes.Subject
+		campaign.Body = changes.Body
+		campaign.Channels = changes.Channels
+		campaign.Cities = changes.Cities
+		campaign.Tiers = changes.Tiers
+		campaign.PastPurchasers = changes.PastPurchasers
+		campaign.AttributionDays = changes.AttributionDays
+		if campaign.AttributionDays == 0 {
+			campaign.AttributionDays = defaultAttributionDays
+		}
+		campaign.UpdatedBy = actor.String()
+		campaign.UpdatedAt = time.Now()
+		if _, err := campaignData(tx, &campaign); err != nil {
+			return err
+		}
+		if err := tx.Save(&campaign).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityCampaign, campaign.ID, AuditActionUpdate, &before, &campaign)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// Delete removes a draft campaign. Sent campaigns are kept with their
+// notifications.
+func (r *campaignRepo) Delete(id uint, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var campaign Campaign
+		if err := tx.First(&campaign, id).Error; err != nil {
+			return dbError(err, "Campaign")
+		}
+		if campaign.Status != CampaignDraft {
+			return NewConflictError("Campaign has already been sent")
+		}
+		if err := tx.Delete(&Campaign{}, id).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityCampaign, id, AuditActionDelete, &campaign, nil)
+	})
+}
+
+// Preview counts the customers a campaign would reach on each channel and
+// renders the messages of the first few
+func (r *campaignRepo) Preview(id uint) (*CampaignPreview, error) {
+	campaign, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := campaignData(r.db, campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &CampaignPreview{Messages: map[string]int{}}
+	if err := campaign.audience(r.db).Count(&preview.Audience).Error; err != nil {
+		return nil, err
+	}
+	recipients, err := notificationRecipients(r.db, NotificationEvent{Type: EventOfferCampaign}, campaign)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := loadNotificationTemplates(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.Recipients = len(recipients)
+	preview.Samples = []CampaignMessage{}
+	for i, recipient := range recipients {
+		for _, channel := range recipient.channels {
+			preview.Messages[channel]++
+			if i >= campaignPreviewSamples {
+				continue
+			}
+
+			message := CampaignMessage{UserID: recipient.user.ID, Name: recipient.user.Name, FirmName: recipient.user.FirmName, Channel: channel}
+			tmpl := campaign.messageTemplate(templates, channel)
+			if message.Subject, err = renderNotification(tmpl.Subject, data, &recipient.user); err != nil {
+				return nil, NewValidationError("subject", templateProblem(err))
+			}
+			if message.Body, err = renderNotification(tmpl.Body, data, &recipient.user); err != nil {
+				return nil, NewValidationError("body", templateProblem(err))
+			}
+			preview.Samples = append(preview.Samples, message)
+		}
+	}
+	return preview, nil
+}
+
+// Send marks a draft campaign as sent and writes it to the notification
+// outbox, from which the NotificationDispatcher notifies its audience
+func (r *campaignRepo) Send(id uint, actor Actor) (*Campaign, error) {
+	var campaign Campaign
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&campaign, id).Error; err != nil {
+			return dbError(err, "Campaign")
+		}
+		if campaign.Status != CampaignDraft {
+			return NewConflictError("Campaign has already been sent")
+		}
+		before := campaign
+
+		data, err := campaignData(tx, &campaign)
+		if err != nil {
+			return err
+		}
+		var audience int64
+		if err := campaign.audience(tx).Count(&audience).Error; err != nil {
+			return err
+		}
+		if audience == 0 {
+			return NewValidationError("audience", "no customers match the campaign")
+		}
+
+		now := time.Now()
+		claim := tx.Model(&Campaign{}).Where("id = ? AND status = ?", id, CampaignDraft).
+			Updates(map[string]interface{}{
+				"status":     CampaignSent,
+				"sent_at":    now,
+				"sent_by":    actor.String(),
+				"updated_at": now,
+				"updated_by": actor.String(),
+			})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return NewConflictError("Campaign has already been sent")
+		}
+		campaign.Status = CampaignSent
+		campaign.SentAt = &now
+		campaign.SentBy = actor.String()
+		campaign.UpdatedAt = now
+		campaign.UpdatedBy = actor.String()
+
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&NotificationEvent{Type: EventOfferCampaign, CampaignID: &campaign.ID, Payload: AuditJSON(payload)}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityCampaign, campaign.ID, AuditActionSend, &before, &campaign)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// campaignOrders are the orders attributed to a campaign, scanned from one query
+type campaignOrders struct {
+	Orders    int64
+	Customers int64
+	Quantity  int64
+	Revenue   float64
+}
+
+// Report measures the delivery of a sent campaign and the orders attributed
+// to it so far
+func (r *campaignRepo) Report(id uint) (*CampaignReport, error) {
+	campaign, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.SentAt == nil {
+		return nil, NewConflictError("Campaign has not been sent")
+	}
+
+	report := &CampaignReport{
+		CampaignID:        campaign.ID,
+		SentAt:            *campaign.SentAt,
+		AttributionEndsAt: campaign.SentAt.AddDate(0, 0, campaign.AttributionDays),
+		Channels:          map[string]CampaignDelivery{},
+	}
+
+	var deliveries []struct {
+		Channel string
+		Status  string
+		Count   int64
+	}
+	err = r.db.Model(&Notification{}).Select("channel, status, COUNT(*) AS count").
+		Where("campaign_id = ?", id).Group("channel, status").Scan(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range deliveries {
+		delivery := report.Channels[row.Channel]
+		switch row.Status {
+		case DeliveryPending:
+			delivery.Pending = row.Count
+		case DeliveryDelivered:
+			delivery.Delivered = row.Count
+		case DeliveryFailed:
+			delivery.Failed = row.Count
+		}
+		report.Channels[row.Channel] = delivery
+	}
+
+	err = r.db.Model(&Notification{}).
+		Select("COUNT(DISTINCT user_id) AS recipients, COUNT(DISTINCT CASE WHEN status = ? THEN user_id END) AS reached", DeliveryDelivered).
+		Where("campaign_id = ?", id).
+		Row().Scan(&report.Recipients, &report.Reached)
+	if err != nil {
+		return nil, err
+	}
+
+	// Orders count once however they were split; the customer must have
+	// received the campaign before ordering
+	query := r.db.Table("order_item AS oi").
+		Joins(`JOIN "order" o ON o.id = oi.order_id`).
+		Select("COUNT(DISTINCT COALESCE(o.parent_id, o.id)) AS orders, "+
+			"COUNT(DISTINCT o.user_id) AS customers, "+
+			"COALESCE(SUM("+netQuantitySQL+"), 0) AS quantity, "+
+			"COALESCE(SUM("+netQuantitySQL+" * oi.unit_price), 0) AS revenue").
+		Where("oi.company_id = ? AND o.deleted_at IS NULL AND o.backorder_of_id IS NULL AND o.status IN ?", campaign.CompanyID, PlacedOrderStatuses).
+		Where("o.created_at < ?", report.AttributionEndsAt.UTC()).
+		Where("EXISTS (SELECT 1 FROM notification n WHERE n.campaign_id = ? AND n.user_id = o.user_id AND n.status = ? AND n.sent_at <= o.created_at)",
+			id, DeliveryDelivered)
+	if campaign.MedicineID != nil {
+		query = query.Where("oi.medicine_id = ?", *campaign.MedicineID)
+	}
+	var orders campaignOrders
+	if err := query.Scan(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	report.Orders = orders.Orders
+	report.Customers = orders.Customers
+	report.Quantity = orders.Quantity
+	report.Revenue = math.Round(orders.Revenue*100) / 100
+	if report.Reached > 0 {
+		conversion := math.Round(float64(orders.Customers)/float64(report.Reached)*10000) / 100
+		report.Conversion = &conversion
+	}
+	return report, nil
+}
+
+// campaignData checks the campaign's medicine, company, offer and message,
+// fills in the company and offer from the medicine where missing, and
+// returns the data its notifications are rendered with
+func campaignData(tx *gorm.DB, campaign *Campaign) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"campaignId":   campaign.ID,
+		"medicineId":   nil,
+		"medicineName": "",
+	}
+
+	if campaign.MedicineID != nil {
+		var medicine Medicine
+		err := tx.Select("id", "name", "company_id", "offer").First(&medicine, *campaign.MedicineID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewValidationError("medicine_id", "medicine does not exist")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if campaign.CompanyID != 0 && campaign.CompanyID != medicine.CompanyID {
+			return nil, NewValidationError("company_id", "is not the company of the medicine")
+		}
+		campaign.CompanyID = medicine.CompanyID
+		if campaign.Offer == "" {
+			campaign.Offer = medicine.Offer
+		}
+		data["medicineId"] = medicine.ID
+		data["medicineName"] = medicine.Name
+	}
+
+	if campaign.CompanyID == 0 {
+		return nil, NewValidationError("company_id", "is required without a medicine")
+	}
+	var company Company
+	err := tx.Select("id", "company_name").First(&company, campaign.CompanyID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, NewValidationError("company_id", "company does not exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if campaign.Offer == "" {
+		return nil, NewValidationError("offer", "is required unless the medicine has an offer")
+	}
+	data["companyId"] = company.ID
+	data["companyName"] = company.CompanyName
+	data["offer"] = campaign.Offer
+
+	if _, err := renderNotification(campaign.Subject, data, nil); err != nil {
+		return nil, NewValidationError("subject", templateProblem(err))
+	}
+	if _, err := renderNotification(campaign.Body, data, nil); err != nil {
+		return nil, NewValidationError("body", templateProblem(err))
+	}
+	return data, nil
+}
+
+// audience returns a query of the approved customers the campaign targets
+func (c *Campaign) audience(db *gorm.DB) *gorm.DB {
+	query := db.Model(&User{}).Where("is_admin = ? AND status = ?", false, UserStatusApproved)
+	if len(c.Cities) > 0 {
+		query = query.Where("LOWER(city) IN ?", lowerStrings(c.Cities))
+	}
+	if len(c.Tiers) > 0 {
+		query = query.Where("LOWER(tier) IN ?", lowerStrings(c.Tiers))
+	}
+	if c.PastPurchasers {
+		purchasers := db.Table("order_item AS oi").
+			Joins(`JOIN "order" o ON o.id = oi.order_id`).
+			Select("o.user_id").
+			Where("oi.company_id = ? AND o.deleted_at IS NULL AND o.status IN ?", c.CompanyID, PlacedOrderStatuses)
+		query = query.Where("id IN (?)", purchasers)
+	}
+	return query
+}
+
+// channels returns the channels a customer receives the campaign on: those
+// of the campaign the customer has not turned off for offer.campaign, or the
+// customer's offer.campaign channels if the campaign names none
+func (c *Campaign) channels(prefs notificationPreferences, userID uint) []string {
+	if len(c.Channels) == 0 {
+		return prefs.channels(userID, EventOfferCampaign)
+	}
+	saved, chosen := prefs[userID][EventOfferCampaign]
+	var channels []string
+	for _, channel := range c.Channels {
+		if !chosen || saved[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// messageTemplate returns the text of the campaign's notifications on a
+// channel: its own subject and body where set, the offer.campaign template
+// otherwise
+func (c *Campaign) messageTemplate(templates notificationTemplates, channel string) NotificationTemplate {
+	tmpl := templates.get(EventOfferCampaign, channel)
+	if c.Subject != "" {
+		tmpl.Subject = c.Subject
+	}
+	if c.Body != "" {
+		tmpl.Body = c.Body
+	}
+	return tmpl
+}
+
+// lowerStrings returns the strings in lower case
+func lowerStrings(list []string) []string {
+	lowered := make([]string, len(list))
+	for i, s := range list {
+		lowered[i] = strings.ToLower(s)
+	}
+	return lowered
+}
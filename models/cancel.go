@@ -0,0 +1,251 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reasons for cancelling an order
+const (
+	CancelReasonCustomerRequest = "customer_request"
+	CancelReasonDuplicateOrder  = "duplicate_order"
+	CancelReasonOutOfStock      = "out_of_stock"
+	CancelReasonPricingError    = "pricing_error"
+	CancelReasonPaymentIssue    = "payment_issue"
+	CancelReasonOther           = "other"
+)
+
+// Statuses of an order cancellation
+const (
+	CancellationRequested = "requested" // Waiting for another admin to approve it
+	CancellationDone      = "cancelled"
+)
+
+// OrderCancellation is who cancelled an order and why, or the cancellation
+// waiting for approval
+type OrderCancellation struct {
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason"`
+	Note        string     `json:"note,omitempty"`
+	RequestedBy string     `json:"requestedBy,omitempty"`
+	RequestedAt *time.Time `json:"requestedAt,omitempty"`
+	CancelledBy string     `json:"cancelledBy,omitempty"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+}
+
+// convertCancellation returns the cancellation of an order, or nil when it
+// was neither cancelled nor requested to be
+func convertCancellation(order *Order) *OrderCancellation {
+	if order.CancelReason == "" {
+		return nil
+	}
+
+	cancellation := &OrderCancellation{
+		Status:      CancellationRequested,
+		Reason:      order.CancelReason,
+		Note:        order.CancelNote,
+		RequestedBy: order.CancelRequestedBy,
+		RequestedAt: order.CancelRequestedAt,
+		CancelledBy: order.CancelledBy,
+		CancelledAt: order.CancelledAt,
+	}
+	if order.CancelledAt != nil {
+		cancellation.Status = CancellationDone
+	}
+	return cancellation
+}
+
+// Cancel cancels an order for the given reason. Customers can cancel their
+// own orders until they are processed. Admins can cancel any order that was
+// not shipped, but cancelling an order that is being processed only requests
+// the cancellation, which another admin approves with ApproveCancellation.
+// Cancelling a split order cancels all of its child orders.
+func (r *orderRepo) Cancel(id uint, reason, note string, isAdmin bool, actor Actor) (*OrderRequest, error) {
+	err := r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Preload("Items").Preload("Children.Items").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if !isAdmin && order.UserID != actor.UserID {
+			return NewForbiddenError("You can only cancel your own orders")
+		}
+		if order.Status == OrderStatusCancelled {
+			return NewConflictError("Order is already cancelled")
+		}
+		if order.CancelRequestedAt != nil && order.CancelledAt == nil {
+			return NewConflictError("A cancellation of this order is already waiting for approval")
+		}
+
+		orders := []Order{order}
+		if len(order.Children) > 0 {
+			orders = order.Children
+		}
+		for _, o := range orders {
+			if o.Status == OrderStatusCancelled {
+				continue
+			}
+			if o.Status == OrderStatusProcessing && isAdmin && len(order.Children) == 0 {
+				return requestCancellation(tx, &order, reason, note, actor)
+			}
+			if err := checkCancellable(o, isAdmin); err != nil {
+				return err
+			}
+		}
+
+		for i := range orders {
+			if orders[i].Status == OrderStatusCancelled {
+				continue
+			}
+			if err := cancelOrder(tx, &orders[i], reason, note, actor); err != nil {
+				return err
+			}
+		}
+		if len(order.Children) > 0 {
+			return recordCancellation(tx, order.ID, reason, note, actor)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(id, isAdmin)
+}
+
+// ApproveCancellation cancels an order whose cancellation another admin requested
+func (r *orderRepo) ApproveCancellation(id uint, actor Actor) (*OrderRequest, error) {
+	err := r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Preload("Items").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if order.CancelRequestedAt == nil || order.CancelledAt != nil {
+			return NewConflictError("No cancellation of this order is waiting for approval")
+		}
+		if order.CancelRequestedBy == actor.String() {
+			return NewForbiddenError("A cancellation must be approved by another admin")
+		}
+		if order.Status != OrderStatusPending && order.Status != OrderStatusProcessing {
+			return NewConflictError(fmt.Sprintf("Order is %s and can no longer be cancelled", order.Status))
+		}
+		return cancelOrder(tx, &order, order.CancelReason, order.CancelNote, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(id, true)
+}
+
+// RejectCancellation withdraws a cancellation that is waiting for approval
+func (r *orderRepo) RejectCancellation(id uint, actor Actor) (*OrderRequest, error) {
+	err := r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if order.CancelRequestedAt == nil || order.CancelledAt != nil {
+			return NewConflictError("No cancellation of this order is waiting for approval")
+		}
+
+		before := map[string]interface{}{"reason": order.CancelReason, "requested_by": order.CancelRequestedBy}
+		err := tx.Model(&Order{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"cancel_reason":       "",
+			"cancel_note":         "",
+			"cancel_requested_by": "",
+			"cancel_requested_at": nil,
+			"updated_by":          actor.String(),
+			"updated_at":          time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityOrder, id, AuditActionCancelReject, before, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(id, true)
+}
+
+// checkCancellable checks that an order can be cancelled right away by a
+// customer (until processing) or an admin (until shipping)
+func checkCancellable(order Order, isAdmin bool) error {
+	switch order.Status {
+	case OrderStatusDraft, OrderStatusPending:
+		return nil
+	case OrderStatusProcessing:
+		if isAdmin {
+			return NewConflictError(fmt.Sprintf("Order %d is being processed; cancel it on its own so that the cancellation can be approved", order.ID))
+		}
+		return NewForbiddenError("Orders that are being processed can only be cancelled by staff")
+	}
+	return NewConflictError(fmt.Sprintf("Order is %s and can no longer be cancelled", order.Status))
+}
+
+// requestCancellation records a cancellation that waits for approval
+func requestCancellation(tx *gorm.DB, order *Order, reason, note string, actor Actor) error {
+	now := time.Now()
+	err := tx.Model(&Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"cancel_reason":       reason,
+		"cancel_note":         note,
+		"cancel_requested_by": actor.String(),
+		"cancel_requested_at": now,
+		"updated_by":          actor.String(),
+		"updated_at":          now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionCancelRequest, nil,
+		map[string]string{"reason": reason, "note": note})
+}
+
+// cancelOrder cancels an order, releases its reserved stock and updates the
+// status of the split order it is part of
+func cancelOrder(tx *gorm.DB, order *Order, reason, note string, actor Actor) error {
+	if err := releaseOrderStock(tx, order.Items); err != nil {
+		return err
+	}
+
+	before := order.Status
+	now := time.Now()
+	err := tx.Model(&Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"status":        OrderStatusCancelled,
+		"cancel_reason": reason,
+		"cancel_note":   note,
+		"cancelled_by":  actor.String(),
+		"cancelled_at":  now,
+		"updated_by":    actor.String(),
+		"updated_at":    now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionCancel,
+		map[string]string{"status": before},
+		map[string]string{"status": OrderStatusCancelled, "reason": reason, "note": note})
+	if err != nil {
+		return err
+	}
+	if err := recordOrderStatusChanged(tx, order, before, OrderStatusCancelled); err != nil || order.ParentID == nil {
+		return err
+	}
+	return syncSplitStatus(tx, *order.ParentID, actor)
+}
+
+// recordCancellation records who cancelled a split order and why. Its status
+// follows its child orders.
+func recordCancellation(tx *gorm.DB, id uint, reason, note string, actor Actor) error {
+	now := time.Now()
+	return tx.Model(&Order{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"cancel_reason": reason,
+		"cancel_note":   note,
+		"cancelled_by":  actor.String(),
+		"cancelled_at":  now,
+	}).Error
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CartItem is a medicine in a user's cart. The cart is kept on the server so
+// it survives app reinstalls and can be checked out from any device.
+type CartItem struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	UserID     uint      `json:"-" gorm:"uniqueIndex:idx_cart_item_user_medicine"`
+	MedicineID uint      `json:"medicineId" gorm:"uniqueIndex:idx_cart_item_user_medicine"`
+	Quantity   int       `json:"quantity"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+	Medicine   Medicine  `json:"-"`
+}
+
+// TableName specifies the table name for GORM to use
+func (CartItem) TableName() string {
+	return "cart_item"
+}
+
+// maxCartQuantity is the largest quantity of one medicine in a cart, the same
+// limit as for an order item
+const maxCartQuantity = 100000
+
+// Cart is a user's cart priced with the current prices and offers
+type Cart struct {
+	Items         []CartLine `json:"items"`
+	TotalQuantity int        `json:"totalQuantity"`
+	FreeQuantity  int        `json:"freeQuantity"`
+	TotalValue    float64    `json:"totalValue"`
+	Warnings      int        `json:"warnings"` // Number of lines with warnings
+}
+
+// CartLine is one cart item with its current price, offer and stock warnings
+type CartLine struct {
+	MedicineID   uint     `json:"medicineId"`
+	MedicineName string   `json:"medicineName"`
+	CompanyID    uint     `json:"companyId"`
+	CompanyName  string   `json:"companyName"`
+	Quantity     int      `json:"quantity"`
+	UnitPrice    float64  `json:"unitPrice"`
+	LineTotal    float64  `json:"lineTotal"`
+	Offer        string   `json:"offer,omitempty"`
+	FreeQuantity int      `json:"freeQuantity,omitempty"`
+	Available    bool     `json:"available"` // False when the medicine was deleted; checkout fails until it is removed
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// cartRepo is the GORM implementation of CartRepo
+type cartRepo struct {
+	db     *gorm.DB
+	broker OrderBroker
+}
+
+// NewCartRepo creates a CartRepo backed by the given connection that
+// publishes the orders placed at checkout to broker
+func NewCartRepo(db *gorm.DB, broker OrderBroker) CartRepo {
+	return &cartRepo{db: db, broker: broker}
+}
+
+// Get returns the user's cart
+func (r *cartRepo) Get(userID uint) (*Cart, error) {
+	items, err := loadCart(r.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return priceCart(items), nil
+}
+
+// AddItem adds quantity units of a medicine to the cart
+func (r *cartRepo) AddItem(userID, medicineID uint, quantity int) (*Cart, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var medicine Medicine
+		if err := tx.Select("id").First(&medicine, medicineID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return NewValidationError("medicineId", "medicine does not exist")
+			}
+			return err
+		}
+		return addCartItem(tx, userID, medicineID, quantity)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(userID)
+}
+
+// addCartItem adds quantity units of an existing medicine to the cart
+func addCartItem(tx *gorm.DB, userID, medicineID uint, quantity int) error {
+	var item CartItem
+	err := tx.Where("user_id = ? AND medicine_id = ?", userID, medicineID).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&CartItem{UserID: userID, MedicineID: medicineID, Quantity: quantity}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if item.Quantity+quantity > maxCartQuantity {
+		return NewValidationError("quantity", fmt.Sprintf("must be at most %d in total", maxCartQuantity))
+	}
+	return tx.Model(&item).Update("quantity", item.Quantity+quantity).Error
+}
+
+// SetItem sets the quantity of a medicine already in the cart
+func (r *cartRepo) SetItem(userID, medicineID uint, quantity int) (*Cart, error) {
+	result := r.db.Model(&CartItem{}).
+		Where("user_id = ? AND medicine_id = ?", userID, medicineID).
+		Update("quantity", quantity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewNotFoundError("Cart item")
+	}
+	return r.Get(userID)
+}
+
+// RemoveItem removes a medicine from the cart
+func (r *cartRepo) RemoveItem(userID, medicineID uint) (*Cart, error) {
+	result := r.db.Where("user_id = ? AND medicine_id = ?", userID, medicineID).Delete(&CartItem{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, NewNotFoundError("Cart item")
+	}
+	return r.Get(userID)
+}
+
+// Clear empties the cart
+func (r *cartRepo) Clear(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&CartItem{}).Error
+}
+
+// Checkout turns the cart into a pending order at the current prices and
+// offers and empties it, in one transaction
+func (r *cartRepo) Checkout(userID uint, actor Actor) (*OrderRequest, error) {
+	var order *Order
+
+	err := publishingTransaction(r.db, r.broker, func(tx *gorm.DB) error {
+		items, err := loadCart(tx, userID)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return NewValidationError("items", "cart is empty")
+		}
+
+		requested := make([]OrderItemRequest, 0, len(items))
+		for _, item := range items {
+			requested = append(requested, OrderItemRequest{
+				MedicineID: item.MedicineID,
+				CompanyID:  item.Medicine.CompanyID,
+				Quantity:   item.Quantity,
+			})
+		}
+
+		if order, err = createOrder(tx, userID, OrderStatusPending, requested, actor); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&CartItem{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload with associations
+	preloadItems(r.db).First(order)
+
+	return ConvertOrderToOrderRequest(order, false), nil
+}
+
+// loadCart loads the cart items with their medicines, including deleted ones
+func loadCart(db *gorm.DB, userID uint) ([]CartItem, error) {
+	var items []CartItem
+	err := db.Preload("Medicine", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Medicine.Company", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("user_id = ?", userID).
+		Order("created_at, id").
+		Find(&items).Error
+	return items, err
+}
+
+// priceCart prices the cart items with the current prices and offers
+func priceCart(items []CartItem) *Cart {
+	cart := &Cart{Items: []CartLine{}}
+	for _, item := range items {
+		medicine := item.Medicine
+		line := CartLine{
+			MedicineID:   item.MedicineID,
+			MedicineName: medicine.Name,
+			CompanyID:    medicine.CompanyID,
+			CompanyName:  medicine.Company.CompanyName,
+			Quantity:     item.Quantity,
+			UnitPrice:    medicine.Price,
+			LineTotal:    math.Round(medicine.Price*float64(item.Quantity)*100) / 100,
+			Offer:        medicine.Offer,
+			FreeQuantity: FreeQuantity(medicine.Offer, item.Quantity),
+			Available:    !medicine.DeletedAt.Valid,
+		}
+
+		switch {
+		case !line.Available:
+			line.Warnings = append(line.Warnings, "Medicine is no longer available")
+		case medicine.Stock != nil && *medicine.Stock == 0:
+			line.Warnings = append(line.Warnings, "Out of stock")
+		case medicine.Stock != nil && *medicine.Stock < item.Quantity:
+			line.Warnings = append(line.Warnings, fmt.Sprintf("Only %d in stock", *medicine.Stock))
+		}
+
+		cart.Items = append(cart.Items, line)
+		cart.TotalQuantity += line.Quantity
+		cart.FreeQuantity += line.FreeQuantity
+		cart.TotalValue += line.LineTotal
+		if len(line.Warnings) > 0 {
+			cart.Warnings++
+		}
+	}
+	cart.TotalValue = math.Round(cart.TotalValue*100) / 100
+	return cart
+}
@@ -1,18 +1,22 @@
 package models
 
 import (
+	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Company struct represents the company model in the database
 type Company struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	CompanyName string    `json:"company_name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	UpdatedBy   string    `json:"updated_by"`
-	LogoUrl     string    `json:"logo_url"`
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	CompanyName string         `json:"company_name"`
+	Description string         `json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	UpdatedBy   string         `json:"updated_by"`
+	LogoUrl     string         `json:"logo_url"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"` // Set when soft-deleted
 }
 
 // TableName specifies the table name for GORM to use
@@ -20,17 +24,33 @@ func (Company) TableName() string {
 	return "company" // Use the singular name of your table
 }
 
-// CreateCompany creates a new company in the database
-func CreateCompany(companyName, description, updatedBy, logoUrl string) (*Company, error) {
+// companyRepo is the GORM implementation of CompanyRepo
+type companyRepo struct {
+	db *gorm.DB
+}
+
+// NewCompanyRepo creates a CompanyRepo backed by the given connection
+func NewCompanyRepo(db *gorm.DB) CompanyRepo {
+	return &companyRepo{db: db}
+}
+
+// Create creates a new company in the database
+func (r *companyRepo) Create(companyName, description, logoUrl string, actor Actor) (*Company, error) {
 	company := &Company{
 		CompanyName: companyName,
 		Description: description,
-		UpdatedBy:   updatedBy,
+		UpdatedBy:   actor.String(),
 		LogoUrl:     logoUrl,
 	}
 
-	// Insert the company into the database
-	if err := db.Create(company).Error; err != nil {
+	// Insert the company and its audit record together
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(company).Error; err != nil {
+			return dbError(err, "Company")
+		}
+		return recordAudit(tx, actor, AuditEntityCompany, company.ID, AuditActionCreate, nil, company)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -38,51 +58,108 @@ func CreateCompany(companyName, description, updatedBy, logoUrl string) (*Compan
 	return company, nil
 }
 
-// GetCompany retrieves a company by ID from the database
-func GetCompany(id uint) (*Company, error) {
+// Get retrieves a company by ID from the database
+func (r *companyRepo) Get(id uint) (*Company, error) {
 	var company Company
-	if err := db.First(&company, id).Error; err != nil {
-		return nil, err
+	if err := r.db.First(&company, id).Error; err != nil {
+		return nil, dbError(err, "Company")
 	}
 	return &company, nil
 }
 
-// UpdateCompany updates an existing company in the database
-func UpdateCompany(id uint, companyName, description, updatedBy, logoUrl string) (*Company, error) {
+// Update updates an existing company in the database
+func (r *companyRepo) Update(id uint, companyName, description, logoUrl string, actor Actor) (*Company, error) {
 	var company Company
 
-	// Find the company by ID
-	if err := db.First(&company, id).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Find the company by ID
+		if err := tx.First(&company, id).Error; err != nil {
+			return dbError(err, "Company")
+		}
+		before := company
+
+		// Update the company fields
+		company.CompanyName = companyName
+		company.Description = description
+		company.UpdatedBy = actor.String()
+		company.LogoUrl = logoUrl
+		company.UpdatedAt = time.Now()
+
+		// Save the updated company to the database
+		if err := tx.Save(&company).Error; err != nil {
+			return dbError(err, "Company")
+		}
+		return recordAudit(tx, actor, AuditEntityCompany, company.ID, AuditActionUpdate, &before, &company)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Update the company fields
-	company.CompanyName = companyName
-	company.Description = description
-	company.UpdatedBy = updatedBy
-	company.LogoUrl = logoUrl
-	company.UpdatedAt = time.Now()
+	return &company, nil
+}
+
+// Delete soft-deletes a company. Companies that still have medicines cannot
+// be deleted, so every active medicine keeps an active company.
+func (r *companyRepo) Delete(id uint, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var company Company
+		if err := tx.First(&company, id).Error; err != nil {
+			return dbError(err, "Company")
+		}
+
+		var medicines int64
+		if err := tx.Model(&Medicine{}).Where("company_id = ?", id).Count(&medicines).Error; err != nil {
+			return err
+		}
+		if medicines > 0 {
+			return NewConflictError(fmt.Sprintf("Company still has %d active medicines; delete them first", medicines))
+		}
+
+		if err := tx.Delete(&company).Error; err != nil {
+			return dbError(err, "Company")
+		}
+		return recordAudit(tx, actor, AuditEntityCompany, company.ID, AuditActionDelete, &company, nil)
+	})
+}
 
-	// Save the updated company to the database
-	if err := db.Save(&company).Error; err != nil {
+// Restore undoes the soft deletion of a company
+func (r *companyRepo) Restore(id uint, actor Actor) (*Company, error) {
+	var company Company
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().First(&company, id).Error; err != nil {
+			return dbError(err, "Company")
+		}
+		if !company.DeletedAt.Valid {
+			return NewConflictError("Company is not deleted")
+		}
+		before := company
+
+		company.DeletedAt = gorm.DeletedAt{}
+		company.UpdatedBy = actor.String()
+		company.UpdatedAt = time.Now()
+		if err := tx.Unscoped().Save(&company).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityCompany, company.ID, AuditActionRestore, &before, &company)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &company, nil
 }
 
-// DeleteCompany deletes a company from the database by ID
-func DeleteCompany(id uint) error {
-	if err := db.Delete(&Company{}, id).Error; err != nil {
-		return err
+// List retrieves all companies from the database, including soft-deleted
+// ones when requested
+func (r *companyRepo) List(includeDeleted bool) ([]Company, error) {
+	query := r.db
+	if includeDeleted {
+		query = query.Unscoped()
 	}
-	return nil
-}
 
-// GetAllCompanies retrieves all companies from the database
-func GetAllCompanies() ([]Company, error) {
 	var companies []Company
-	if err := db.Find(&companies).Error; err != nil {
+	if err := query.Find(&companies).Error; err != nil {
 		return nil, err
 	}
 	return companies, nil
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"pharmacy/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// OpenDatabase connects to the configured database and applies the pool settings
+func OpenDatabase(cfg config.DatabaseConfig, gormConfig *gorm.Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case config.DriverPostgres:
+		dialector = postgres.Open(cfg.DSN)
+	case config.DriverSQLite:
+		dialector = sqlite.Open(cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	// Driver errors such as unique violations are translated into gorm.ErrDuplicatedKey
+	// and friends so the repositories can report them as domain errors
+	gormConfig.TranslateError = true
+
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	return db, nil
+}
+
+// OpenInMemory opens a private in-memory SQLite database with the schema
+// migrated, for tests and throwaway local runs. It is the in-memory
+// implementation of the repositories: NewRepositories on this connection
+// runs the same queries and transactions as production without a server,
+// instead of a hand-written fake that could drift from them.
+func OpenInMemory() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every pooled connection would otherwise get its own empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := AutoMigrate(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// AutoMigrate creates all tables and ensures they have the correct columns
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(&User{}, &Company{}, &Medicine{}, &Order{}, &OrderItem{}, &OTPCode{}, &Session{}, &PasswordResetToken{}, &AuditLog{}, &OfferPeriod{}, &CartItem{}, &OrderNote{}, &OrderAttachment{}, &WebhookEndpoint{}, &WebhookEvent{}, &WebhookDelivery{}, &NotificationTemplate{}, &NotificationPreference{}, &UserDevice{}, &NotificationEvent{}, &Notification{}, &Campaign{})
+}
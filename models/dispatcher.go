@@ -0,0 +1,263 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"pharmacy/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// webhookBatchSize is the number of events and deliveries handled per round
+const webhookBatchSize = 100
+
+// maxWebhookBackoff caps the delay between two attempts of a delivery
+const maxWebhookBackoff = 24 * time.Hour
+
+// WebhookDispatcher hands the events in the outbox to the endpoints that
+// subscribe to them and delivers them. Every replica of the server can run
+// one; deliveries are claimed before they are attempted.
+type WebhookDispatcher struct {
+	db     *gorm.DB
+	cfg    config.WebhookConfig
+	client *http.Client
+}
+
+// WebhookPayload is the JSON body POSTed to webhook endpoints
+type WebhookPayload struct {
+	ID        uint            `json:"id"` // Event ID, the same for every endpoint and retry
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewWebhookDispatcher creates a dispatcher on the given connection
+func NewWebhookDispatcher(db *gorm.DB, cfg config.WebhookConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{db: db, cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Run dispatches events every poll interval until ctx is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhook dispatch: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch creates deliveries for new events and attempts the deliveries
+// that are due
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) error {
+	if err := d.fanOut(); err != nil {
+		return err
+	}
+	return d.deliverDue(ctx)
+}
+
+// fanOut creates a pending delivery of each new event for every active
+// endpoint subscribed to its type
+func (d *WebhookDispatcher) fanOut() error {
+	var events []WebhookEvent
+	if err := d.db.Where("dispatched_at IS NULL").Order("id").Limit(webhookBatchSize).Find(&events).Error; err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	var endpoints []WebhookEndpoint
+	if err := d.db.Where("active = ?", true).Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		err := d.db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			claim := tx.Model(&WebhookEvent{}).Where("id = ? AND dispatched_at IS NULL", event.ID).Update("dispatched_at", now)
+			if claim.Error != nil || claim.RowsAffected == 0 {
+				return claim.Error // Another dispatcher got there first
+			}
+
+			for _, endpoint := range endpoints {
+				if !endpoint.subscribes(event.Type) {
+					continue
+				}
+				delivery := WebhookDelivery{
+					EventID:       event.ID,
+					EndpointID:    endpoint.ID,
+					EventType:     event.Type,
+					Status:        DeliveryPending,
+					NextAttemptAt: &now,
+				}
+				if err := tx.Create(&delivery).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverDue attempts the pending deliveries to active endpoints whose next
+// attempt is due, oldest first
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) error {
+	active := d.db.Model(&WebhookEndpoint{}).Select("id").Where("active = ?", true)
+
+	var deliveries []WebhookDelivery
+	err := d.db.Where("status = ? AND next_attempt_at <= ? AND endpoint_id IN (?)", DeliveryPending, time.Now(), active).
+		Order("next_attempt_at, id").Limit(webhookBatchSize).Find(&deliveries).Error
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := d.attempt(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt claims a delivery, POSTs it to its endpoint and records the outcome
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery WebhookDelivery) error {
+	// The claim counts the attempt and keeps other dispatchers away until
+	// the request has had time to finish
+	lease := time.Now().Add(2 * d.cfg.Timeout)
+	claim := d.db.Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", delivery.ID, DeliveryPending, delivery.Attempts).
+		Updates(map[string]interface{}{"attempts": delivery.Attempts + 1, "next_attempt_at": lease})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+	delivery.Attempts++
+
+	// Deleting an endpoint gives up its pending deliveries
+	var endpoint WebhookEndpoint
+	err := d.db.First(&endpoint, delivery.EndpointID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var event WebhookEvent
+	if err := d.db.First(&event, delivery.EventID).Error; err != nil {
+		return err
+	}
+
+	status, sendErr := d.send(ctx, &endpoint, &event)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"response_status": status,
+		"last_error":      "",
+		"updated_at":      now,
+	}
+	switch {
+	case sendErr == nil:
+		updates["status"] = DeliveryDelivered
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		updates["status"] = DeliveryFailed
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt_at"] = nil
+	default:
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt_at"] = now.Add(retryBackoff(d.cfg.RetryBackoff, delivery.Attempts, maxWebhookBackoff))
+	}
+	return d.db.Model(&WebhookDelivery{}).Where("id = ? AND status = ?", delivery.ID, DeliveryPending).Updates(updates).Error
+}
+
+// send POSTs the signed event to the endpoint. Any 2xx response is a success.
+func (d *WebhookDispatcher) send(ctx context.Context, endpoint *WebhookEndpoint, event *WebhookEvent) (int, error) {
+	body, err := json.Marshal(WebhookPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pharmacy-webhooks")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Event-Id", strconv.FormatUint(uint64(event.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp.StatusCode, nil
+}
+
+// retryBackoff is the delay before the attempt after the given number of
+// failed attempts: base, doubled for every earlier failure, up to limit
+func retryBackoff(base time.Duration, attempts int, limit time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "timestamp.body" under the
+// endpoint's secret, which receivers recompute to verify a delivery
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribes reports whether the endpoint receives events of the given type
+func (e *WebhookEndpoint) subscribes(eventType string) bool {
+	for _, subscribed := range e.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
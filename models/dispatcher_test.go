@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	} {
+		if got := retryBackoff(time.Minute, tc.attempts, 30*time.Minute); got != tc.want {
+			t.Errorf("retryBackoff after %d attempts = %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+	if got := retryBackoff(time.Hour, 1, 30*time.Minute); got != 30*time.Minute {
+		t.Errorf("retryBackoff with a base over the limit = %v, want the limit", got)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"order.created"}`)
+	// printf '1760000000.{"type":"order.created"}' | openssl dgst -sha256 -hmac whsec_test
+	want := "1d80bb1f5b26d5c7b263a80405428f255f3e9ac93bc4ff01117c98ba09b1cc6e"
+	if got := SignWebhook("whsec_test", "1760000000", body); got != want {
+		t.Fatalf("SignWebhook = %s, want %s", got, want)
+	}
+	if SignWebhook("whsec_other", "1760000000", body) == want || SignWebhook("whsec_test", "1760000001", body) == want {
+		t.Fatal("signature does not depend on the secret and timestamp")
+	}
+}
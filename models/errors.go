@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// NotFoundError reports that the requested entity does not exist
+type NotFoundError struct {
+	Entity string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Entity + " not found"
+}
+
+// ConflictError reports that a change clashes with existing data,
+// e.g. a phone number that is already registered
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// ValidationError reports invalid input, with a message per offending field
+type ValidationError struct {
+	Message string
+	Fields  map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	fields := make([]string, 0, len(e.Fields))
+	for field, problem := range e.Fields {
+		fields = append(fields, field+": "+problem)
+	}
+	sort.Strings(fields)
+	return e.Message + " (" + strings.Join(fields, ", ") + ")"
+}
+
+// ForbiddenError reports that the caller is not allowed to perform the action
+type ForbiddenError struct {
+	Message string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// NewNotFoundError returns a NotFoundError for the given entity, e.g. "Medicine"
+func NewNotFoundError(entity string) error {
+	return &NotFoundError{Entity: entity}
+}
+
+// NewConflictError returns a ConflictError with the given message
+func NewConflictError(message string) error {
+	return &ConflictError{Message: message}
+}
+
+// NewValidationError returns a ValidationError for a single field
+func NewValidationError(field, problem string) *ValidationError {
+	return &ValidationError{
+		Message: "Validation failed",
+		Fields:  map[string]string{field: problem},
+	}
+}
+
+// NewForbiddenError returns a ForbiddenError with the given message
+func NewForbiddenError(message string) error {
+	return &ForbiddenError{Message: message}
+}
+
+// dbError converts the GORM errors callers can act on into domain errors
+// for the given entity and returns any other error unchanged
+func dbError(err error, entity string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NewNotFoundError(entity)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return NewConflictError(entity + " already exists")
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return NewConflictError(entity + " conflicts with related records")
+	}
+	return err
+}
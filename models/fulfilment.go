@@ -0,0 +1,247 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Order line statuses, derived from the fulfilment recorded on the line
+const (
+	LineStatusOpen             = "open"
+	LineStatusShipped          = "shipped"
+	LineStatusPartiallyShipped = "partially_shipped"
+	LineStatusBackordered      = "backordered"
+	LineStatusCancelled        = "cancelled"
+)
+
+// Fulfilment is the number of units of a medicine that were shipped and
+// cancelled when an order was fulfilled
+type Fulfilment struct {
+	MedicineID uint
+	Fulfilled  int
+	Cancelled  int
+}
+
+// Fulfil records the shipment of an order. Units that are neither fulfilled
+// nor cancelled are moved to a new pending backorder at the same price and
+// offer, and have their stock reserved again there. Medicines without a
+// fulfilment are shipped in full. The order becomes shipped when every unit
+// was shipped and partially shipped otherwise.
+func (r *orderRepo) Fulfil(id uint, fulfilments []Fulfilment, actor Actor) (*OrderRequest, error) {
+	err := r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Preload("Children").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if len(order.Children) > 0 {
+			return NewConflictError("Order is split by company; fulfil its child orders instead")
+		}
+		if order.Status != OrderStatusPending && order.Status != OrderStatusProcessing {
+			return NewConflictError("Only pending or processing orders can be fulfilled")
+		}
+		before := orderAuditState(&order)
+
+		if err := allocateFulfilment(order.Items, fulfilments); err != nil {
+			return err
+		}
+
+		var fulfilled int
+		var backordered []OrderItem
+		for i := range order.Items {
+			item := &order.Items[i]
+			fulfilled += item.FulfilledQuantity
+			item.FreeQuantity = FreeQuantity(item.Offer, item.FulfilledQuantity)
+			err := tx.Model(&OrderItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+				"fulfilled_quantity":   item.FulfilledQuantity,
+				"cancelled_quantity":   item.CancelledQuantity,
+				"backordered_quantity": item.BackorderedQuantity,
+				"free_quantity":        item.FreeQuantity,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := releaseStock(tx, item, item.FulfilledQuantity); err != nil {
+				return err
+			}
+
+			if item.BackorderedQuantity > 0 {
+				backordered = append(backordered, OrderItem{
+					MedicineID:   item.MedicineID,
+					CompanyID:    item.CompanyID,
+					Quantity:     item.BackorderedQuantity,
+					UnitPrice:    item.UnitPrice,
+					Offer:        item.Offer,
+					FreeQuantity: FreeQuantity(item.Offer, item.BackorderedQuantity),
+				})
+			}
+		}
+		if fulfilled == 0 {
+			return NewValidationError("items", "at least one unit must be fulfilled")
+		}
+
+		updates := map[string]interface{}{
+			"status":     OrderStatusShipped,
+			"updated_by": actor.String(),
+			"updated_at": time.Now(),
+		}
+		if fulfilled < totalQuantity(order.Items) {
+			updates["status"] = OrderStatusPartiallyShipped
+		}
+		if len(backordered) > 0 {
+			backorder, err := createBackorder(tx, &order, backordered, actor)
+			if err != nil {
+				return err
+			}
+			updates["backorder_id"] = backorder.ID
+		}
+		if err := tx.Model(&Order{}).Where("id = ?", order.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		previous := order.Status
+		order.Status = updates["status"].(string)
+		if err := recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionFulfil, before, fulfilmentAuditState(&order)); err != nil {
+			return err
+		}
+		if err := recordOrderStatusChanged(tx, &order, previous, order.Status); err != nil {
+			return err
+		}
+		if order.ParentID != nil {
+			return syncSplitStatus(tx, *order.ParentID, actor)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(id, false)
+}
+
+// allocateFulfilment sets the fulfilled, cancelled and backordered quantities
+// of the items. The units of a medicine are allocated to its lines in order.
+func allocateFulfilment(items []OrderItem, fulfilments []Fulfilment) error {
+	requested := map[uint]*Fulfilment{}
+	for i, f := range fulfilments {
+		if _, seen := requested[f.MedicineID]; seen {
+			return NewValidationError(fmt.Sprintf("items[%d].medicineId", i), "medicine is listed more than once")
+		}
+		requested[f.MedicineID] = &fulfilments[i]
+	}
+
+	for i := range items {
+		item := &items[i]
+		f, ok := requested[item.MedicineID]
+		if !ok {
+			item.FulfilledQuantity = item.Quantity
+			continue
+		}
+		item.FulfilledQuantity = min(f.Fulfilled, item.Quantity)
+		f.Fulfilled -= item.FulfilledQuantity
+		item.CancelledQuantity = min(f.Cancelled, item.Quantity-item.FulfilledQuantity)
+		f.Cancelled -= item.CancelledQuantity
+		item.BackorderedQuantity = item.Quantity - item.FulfilledQuantity - item.CancelledQuantity
+	}
+
+	for i, f := range fulfilments {
+		ordered := false
+		for _, item := range items {
+			ordered = ordered || item.MedicineID == f.MedicineID
+		}
+		if !ordered {
+			return NewValidationError(fmt.Sprintf("items[%d].medicineId", i), "medicine is not in the order")
+		}
+		if requested[f.MedicineID].Fulfilled > 0 || requested[f.MedicineID].Cancelled > 0 {
+			return NewValidationError(fmt.Sprintf("items[%d].fulfilled", i), "fulfilled and cancelled units exceed the ordered quantity")
+		}
+	}
+	return nil
+}
+
+// createBackorder creates a pending order for the backordered units of an order
+func createBackorder(tx *gorm.DB, order *Order, items []OrderItem, actor Actor) (*Order, error) {
+	backorder := &Order{
+		UserID:        order.UserID,
+		Status:        OrderStatusPending,
+		UpdatedBy:     actor.String(),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		BackorderOfID: &order.ID,
+	}
+	if err := tx.Create(backorder).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		items[i].OrderID = backorder.ID
+	}
+	if err := tx.Create(&items).Error; err != nil {
+		return nil, dbError(err, "Order item")
+	}
+	if err := reserveStock(tx, items); err != nil {
+		return nil, err
+	}
+	backorder.Items = items
+
+	if err := recordAudit(tx, actor, AuditEntityOrder, backorder.ID, AuditActionCreate, nil, orderAuditState(backorder)); err != nil {
+		return nil, err
+	}
+	if err := recordOrderCreated(tx, backorder); err != nil {
+		return nil, err
+	}
+	return backorder, nil
+}
+
+// lineStatus derives the fulfilment status of an order item. Lines of orders
+// that were shipped or cancelled without recording a fulfilment follow the
+// order status.
+func lineStatus(item OrderItem, orderStatus string) string {
+	switch {
+	case item.FulfilledQuantity == item.Quantity && item.Quantity > 0:
+		return LineStatusShipped
+	case item.FulfilledQuantity > 0:
+		return LineStatusPartiallyShipped
+	case item.BackorderedQuantity > 0:
+		return LineStatusBackordered
+	case item.CancelledQuantity > 0:
+		return LineStatusCancelled
+	}
+
+	switch orderStatus {
+	case OrderStatusShipped, OrderStatusDelivered:
+		return LineStatusShipped
+	case OrderStatusCancelled:
+		return LineStatusCancelled
+	}
+	return LineStatusOpen
+}
+
+// fulfilmentAuditState is the fulfilment of an order recorded in the audit log
+func fulfilmentAuditState(order *Order) map[string]interface{} {
+	items := []map[string]interface{}{}
+	for _, item := range order.Items {
+		items = append(items, map[string]interface{}{
+			"medicineId":  item.MedicineID,
+			"quantity":    item.Quantity,
+			"fulfilled":   item.FulfilledQuantity,
+			"cancelled":   item.CancelledQuantity,
+			"backordered": item.BackorderedQuantity,
+		})
+	}
+	return map[string]interface{}{
+		"status": order.Status,
+		"items":  items,
+	}
+}
+
+// totalQuantity sums the quantities of order items
+func totalQuantity(items []OrderItem) int {
+	total := 0
+	for _, item := range items {
+		total += item.Quantity
+	}
+	return total
+}
@@ -2,32 +2,38 @@ package models
 
 import (
 	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Medicine struct represents the medicine model in the database
 type Medicine struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CompanyID   uint      `json:"company_id"` // Foreign key for Company
-	Company     Company   `json:"company"`    // Foreign key relationship with Company
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	UpdatedBy   string    `json:"updated_by"`
-	Offer       string    `json:"offer"`
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	CompanyID   uint           `json:"company_id"` // Foreign key for Company
+	Company     Company        `json:"company"`    // Foreign key relationship with Company
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	UpdatedBy   string         `json:"updated_by"`
+	Offer       string         `json:"offer"`
+	Price       float64        `json:"price"`                   // Current unit price; order items keep the price at the time of ordering
+	Stock       *int           `json:"stock"`                   // Units available, or nil when stock is not tracked
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"` // Set when soft-deleted; orders keep referring to the row
 }
 
 type MedicineDTO struct {
-	MedicineID uint   `json:"medicineId"`
-	Name       string `json:"name"`
-	Offer      string `json:"offer"`
+	MedicineID uint    `json:"medicineId"`
+	Name       string  `json:"name"`
+	Offer      string  `json:"offer"`
+	Price      float64 `json:"price"`
+	Deleted    bool    `json:"deleted,omitempty"`
 }
 
 type CompanyMedicinesResponse struct {
@@ -41,18 +47,35 @@ func (Medicine) TableName() string {
 	return "medicine" // This ensures GORM uses the singular "medicine" table name
 }
 
-// CreateMedicine creates a new medicine in the database
-func CreateMedicine(name, description string, companyID uint, updatedBy string, offer string) (*Medicine, error) {
+// medicineRepo is the GORM implementation of MedicineRepo
+type medicineRepo struct {
+	db *gorm.DB
+}
+
+// NewMedicineRepo creates a MedicineRepo backed by the given connection
+func NewMedicineRepo(db *gorm.DB) MedicineRepo {
+	return &medicineRepo{db: db}
+}
+
+// Create creates a new medicine in the database
+func (r *medicineRepo) Create(name, description string, companyID uint, price float64, offer string, actor Actor) (*Medicine, error) {
+	if err := checkCompany(r.db, companyID); err != nil {
+		return nil, err
+	}
+
 	medicine := &Medicine{
 		Name:        name,
 		Description: description,
 		CompanyID:   companyID,
-		UpdatedBy:   updatedBy,
+		UpdatedBy:   actor.String(),
 		Offer:       offer,
+		Price:       price,
 	}
 
-	// Insert the medicine into the database
-	if err := db.Create(medicine).Error; err != nil {
+	// Insert the medicine and its audit record together
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		return createMedicine(tx, medicine, actor)
+	}); err != nil {
 		return nil, err
 	}
 
@@ -60,55 +83,174 @@ func CreateMedicine(name, description string, companyID uint, updatedBy string,
 	return medicine, nil
 }
 
-// UpdateMedicine updates an existing medicine in the database
-func UpdateMedicine(id uint, name, description string, companyID uint, updatedBy string, offer string) (*Medicine, error) {
+// createMedicine inserts a medicine, records it in the audit log and
+// announces it to webhooks
+func createMedicine(tx *gorm.DB, medicine *Medicine, actor Actor) error {
+	if err := tx.Create(medicine).Error; err != nil {
+		return dbError(err, "Medicine")
+	}
+	if err := updateOfferPeriod(tx, medicine.ID, medicine.CompanyID, "", medicine.Offer, actor); err != nil {
+		return err
+	}
+	if err := recordAudit(tx, actor, AuditEntityMedicine, medicine.ID, AuditActionCreate, nil, medicine); err != nil {
+		return err
+	}
+	return recordMedicineUpdated(tx, medicine)
+}
+
+// Update updates an existing medicine in the database
+func (r *medicineRepo) Update(id uint, name, description string, companyID uint, price float64, offer string, actor Actor) (*Medicine, error) {
 	var medicine Medicine
 
-	// Find the medicine by ID
-	if err := db.First(&medicine, id).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Find the medicine by ID
+		if err := tx.First(&medicine, id).Error; err != nil {
+			return dbError(err, "Medicine")
+		}
+		before := medicine
+
+		if err := checkCompany(tx, companyID); err != nil {
+			return err
+		}
+
+		// Update the fields
+		medicine.Name = name
+		medicine.Description = description
+		medicine.CompanyID = companyID
+		medicine.UpdatedBy = actor.String()
+		medicine.Offer = offer
+		medicine.Price = price
+		medicine.UpdatedAt = time.Now()
+
+		// Save the updated medicine to the database
+		if err := tx.Save(&medicine).Error; err != nil {
+			return dbError(err, "Medicine")
+		}
+		if err := updateOfferPeriod(tx, medicine.ID, medicine.CompanyID, before.Offer, medicine.Offer, actor); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEntityMedicine, medicine.ID, AuditActionUpdate, &before, &medicine); err != nil {
+			return err
+		}
+		return recordMedicineUpdated(tx, &medicine)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Update the fields
-	medicine.Name = name
-	medicine.Description = description
-	medicine.CompanyID = companyID
-	medicine.UpdatedBy = updatedBy
-	medicine.Offer = offer
-	medicine.UpdatedAt = time.Now()
+	return &medicine, nil
+}
+
+// Delete soft-deletes a medicine. Existing orders keep referring to it.
+func (r *medicineRepo) Delete(id uint, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var medicine Medicine
+
+		// Find the medicine by ID
+		if err := tx.First(&medicine, id).Error; err != nil {
+			return dbError(err, "Medicine")
+		}
+
+		// Delete the medicine; deleted medicines cannot be ordered, so its offer ends
+		if err := tx.Delete(&medicine).Error; err != nil {
+			return dbError(err, "Medicine")
+		}
+		if err := updateOfferPeriod(tx, medicine.ID, medicine.CompanyID, medicine.Offer, "", actor); err != nil {
+			return err
+		}
+
+		if err := recordAudit(tx, actor, AuditEntityMedicine, medicine.ID, AuditActionDelete, &medicine, nil); err != nil {
+			return err
+		}
+		medicine.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		return recordMedicineUpdated(tx, &medicine)
+	})
+}
+
+// Restore undoes the soft deletion of a medicine. Its company must not be deleted.
+func (r *medicineRepo) Restore(id uint, actor Actor) (*Medicine, error) {
+	var medicine Medicine
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().First(&medicine, id).Error; err != nil {
+			return dbError(err, "Medicine")
+		}
+		if !medicine.DeletedAt.Valid {
+			return NewConflictError("Medicine is not deleted")
+		}
+		if err := checkCompany(tx, medicine.CompanyID); err != nil {
+			return NewConflictError("The medicine's company is deleted; restore the company first")
+		}
+		before := medicine
 
-	// Save the updated medicine to the database
-	if err := db.Save(&medicine).Error; err != nil {
+		medicine.DeletedAt = gorm.DeletedAt{}
+		medicine.UpdatedBy = actor.String()
+		medicine.UpdatedAt = time.Now()
+		if err := tx.Unscoped().Save(&medicine).Error; err != nil {
+			return err
+		}
+		if err := updateOfferPeriod(tx, medicine.ID, medicine.CompanyID, "", medicine.Offer, actor); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEntityMedicine, medicine.ID, AuditActionRestore, &before, &medicine); err != nil {
+			return err
+		}
+		return recordMedicineUpdated(tx, &medicine)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &medicine, nil
+	return r.Get(id)
 }
 
-// DeleteMedicine deletes a medicine from the database
-func DeleteMedicine(id uint) error {
+// SetStock sets the units available of a medicine; nil stops tracking its stock
+func (r *medicineRepo) SetStock(id uint, stock *int, actor Actor) (*Medicine, error) {
 	var medicine Medicine
 
-	// Find the medicine by ID
-	if err := db.First(&medicine, id).Error; err != nil {
-		return err
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&medicine, id).Error; err != nil {
+			return dbError(err, "Medicine")
+		}
+		before := medicine
+
+		medicine.Stock = stock
+		medicine.UpdatedBy = actor.String()
+		medicine.UpdatedAt = time.Now()
+		if err := tx.Model(&medicine).Select("stock", "updated_by", "updated_at").Updates(&medicine).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEntityMedicine, medicine.ID, AuditActionUpdate, &before, &medicine); err != nil {
+			return err
+		}
+		return recordMedicineUpdated(tx, &medicine)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Delete the medicine
-	if err := db.Delete(&medicine).Error; err != nil {
+	return r.Get(id)
+}
+
+// checkCompany reports a validation error if the company does not exist
+func checkCompany(db *gorm.DB, companyID uint) error {
+	var count int64
+	if err := db.Model(&Company{}).Where("id = ?", companyID).Count(&count).Error; err != nil {
 		return err
 	}
-
+	if count == 0 {
+		return NewValidationError("company_id", "company does not exist")
+	}
 	return nil
 }
 
-// GetMedicine retrieves a specific medicine by its ID
-func GetMedicine(id uint) (*Medicine, error) {
+// Get retrieves a specific medicine by its ID
+func (r *medicineRepo) Get(id uint) (*Medicine, error) {
 	var medicine Medicine
 
 	// Fetch the medicine by ID and preload its associated company data
-	if err := db.Preload("Company").First(&medicine, id).Error; err != nil {
-		return nil, err
+	if err := r.db.Preload("Company").First(&medicine, id).Error; err != nil {
+		return nil, dbError(err, "Medicine")
 	}
 
 	return &medicine, nil
@@ -126,17 +268,21 @@ func GetMedicine(id uint) (*Medicine, error) {
 //	return medicines, nil
 //}
 
-func GetAllMedicines() ([]CompanyMedicinesResponse, error) {
+// ListByCompany retrieves all medicines and groups them by their associated
+// company, including soft-deleted medicines when requested
+func (r *medicineRepo) ListByCompany(includeDeleted bool) ([]CompanyMedicinesResponse, error) {
 	var medicines []Medicine
 
+	query := r.db.Preload("Company")
+	if includeDeleted {
+		query = r.db.Unscoped().Preload("Company", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+	}
+
 	// Fetch medicines with associated company data
-	if err := db.Preload("Company").Find(&medicines).Error; err != nil {
-		log.Printf("Error fetching medicines: %v", err)
+	if err := query.Find(&medicines).Error; err != nil {
 		return nil, err
 	}
 
-	log.Printf("Fetched %d medicines from database", len(medicines))
-
 	companyMap := make(map[uint]*CompanyMedicinesResponse)
 
 	for _, med := range medicines {
@@ -147,17 +293,17 @@ func GetAllMedicines() ([]CompanyMedicinesResponse, error) {
 				CompanyName: comp.CompanyName,
 				Medicines:   []MedicineDTO{},
 			}
-			log.Printf("Added new company to response: %s (ID: %d)", comp.CompanyName, comp.ID)
 		}
 
 		medicineDTO := MedicineDTO{
 			MedicineID: med.ID,
 			Name:       med.Name,
 			Offer:      med.Offer,
+			Price:      med.Price,
+			Deleted:    med.DeletedAt.Valid,
 		}
 
 		companyMap[comp.ID].Medicines = append(companyMap[comp.ID].Medicines, medicineDTO)
-		log.Printf("Added medicine: %s (ID: %d) with offer: %s to company: %s", med.Name, med.ID, med.Offer, comp.CompanyName)
 	}
 
 	// Convert map to slice
@@ -166,25 +312,6 @@ func GetAllMedicines() ([]CompanyMedicinesResponse, error) {
 		response = append(response, *v)
 	}
 
-	log.Printf("Final response contains %d companies with total medicines", len(response))
-
-	// Print the complete response structure
-	for i, company := range response {
-		log.Printf("Company %d: %s (ID: %d) has %d medicines", i+1, company.CompanyName, company.CompanyID, len(company.Medicines))
-		for j, medicine := range company.Medicines {
-			log.Printf("  Medicine %d: %s (ID: %d) - Offer: %s", j+1, medicine.Name, medicine.MedicineID, medicine.Offer)
-		}
-	}
-
-	// Print the complete JSON response
-	if jsonResponse, err := json.MarshalIndent(response, "", "  "); err == nil {
-		log.Printf("=== COMPLETE MEDICINES RESPONSE JSON ===")
-		log.Printf("%s", string(jsonResponse))
-		log.Printf("=== END MEDICINES RESPONSE JSON ===")
-	} else {
-		log.Printf("Error marshalling response to JSON: %v", err)
-	}
-
 	return response, nil
 }
 
@@ -194,7 +321,8 @@ type ParsedMedicine struct {
 	CompanyName string
 }
 
-func InsertMedicinesFromCSV(filePath string, updatedBy string) error {
+// ImportCSV inserts the medicines listed in a CSV file, creating any companies that don't exist yet
+func (r *medicineRepo) ImportCSV(filePath string, actor Actor) error {
 	// Step 1: Read and parse the CSV
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -205,9 +333,17 @@ func InsertMedicinesFromCSV(filePath string, updatedBy string) error {
 	reader := csv.NewReader(file)
 	_, _ = reader.Read() // skip header
 
+	// Steps 2 and 3 run in one transaction so a failed import leaves no partial data
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return importMedicines(tx, reader, actor)
+	})
+}
+
+// importMedicines inserts the CSV records, creating companies on the way
+func importMedicines(tx *gorm.DB, reader *csv.Reader, actor Actor) error {
 	// Step 2: Load all companies
 	var companies []Company
-	if err := db.Find(&companies).Error; err != nil {
+	if err := tx.Find(&companies).Error; err != nil {
 		return err
 	}
 	companyMap := make(map[string]Company)
@@ -228,6 +364,15 @@ func InsertMedicinesFromCSV(filePath string, updatedBy string) error {
 		name := strings.TrimSpace(record[0])
 		desc := strings.TrimSpace(record[1])
 		companyName := strings.TrimSpace(record[2])
+
+		// The price column is optional
+		var price float64
+		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+			price, err = strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+			if err != nil || price < 0 {
+				continue // skip bad lines
+			}
+		}
 		lookup := strings.ToLower(companyName)
 
 		company, exists := companyMap[lookup]
@@ -236,11 +381,14 @@ func InsertMedicinesFromCSV(filePath string, updatedBy string) error {
 			company = Company{
 				CompanyName: companyName,
 				Description: "Auto-generated via CSV",
-				UpdatedBy:   updatedBy,
+				UpdatedBy:   actor.String(),
 			}
-			if err := db.Create(&company).Error; err != nil {
+			if err := tx.Create(&company).Error; err != nil {
 				return fmt.Errorf("error inserting company: %w", err)
 			}
+			if err := recordAudit(tx, actor, AuditEntityCompany, company.ID, AuditActionCreate, nil, &company); err != nil {
+				return err
+			}
 			companyMap[lookup] = company
 		}
 
@@ -248,9 +396,10 @@ func InsertMedicinesFromCSV(filePath string, updatedBy string) error {
 			Name:        name,
 			Description: desc,
 			CompanyID:   company.ID,
-			UpdatedBy:   updatedBy,
+			UpdatedBy:   actor.String(),
+			Price:       price,
 		}
-		if err := db.Create(&medicine).Error; err != nil {
+		if err := createMedicine(tx, &medicine, actor); err != nil {
 			return fmt.Errorf("error inserting medicine: %w", err)
 		}
 	}
@@ -258,26 +407,54 @@ func InsertMedicinesFromCSV(filePath string, updatedBy string) error {
 	return nil
 }
 
-// UpdateOfferForMedicine updates offer for a specific medicine or all medicines in a company
-func UpdateOfferForMedicine(medicineID uint, companyID uint, offer string, updatedBy string) error {
-	if medicineID == 0 {
-		// Update offer for all medicines under the company
-		if err := db.Model(&Medicine{}).Where("company_id = ?", companyID).Updates(map[string]interface{}{
-			"offer":      offer,
-			"updated_by": updatedBy,
-			"updated_at": time.Now(),
-		}).Error; err != nil {
+// UpdateOffer updates offer for a specific medicine or all medicines in a company
+func (r *medicineRepo) UpdateOffer(medicineID uint, companyID uint, offer string, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkCompany(tx, companyID); err != nil {
 			return err
 		}
-	} else {
-		// Update offer for specific medicine
-		if err := db.Model(&Medicine{}).Where("id = ?", medicineID).Updates(map[string]interface{}{
-			"offer":      offer,
-			"updated_by": updatedBy,
-			"updated_at": time.Now(),
-		}).Error; err != nil {
+
+		query := tx.Where("company_id = ?", companyID)
+		if medicineID != 0 {
+			// Update offer for specific medicine, which must be of the company
+			var medicine Medicine
+			if err := tx.Select("id", "company_id").First(&medicine, medicineID).Error; err != nil {
+				return dbError(err, "Medicine")
+			}
+			if medicine.CompanyID != companyID {
+				return NewValidationError("company_id", "is not the company of the medicine")
+			}
+			query = query.Where("id = ?", medicineID)
+		}
+
+		var medicines []Medicine
+		if err := query.Find(&medicines).Error; err != nil {
 			return err
 		}
-	}
-	return nil
+
+		for _, medicine := range medicines {
+			before := medicine
+			medicine.Offer = offer
+			medicine.UpdatedBy = actor.String()
+			medicine.UpdatedAt = time.Now()
+
+			if err := tx.Model(&Medicine{}).Where("id = ?", medicine.ID).Updates(map[string]interface{}{
+				"offer":      medicine.Offer,
+				"updated_by": medicine.UpdatedBy,
+				"updated_at": medicine.UpdatedAt,
+			}).Error; err != nil {
+				return err
+			}
+			if err := updateOfferPeriod(tx, medicine.ID, medicine.CompanyID, before.Offer, medicine.Offer, actor); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, actor, AuditEntityMedicine, medicine.ID, AuditActionOfferChange, &before, &medicine); err != nil {
+				return err
+			}
+			if err := recordMedicineUpdated(tx, &medicine); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,502 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification channels
+const (
+	ChannelSMS   = "sms"
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+// NotificationChannels lists every channel users can be notified on
+var NotificationChannels = []string{ChannelSMS, ChannelEmail, ChannelPush}
+
+// Notification-only event types
+const (
+	EventOfferLaunched = "offer.launched" // A new offer on a medicine, sent to every customer
+	EventOfferCampaign = "offer.campaign" // An offer promoted to the audience of a campaign
+)
+
+// NotificationEventTypes lists every event users can be notified of
+var NotificationEventTypes = []string{EventOrderCreated, EventOrderStatusChanged, EventOfferLaunched, EventOfferCampaign}
+
+// defaultNotificationChannels are the channels of an event for users who
+// have not chosen their own
+var defaultNotificationChannels = map[string][]string{
+	EventOrderCreated:       {ChannelEmail, ChannelPush},
+	EventOrderStatusChanged: {ChannelSMS, ChannelEmail, ChannelPush},
+	EventOfferLaunched:      {ChannelPush},
+	EventOfferCampaign:      {ChannelSMS, ChannelPush},
+}
+
+// defaultNotificationTemplates are the text of an event's notifications on
+// channels without a template of their own, as {subject, body}
+var defaultNotificationTemplates = map[string][2]string{
+	EventOrderCreated: {
+		"Order #{{.orderId}} received",
+		"Hi {{.name}}, we have received your order #{{.orderId}}{{if .backorderOf}} for the backordered items of order #{{.backorderOf}}{{end}}. We will let you know when it ships.",
+	},
+	EventOrderStatusChanged: {
+		"Order #{{.orderId}} is {{.status}}",
+		"Hi {{.name}}, your order #{{.orderId}} is now {{.status}}.",
+	},
+	EventOfferLaunched: {
+		"New offer on {{.medicineName}}",
+		"{{.companyName}} now offers {{.offer}} on {{.medicineName}}.",
+	},
+	EventOfferCampaign: {
+		"{{.companyName}} offer: {{.offer}}",
+		"Hi {{.name}}, {{.companyName}} is offering {{.offer}}{{if .medicineName}} on {{.medicineName}}{{end}}. Order now to make the most of it.",
+	},
+}
+
+// notificationSamples are example data of each event, used to check
+// templates before they are saved. They hold every field a template can use.
+var notificationSamples = map[string]map[string]interface{}{
+	EventOrderCreated: {
+		"orderId": 42, "status": OrderStatusPending, "backorderOf": nil, "itemCount": 3,
+	},
+	EventOrderStatusChanged: {
+		"orderId": 42, "status": OrderStatusShipped, "previousStatus": OrderStatusProcessing,
+	},
+	EventOfferLaunched: {
+		"medicineId": 7, "medicineName": "Paracetamol 500mg", "companyId": 3, "companyName": "Pharma Corp", "offer": "10+1",
+	},
+	EventOfferCampaign: {
+		"campaignId": 5, "medicineId": 7, "medicineName": "Paracetamol 500mg", "companyId": 3, "companyName": "Pharma Corp", "offer": "10+1",
+	},
+}
+
+// NotificationTemplate is the text of an event's notifications on a channel.
+// Subject and body are Go templates over the event's data and the
+// recipient's name and firmName; SMS ignores the subject.
+type NotificationTemplate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Event     string    `json:"event" gorm:"uniqueIndex:idx_notification_template_event_channel"`
+	Channel   string    `json:"channel" gorm:"uniqueIndex:idx_notification_template_event_channel"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Custom    bool      `json:"custom" gorm:"-"` // false while the built-in text is used
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// TableName specifies the table name for GORM to use
+func (NotificationTemplate) TableName() string {
+	return "notification_template"
+}
+
+// NotificationPreference turns a channel of an event on or off for a user.
+// Events without preferences use defaultNotificationChannels.
+type NotificationPreference struct {
+	UserID  uint   `gorm:"primaryKey;autoIncrement:false"`
+	Event   string `gorm:"primaryKey"`
+	Channel string `gorm:"primaryKey"`
+	Enabled bool
+}
+
+// TableName specifies the table name for GORM to use
+func (NotificationPreference) TableName() string {
+	return "notification_preference"
+}
+
+// UserDevice is a device registered for push notifications
+type UserDevice struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Token     string    `json:"token" gorm:"uniqueIndex"` // Push service registration token
+	Platform  string    `json:"platform"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM to use
+func (UserDevice) TableName() string {
+	return "user_device"
+}
+
+// Device platforms accepted by UserDevice.Platform
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+	PlatformWeb     = "web"
+)
+
+// NotificationEvent is an entry of the notification outbox. Events are
+// written in the same transaction as the change they describe and turned
+// into notifications by the NotificationDispatcher.
+type NotificationEvent struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Type         string     `json:"type"`
+	UserID       *uint      `json:"user_id"`     // nil for events sent to every customer
+	CampaignID   *uint      `json:"campaign_id"` // Campaign whose audience receives the event
+	Payload      AuditJSON  `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"dispatched_at" gorm:"index"` // When notifications were created for it
+}
+
+// TableName specifies the table name for GORM to use
+func (NotificationEvent) TableName() string {
+	return "notification_event"
+}
+
+// Notification is a message to a user on one channel and the outcome of its
+// latest attempt. Sent notifications are kept as the user's history.
+type Notification struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"index"`
+	EventID       uint       `json:"event_id" gorm:"index"`
+	CampaignID    *uint      `json:"campaign_id" gorm:"index"`
+	Event         string     `json:"event"`
+	Channel       string     `json:"channel"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status"` // DeliveryPending, DeliveryDelivered or DeliveryFailed
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" gorm:"index"` // nil once sent or given up
+	LastError     string     `json:"last_error"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM to use
+func (Notification) TableName() string {
+	return "notification"
+}
+
+// recordNotification writes an event to the notification outbox using tx, so
+// that it is committed or rolled back together with the change. userID is
+// the user to notify, or nil to notify every customer.
+func recordNotification(tx *gorm.DB, eventType string, userID *uint, data map[string]interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&NotificationEvent{Type: eventType, UserID: userID, Payload: AuditJSON(payload)}).Error
+}
+
+// recordOfferLaunched notifies customers of a new offer on a medicine
+func recordOfferLaunched(tx *gorm.DB, medicineID, companyID uint, offer string) error {
+	var medicine Medicine
+	if err := tx.Unscoped().Select("name").First(&medicine, medicineID).Error; err != nil {
+		return err
+	}
+	var company Company
+	if err := tx.Unscoped().Select("company_name").First(&company, companyID).Error; err != nil {
+		return err
+	}
+	return recordNotification(tx, EventOfferLaunched, nil, map[string]interface{}{
+		"medicineId":   medicineID,
+		"medicineName": medicine.Name,
+		"companyId":    companyID,
+		"companyName":  company.CompanyName,
+		"offer":        offer,
+	})
+}
+
+// renderNotification fills in a template for a recipient. Fields the event
+// does not have are an error rather than blank text.
+func renderNotification(text string, data map[string]interface{}, user *User) (string, error) {
+	tmpl, err := template.New("notification").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	values := map[string]interface{}{"name": "", "firmName": ""}
+	for key, value := range data {
+		values[key] = value
+	}
+	if user != nil {
+		values["name"] = user.Name
+		values["firmName"] = user.FirmName
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// notificationRepo is the GORM implementation of NotificationRepo
+type notificationRepo struct {
+	db *gorm.DB
+}
+
+// NewNotificationRepo creates a NotificationRepo backed by the given connection
+func NewNotificationRepo(db *gorm.DB) NotificationRepo {
+	return &notificationRepo{db: db}
+}
+
+// Templates returns the template of every event and channel, the built-in
+// text where no custom template was saved
+func (r *notificationRepo) Templates() ([]NotificationTemplate, error) {
+	custom, err := loadNotificationTemplates(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []NotificationTemplate
+	for _, event := range NotificationEventTypes {
+		for _, channel := range NotificationChannels {
+			templates = append(templates, custom.get(event, channel))
+		}
+	}
+	return templates, nil
+}
+
+// UpdateTemplate saves a custom template for an event and channel after
+// checking that it renders
+func (r *notificationRepo) UpdateTemplate(event, channel, subject, body string, actor Actor) (*NotificationTemplate, error) {
+	if _, err := renderNotification(subject, notificationSamples[event], nil); err != nil {
+		return nil, NewValidationError("subject", templateProblem(err))
+	}
+	if _, err := renderNotification(body, notificationSamples[event], nil); err != nil {
+		return nil, NewValidationError("body", templateProblem(err))
+	}
+
+	var saved NotificationTemplate
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var before *NotificationTemplate
+		var existing NotificationTemplate
+		err := tx.Where("event = ? AND channel = ?", event, channel).First(&existing).Error
+		switch {
+		case err == nil:
+			existing.Custom = true
+			before = &existing
+			saved = existing
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		default:
+			saved = NotificationTemplate{Event: event, Channel: channel}
+		}
+
+		saved.Subject = subject
+		saved.Body = body
+		saved.Custom = true
+		saved.UpdatedBy = actor.String()
+		saved.UpdatedAt = time.Now()
+		if err := tx.Save(&saved).Error; err != nil {
+			return err
+		}
+
+		action := AuditActionUpdate
+		if before == nil {
+			action = AuditActionCreate
+		}
+		return recordAudit(tx, actor, AuditEntityNotificationTemplate, saved.ID, action, before, &saved)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ResetTemplate deletes the custom template of an event and channel and
+// returns the built-in one
+func (r *notificationRepo) ResetTemplate(event, channel string, actor Actor) (*NotificationTemplate, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var existing NotificationTemplate
+		if err := tx.Where("event = ? AND channel = ?", event, channel).First(&existing).Error; err != nil {
+			return dbError(err, "Custom template")
+		}
+		if err := tx.Delete(&existing).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityNotificationTemplate, existing.ID, AuditActionDelete, &existing, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	builtIn := notificationTemplates(nil).get(event, channel)
+	return &builtIn, nil
+}
+
+// Preferences returns the channels the user is notified on for every event
+func (r *notificationRepo) Preferences(userID uint) (map[string][]string, error) {
+	prefs, err := loadNotificationPreferences(r.db.Where("user_id = ?", userID))
+	if err != nil {
+		return nil, err
+	}
+
+	channels := map[string][]string{}
+	for _, event := range NotificationEventTypes {
+		channels[event] = prefs.channels(userID, event)
+	}
+	return channels, nil
+}
+
+// UpdatePreferences sets the channels the user is notified on for the given
+// events. Events left out keep their channels.
+func (r *notificationRepo) UpdatePreferences(userID uint, channels map[string][]string) (map[string][]string, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for event, enabled := range channels {
+			if err := tx.Where("user_id = ? AND event = ?", userID, event).Delete(&NotificationPreference{}).Error; err != nil {
+				return err
+			}
+			for _, channel := range NotificationChannels {
+				pref := NotificationPreference{UserID: userID, Event: event, Channel: channel, Enabled: containsString(enabled, channel)}
+				if err := tx.Create(&pref).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Preferences(userID)
+}
+
+// RegisterDevice registers a device for push notifications to the user. A
+// token registered before, possibly by another user who signed in on the
+// same device, is moved to the user.
+func (r *notificationRepo) RegisterDevice(userID uint, token, platform string) (*UserDevice, error) {
+	var device UserDevice
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token = ?", token).First(&device).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		device.UserID = userID
+		device.Token = token
+		device.Platform = platform
+		return tx.Save(&device).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// Devices returns the devices registered by the user
+func (r *notificationRepo) Devices(userID uint) ([]UserDevice, error) {
+	var devices []UserDevice
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// RemoveDevice unregisters one of the user's devices
+func (r *notificationRepo) RemoveDevice(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&UserDevice{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewNotFoundError("Device")
+	}
+	return nil
+}
+
+// ForgetDevice unregisters a token the push service no longer accepts
+func (r *notificationRepo) ForgetDevice(token string) error {
+	return r.db.Where("token = ?", token).Delete(&UserDevice{}).Error
+}
+
+// History returns the newest notifications to the user first, optionally
+// only those with the given status
+func (r *notificationRepo) History(userID uint, status string, limit int) ([]Notification, error) {
+	query := r.db.Where("user_id = ?", userID).Order("id desc").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var notifications []Notification
+	if err := query.Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// notificationTemplates are the custom templates by event and channel
+type notificationTemplates map[[2]string]NotificationTemplate
+
+// loadNotificationTemplates loads the custom templates
+func loadNotificationTemplates(db *gorm.DB) (notificationTemplates, error) {
+	var saved []NotificationTemplate
+	if err := db.Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	templates := notificationTemplates{}
+	for _, t := range saved {
+		t.Custom = true
+		templates[[2]string{t.Event, t.Channel}] = t
+	}
+	return templates, nil
+}
+
+// get returns the custom template of an event and channel, or the built-in one
+func (t notificationTemplates) get(event, channel string) NotificationTemplate {
+	if custom, ok := t[[2]string{event, channel}]; ok {
+		return custom
+	}
+	text := defaultNotificationTemplates[event]
+	return NotificationTemplate{Event: event, Channel: channel, Subject: text[0], Body: text[1]}
+}
+
+// notificationPreferences are the saved channel settings by user, event and
+// channel
+type notificationPreferences map[uint]map[string]map[string]bool
+
+// loadNotificationPreferences loads the preferences matched by query
+func loadNotificationPreferences(query *gorm.DB) (notificationPreferences, error) {
+	var saved []NotificationPreference
+	if err := query.Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	prefs := notificationPreferences{}
+	for _, pref := range saved {
+		if prefs[pref.UserID] == nil {
+			prefs[pref.UserID] = map[string]map[string]bool{}
+		}
+		if prefs[pref.UserID][pref.Event] == nil {
+			prefs[pref.UserID][pref.Event] = map[string]bool{}
+		}
+		prefs[pref.UserID][pref.Event][pref.Channel] = pref.Enabled
+	}
+	return prefs, nil
+}
+
+// channels returns the channels a user is notified on for an event
+func (p notificationPreferences) channels(userID uint, event string) []string {
+	saved, ok := p[userID][event]
+	if !ok {
+		return append([]string{}, defaultNotificationChannels[event]...)
+	}
+	channels := []string{}
+	for _, channel := range NotificationChannels {
+		if saved[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// templateProblem turns a template error into a message for the client
+func templateProblem(err error) string {
+	return "is not a valid template: " + strings.TrimPrefix(err.Error(), "template: notification:")
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
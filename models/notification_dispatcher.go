@@ -0,0 +1,289 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"pharmacy/config"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// notificationBatchSize is the number of events and notifications handled
+// per round
+const notificationBatchSize = 100
+
+// notificationLease keeps other dispatchers away from a notification while
+// it is being sent
+const notificationLease = 2 * time.Minute
+
+// maxNotificationBackoff caps the delay between two attempts of a notification
+const maxNotificationBackoff = 6 * time.Hour
+
+// NotificationDispatcher turns the events in the notification outbox into
+// notifications on the channels each recipient chose and sends them. Every
+// replica of the server can run one; notifications are claimed before they
+// are sent.
+type NotificationDispatcher struct {
+	db        *gorm.DB
+	cfg       config.NotifyConfig
+	notifiers map[string]Notifier
+}
+
+// NewNotificationDispatcher creates a dispatcher on the given connection that
+// sends each channel through its notifier
+func NewNotificationDispatcher(db *gorm.DB, cfg config.NotifyConfig, notifiers map[string]Notifier) *NotificationDispatcher {
+	return &NotificationDispatcher{db: db, cfg: cfg, notifiers: notifiers}
+}
+
+// Run dispatches notifications every poll interval until ctx is cancelled
+func (d *NotificationDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("notification dispatch: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch creates notifications for new events and sends the
+// notifications that are due
+func (d *NotificationDispatcher) Dispatch(ctx context.Context) error {
+	if err := d.fanOut(); err != nil {
+		return err
+	}
+	return d.sendDue(ctx)
+}
+
+// notificationRecipient is a user to notify and the channels to use
+type notificationRecipient struct {
+	user     User
+	channels []string
+}
+
+// fanOut creates a pending notification of each new event for every
+// recipient and channel
+func (d *NotificationDispatcher) fanOut() error {
+	var events []NotificationEvent
+	if err := d.db.Where("dispatched_at IS NULL").Order("id").Limit(notificationBatchSize).Find(&events).Error; err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	templates, err := loadNotificationTemplates(d.db)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		err := d.db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			claim := tx.Model(&NotificationEvent{}).Where("id = ? AND dispatched_at IS NULL", event.ID).Update("dispatched_at", now)
+			if claim.Error != nil || claim.RowsAffected == 0 {
+				return claim.Error // Another dispatcher got there first
+			}
+
+			var data map[string]interface{}
+			decoder := json.NewDecoder(strings.NewReader(string(event.Payload)))
+			decoder.UseNumber()
+			if err := decoder.Decode(&data); err != nil {
+				return err
+			}
+
+			var campaign *Campaign
+			if event.CampaignID != nil {
+				campaign = &Campaign{}
+				if err := tx.First(campaign, *event.CampaignID).Error; err != nil {
+					return err
+				}
+			}
+
+			recipients, err := notificationRecipients(tx, event, campaign)
+			if err != nil {
+				return err
+			}
+
+			var notifications []Notification
+			for _, recipient := range recipients {
+				for _, channel := range recipient.channels {
+					notification := Notification{
+						UserID:        recipient.user.ID,
+						EventID:       event.ID,
+						CampaignID:    event.CampaignID,
+						Event:         event.Type,
+						Channel:       channel,
+						Status:        DeliveryPending,
+						NextAttemptAt: &now,
+					}
+					// A broken template fails its notifications instead of
+					// holding up the others
+					tmpl := templates.get(event.Type, channel)
+					if campaign != nil {
+						tmpl = campaign.messageTemplate(templates, channel)
+					}
+					if notification.Subject, err = renderNotification(tmpl.Subject, data, &recipient.user); err == nil {
+						notification.Body, err = renderNotification(tmpl.Body, data, &recipient.user)
+					}
+					if err != nil {
+						notification.Status = DeliveryFailed
+						notification.NextAttemptAt = nil
+						notification.LastError = err.Error()
+					}
+					notifications = append(notifications, notification)
+				}
+			}
+			if len(notifications) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(notifications, notificationBatchSize).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notificationRecipients returns the users an event is sent to with the
+// channels they chose for it and can be reached on: the event's user, the
+// audience of the campaign, or every approved customer
+func notificationRecipients(tx *gorm.DB, event NotificationEvent, campaign *Campaign) ([]notificationRecipient, error) {
+	users := tx.Model(&User{})
+	prefs := tx.Where("event = ?", event.Type)
+	devices := tx.Model(&UserDevice{})
+	switch {
+	case event.UserID != nil:
+		users = users.Where("id = ?", *event.UserID)
+		prefs = prefs.Where("user_id = ?", *event.UserID)
+		devices = devices.Where("user_id = ?", *event.UserID)
+	case campaign != nil:
+		users = campaign.audience(tx)
+	default:
+		users = users.Where("is_admin = ? AND status = ?", false, UserStatusApproved)
+	}
+
+	var recipients []User
+	if err := users.Order("id").Find(&recipients).Error; err != nil {
+		return nil, err
+	}
+	saved, err := loadNotificationPreferences(prefs)
+	if err != nil {
+		return nil, err
+	}
+	var withDevices []uint
+	if err := devices.Distinct("user_id").Pluck("user_id", &withDevices).Error; err != nil {
+		return nil, err
+	}
+	hasDevice := map[uint]bool{}
+	for _, id := range withDevices {
+		hasDevice[id] = true
+	}
+
+	var result []notificationRecipient
+	for _, user := range recipients {
+		var channels []string
+		chosen := saved.channels(user.ID, event.Type)
+		if campaign != nil {
+			chosen = campaign.channels(saved, user.ID)
+		}
+		for _, channel := range chosen {
+			switch {
+			case channel == ChannelSMS && user.Phone == "",
+				channel == ChannelEmail && user.Email == "",
+				channel == ChannelPush && !hasDevice[user.ID]:
+				continue
+			}
+			channels = append(channels, channel)
+		}
+		if len(channels) > 0 {
+			result = append(result, notificationRecipient{user: user, channels: channels})
+		}
+	}
+	return result, nil
+}
+
+// sendDue sends the pending notifications whose next attempt is due,
+// oldest first
+func (d *NotificationDispatcher) sendDue(ctx context.Context) error {
+	var notifications []Notification
+	err := d.db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, time.Now()).
+		Order("next_attempt_at, id").Limit(notificationBatchSize).Find(&notifications).Error
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := d.attempt(notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt claims a notification, sends it through its channel's notifier and
+// records the outcome
+func (d *NotificationDispatcher) attempt(notification Notification) error {
+	claim := d.db.Model(&Notification{}).
+		Where("id = ? AND status = ? AND attempts = ?", notification.ID, DeliveryPending, notification.Attempts).
+		Updates(map[string]interface{}{"attempts": notification.Attempts + 1, "next_attempt_at": time.Now().Add(notificationLease)})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+	notification.Attempts++
+
+	sendErr := d.send(&notification)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"last_error": "",
+		"updated_at": now,
+	}
+	switch {
+	case sendErr == nil:
+		updates["status"] = DeliveryDelivered
+		updates["sent_at"] = now
+		updates["next_attempt_at"] = nil
+	case notification.Attempts >= d.cfg.MaxAttempts:
+		updates["status"] = DeliveryFailed
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt_at"] = nil
+	default:
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt_at"] = now.Add(retryBackoff(d.cfg.RetryBackoff, notification.Attempts, maxNotificationBackoff))
+	}
+	return d.db.Model(&Notification{}).Where("id = ? AND status = ?", notification.ID, DeliveryPending).Updates(updates).Error
+}
+
+// send hands the notification to the notifier of its channel, addressed to
+// the user's current phone number, email address or devices
+func (d *NotificationDispatcher) send(notification *Notification) error {
+	notifier, ok := d.notifiers[notification.Channel]
+	if !ok {
+		return fmt.Errorf("no notifier for channel %q", notification.Channel)
+	}
+
+	var user User
+	err := d.db.First(&user, notification.UserID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("user no longer exists")
+	}
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(&user, notification.Subject, notification.Body)
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"log"
+)
+
+// Notifier delivers a message to a user over whatever channel the
+// implementation supports (SMS, email, ...)
+type Notifier interface {
+	Notify(user *User, subject, message string) error
+}
+
+// SMSNotifier sends notifications as text messages to the user's phone
+type SMSNotifier struct {
+	Sender SMSSender
+}
+
+// Notify sends the message body by SMS; the subject is not used
+func (n SMSNotifier) Notify(user *User, subject, message string) error {
+	return n.Sender.SendSMS(user.Phone, message)
+}
+
+// LogNotifier writes notifications to the application log
+type LogNotifier struct{}
+
+// Notify logs the notification that would have been sent
+func (LogNotifier) Notify(user *User, subject, message string) error {
+	log.Printf("Notification to user %d (%s): %s - %s", user.ID, user.Phone, subject, message)
+	return nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OfferPeriod records when an offer was active on a medicine. A period is
+// started whenever a medicine's offer changes and ended by the next change.
+type OfferPeriod struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	MedicineID uint       `json:"medicine_id" gorm:"index"`
+	CompanyID  uint       `json:"company_id"`
+	Offer      string     `json:"offer"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"` // nil while the offer is active
+	StartedBy  string     `json:"started_by"`
+	Medicine   Medicine   `json:"-"`
+	Company    Company    `json:"-"`
+}
+
+// TableName specifies the table name for GORM to use
+func (OfferPeriod) TableName() string {
+	return "offer_period"
+}
+
+// updateOfferPeriod ends the open offer period of a medicine and starts a new
+// one for current, if the offer changed from previous, and announces the
+// change to webhooks and a new offer to customers
+func updateOfferPeriod(tx *gorm.DB, medicineID, companyID uint, previous, current string, actor Actor) error {
+	if previous == current {
+		return nil
+	}
+
+	err := recordEvent(tx, EventOfferChanged, map[string]interface{}{
+		"medicineId":    medicineID,
+		"companyId":     companyID,
+		"previousOffer": previous,
+		"offer":         current,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&OfferPeriod{}).
+		Where("medicine_id = ? AND ended_at IS NULL", medicineID).
+		Update("ended_at", now).Error; err != nil {
+		return err
+	}
+	if current == "" {
+		return nil
+	}
+	if err := recordOfferLaunched(tx, medicineID, companyID, current); err != nil {
+		return err
+	}
+
+	return tx.Create(&OfferPeriod{
+		MedicineID: medicineID,
+		CompanyID:  companyID,
+		Offer:      current,
+		StartedAt:  now,
+		StartedBy:  actor.String(),
+	}).Error
+}
+
+// Patterns of offers that give goods away, e.g. "Buy 10 Get 1 Free" or the
+// "10+1" scheme notation
+var (
+	buyGetOfferPattern = regexp.MustCompile(`(?i)\bbuy\s+(\d+)\s+get\s+(\d+)\b`)
+	schemeOfferPattern = regexp.MustCompile(`^\s*(\d+)\s*\+\s*(\d+)\b`)
+)
+
+// FreeQuantity returns the number of free units given with quantity units
+// ordered under offer, or 0 if the offer gives no goods away
+func FreeQuantity(offer string, quantity int) int {
+	match := buyGetOfferPattern.FindStringSubmatch(offer)
+	if match == nil {
+		match = schemeOfferPattern.FindStringSubmatch(offer)
+	}
+	if match == nil {
+		return 0
+	}
+
+	buy, err := strconv.Atoi(match[1])
+	if err != nil || buy == 0 {
+		return 0
+	}
+	free, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0
+	}
+	return quantity / buy * free
+}
+
+// OfferQuery selects the offer periods of an offer effectiveness report.
+// Periods are included when they overlap [From, To).
+type OfferQuery struct {
+	CompanyID  uint
+	MedicineID uint
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// OfferWindow is the ordered volume of a medicine in one window around an offer
+type OfferWindow struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Days          float64   `json:"days"`
+	Quantity      int64     `json:"quantity"`
+	Orders        int64     `json:"orders"`
+	DailyQuantity float64   `json:"dailyQuantity"`
+}
+
+// OfferEffectiveness compares the volume of a medicine before, during and
+// after one offer period. Before and after are as long as the offer ran;
+// after is cut off at the current time and is nil while the offer is active.
+type OfferEffectiveness struct {
+	OfferID      uint         `json:"offerId"`
+	MedicineID   uint         `json:"medicineId"`
+	MedicineName string       `json:"medicineName"`
+	CompanyID    uint         `json:"companyId"`
+	CompanyName  string       `json:"companyName"`
+	Offer        string       `json:"offer"`
+	StartedAt    time.Time    `json:"startedAt"`
+	EndedAt      *time.Time   `json:"endedAt"`
+	Active       bool         `json:"active"`
+	Before       OfferWindow  `json:"before"`
+	During       OfferWindow  `json:"during"`
+	After        *OfferWindow `json:"after"`
+	Firms        int64        `json:"firms"`         // Distinct customers that ordered under the offer
+	FreeQuantity int64        `json:"freeQuantity"`  // Units given away under the offer
+	Uplift       *float64     `json:"upliftPercent"` // Daily quantity during the offer compared with before
+}
+
+// offerRecord is the volume of a medicine around an offer, scanned from one query
+type offerRecord struct {
+	BeforeQuantity int64
+	BeforeOrders   int64
+	DuringQuantity int64
+	DuringOrders   int64
+	AfterQuantity  int64
+	AfterOrders    int64
+	Firms          int64
+	FreeQuantity   int64
+}
+
+// OfferReport measures the offer periods selected by the query, newest first
+func (r *salesRepo) OfferReport(q OfferQuery) ([]OfferEffectiveness, error) {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	query := r.db.Preload("Medicine", unscoped).Preload("Company", unscoped).
+		Where("started_at < ? AND (ended_at IS NULL OR ended_at >= ?)", q.To, q.From).
+		Order("started_at DESC, id DESC").
+		Limit(q.Limit)
+	if q.CompanyID != 0 {
+		query = query.Where("company_id = ?", q.CompanyID)
+	}
+	if q.MedicineID != 0 {
+		query = query.Where("medicine_id = ?", q.MedicineID)
+	}
+
+	var periods []OfferPeriod
+	if err := query.Find(&periods).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := make([]OfferEffectiveness, 0, len(periods))
+	for _, period := range periods {
+		entry, err := r.offerEffectiveness(period, now)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, entry)
+	}
+	return report, nil
+}
+
+// offerEffectiveness aggregates the orders of the offer's medicine in the
+// windows before, during and after the offer with a single query
+func (r *salesRepo) offerEffectiveness(period OfferPeriod, now time.Time) (OfferEffectiveness, error) {
+	end := now
+	if period.EndedAt != nil {
+		end = *period.EndedAt
+	}
+	length := end.Sub(period.StartedAt)
+
+	before := OfferWindow{From: period.StartedAt.Add(-length), To: period.StartedAt}
+	during := OfferWindow{From: period.StartedAt, To: end}
+	after := OfferWindow{From: end, To: end.Add(length)}
+	if after.To.After(now) {
+		after.To = now
+	}
+
+	// Order items count as ordered under the offer when they recorded it
+	between := "o.created_at >= ? AND o.created_at < ?"
+	var record offerRecord
+	err := r.db.Table("order_item AS oi").
+		Joins(`JOIN "order" o ON o.id = oi.order_id`).
+		Select(
+			"COALESCE(SUM(CASE WHEN "+between+" THEN "+netQuantitySQL+" ELSE 0 END), 0) AS before_quantity, "+
+				"COUNT(DISTINCT CASE WHEN "+between+" THEN o.id END) AS before_orders, "+
+				"COALESCE(SUM(CASE WHEN "+between+" THEN "+netQuantitySQL+" ELSE 0 END), 0) AS during_quantity, "+
+				"COUNT(DISTINCT CASE WHEN "+between+" THEN o.id END) AS during_orders, "+
+				"COALESCE(SUM(CASE WHEN "+between+" THEN "+netQuantitySQL+" ELSE 0 END), 0) AS after_quantity, "+
+				"COUNT(DISTINCT CASE WHEN "+between+" THEN o.id END) AS after_orders, "+
+				"COUNT(DISTINCT CASE WHEN "+between+" AND oi.offer = ? THEN o.user_id END) AS firms, "+
+				"COALESCE(SUM(CASE WHEN "+between+" AND oi.offer = ? THEN oi.free_quantity ELSE 0 END), 0) AS free_quantity",
+			before.From.UTC(), before.To.UTC(), before.From.UTC(), before.To.UTC(),
+			during.From.UTC(), during.To.UTC(), during.From.UTC(), during.To.UTC(),
+			after.From.UTC(), after.To.UTC(), after.From.UTC(), after.To.UTC(),
+			during.From.UTC(), during.To.UTC(), period.Offer,
+			during.From.UTC(), during.To.UTC(), period.Offer,
+		).
+		Where("oi.medicine_id = ? AND o.deleted_at IS NULL AND o.status IN ?", period.MedicineID, PlacedOrderStatuses).
+		Where("o.created_at >= ? AND o.created_at < ?", before.From.UTC(), after.To.UTC()).
+		Scan(&record).Error
+	if err != nil {
+		return OfferEffectiveness{}, err
+	}
+
+	entry := OfferEffectiveness{
+		OfferID:      period.ID,
+		MedicineID:   period.MedicineID,
+		MedicineName: period.Medicine.Name,
+		CompanyID:    period.CompanyID,
+		CompanyName:  period.Company.CompanyName,
+		Offer:        period.Offer,
+		StartedAt:    period.StartedAt,
+		EndedAt:      period.EndedAt,
+		Active:       period.EndedAt == nil,
+		Before:       before.with(record.BeforeQuantity, record.BeforeOrders),
+		During:       during.with(record.DuringQuantity, record.DuringOrders),
+		Firms:        record.Firms,
+		FreeQuantity: record.FreeQuantity,
+	}
+	if !entry.Active {
+		after = after.with(record.AfterQuantity, record.AfterOrders)
+		entry.After = &after
+	}
+	entry.Uplift = growthPercent(entry.During.DailyQuantity, entry.Before.DailyQuantity)
+
+	return entry, nil
+}
+
+// with returns the window with its volume and daily average filled in
+func (w OfferWindow) with(quantity, orders int64) OfferWindow {
+	w.Quantity = quantity
+	w.Orders = orders
+	w.Days = math.Round(w.To.Sub(w.From).Hours()/24*100) / 100
+	if w.Days > 0 {
+		w.DailyQuantity = math.Round(float64(quantity)/w.Days*100) / 100
+	}
+	return w
+}
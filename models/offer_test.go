@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestFreeQuantity(t *testing.T) {
+	for _, tc := range []struct {
+		offer    string
+		quantity int
+		want     int
+	}{
+		{"10+1", 25, 2},
+		{" 10 + 2 extra", 30, 6},
+		{"Buy 10 Get 2 Free", 20, 4},
+		{"buy 5 get 1", 4, 0},
+		{"Festive: BUY 3 GET 1", 9, 3},
+		{"0+1", 10, 0},
+		{"Buy 0 Get 1", 10, 0},
+		{"5% off", 100, 0},
+		{"Get 10+1", 22, 0},
+		{"", 10, 0},
+	} {
+		if got := FreeQuantity(tc.offer, tc.quantity); got != tc.want {
+			t.Errorf("FreeQuantity(%q, %d) = %d, want %d", tc.offer, tc.quantity, got, tc.want)
+		}
+	}
+}
@@ -1,18 +1,60 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Order statuses
+const (
+	OrderStatusDraft            = "draft" // Prepared for the customer but not placed yet
+	OrderStatusPending          = "pending"
+	OrderStatusProcessing       = "processing"
+	OrderStatusPartiallyShipped = "partially_shipped" // Shipped in part; the rest was cancelled or backordered
+	OrderStatusShipped          = "shipped"
+	OrderStatusDelivered        = "delivered"
+	OrderStatusCancelled        = "cancelled"
 )
 
+// OrderStatuses lists every order status in workflow order
+var OrderStatuses = []string{OrderStatusDraft, OrderStatusPending, OrderStatusProcessing, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled}
+
+// PlacedOrderStatuses are the statuses of orders that were placed and not
+// cancelled, which are the ones counted in reports
+var PlacedOrderStatuses = []string{OrderStatusPending, OrderStatusProcessing, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusDelivered}
+
+// netQuantitySQL is the quantity of an order item (aliased oi) that was
+// neither cancelled nor moved to a backorder, which is what reports count
+const netQuantitySQL = "(oi.quantity - oi.cancelled_quantity - oi.backordered_quantity)"
+
 type Order struct {
-	ID        uint        `json:"orderId" gorm:"primaryKey"`
-	UserID    uint        `json:"userId"`
-	Items     []OrderItem `json:"items" gorm:"foreignKey:OrderID"`
-	Status    string      `json:"status" gorm:"default:'pending'"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
-	UpdatedBy string      `json:"updated_by"`
-	User      User        `json:"user,omitempty" gorm:"foreignKey:UserID;references:ID"`
+	ID        uint           `json:"orderId" gorm:"primaryKey"`
+	UserID    uint           `json:"userId"`
+	Items     []OrderItem    `json:"items" gorm:"foreignKey:OrderID"`
+	Status    string         `json:"status" gorm:"default:'pending'"`
+	CreatedAt time.Time      `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	UpdatedBy string         `json:"updated_by"`
+	User      User           `json:"user,omitempty" gorm:"foreignKey:UserID;references:ID"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ParentID  *uint          `json:"parent_id" gorm:"index"` // Split order this order is part of
+	Children  []Order        `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+
+	BackorderID   *uint `json:"backorder_id"`                 // Order created for the backordered units
+	BackorderOfID *uint `json:"backorder_of_id" gorm:"index"` // Order this order is a backorder for
+
+	CancelReason      string     `json:"cancel_reason"`
+	CancelNote        string     `json:"cancel_note"`
+	CancelledBy       string     `json:"cancelled_by"`
+	CancelledAt       *time.Time `json:"cancelled_at"`
+	CancelRequestedBy string     `json:"cancel_requested_by"` // Admin whose cancellation is waiting for approval
+	CancelRequestedAt *time.Time `json:"cancel_requested_at"`
+
+	Notes       []OrderNote       `json:"notes,omitempty" gorm:"foreignKey:OrderID"`
+	Attachments []OrderAttachment `json:"attachments,omitempty" gorm:"foreignKey:OrderID"`
 }
 
 // TableName specifies the table name for GORM to use
@@ -21,13 +63,22 @@ func (Order) TableName() string {
 }
 
 type OrderItem struct {
-	ID         uint     `json:"-" gorm:"primaryKey"`
-	OrderID    uint     `json:"-"`
-	MedicineID uint     `json:"medicineId"`
-	CompanyID  uint     `json:"companyId"`
-	Quantity   int      `json:"quantity"`
-	Medicine   Medicine `json:"medicine" gorm:"foreignKey:MedicineID;references:ID"`
-	Company    Company  `json:"company" gorm:"foreignKey:CompanyID;references:ID"`
+	ID           uint    `json:"-" gorm:"primaryKey"`
+	OrderID      uint    `json:"-" gorm:"index"`
+	MedicineID   uint    `json:"medicineId"`
+	CompanyID    uint    `json:"companyId"`
+	Quantity     int     `json:"quantity"`
+	UnitPrice    float64 `json:"unitPrice"`    // Medicine price when the item was ordered
+	Offer        string  `json:"offer"`        // Medicine offer when the item was ordered
+	FreeQuantity int     `json:"freeQuantity"` // Units given free under Offer
+
+	// Fulfilment of the line, recorded when the order is shipped
+	FulfilledQuantity   int      `json:"fulfilledQuantity"`
+	CancelledQuantity   int      `json:"cancelledQuantity"`
+	BackorderedQuantity int      `json:"backorderedQuantity"`
+	ReservedQuantity    int      `json:"reservedQuantity"` // Units taken out of the medicine's stock for the line
+	Medicine            Medicine `json:"medicine" gorm:"foreignKey:MedicineID;references:ID"`
+	Company             Company  `json:"company" gorm:"foreignKey:CompanyID;references:ID"`
 }
 
 // TableName specifies the table name for GORM to use
@@ -41,7 +92,21 @@ type OrderRequest struct {
 	Items       []OrderItemRequest `json:"items"`
 	Status      string             `json:"status"`
 	CreatedAt   time.Time          `json:"createdAt"`
+	Deleted     bool               `json:"deleted,omitempty"`
 	UserDetails *UserDetails       `json:"userDetails,omitempty"`
+
+	ParentOrderID  *uint          `json:"parentOrderId,omitempty"` // Set on the per-company parts of a split order
+	ChildOrders    []OrderRequest `json:"childOrders,omitempty"`   // Set on split orders
+	BackorderID    *uint          `json:"backorderId,omitempty"`   // Order created for the backordered units
+	BackorderOf    *uint          `json:"backorderOf,omitempty"`   // Order this order is a backorder for
+	SplitByCompany bool           `json:"-"`                       // Split the order by company when it is created
+
+	Cancellation *OrderCancellation `json:"cancellation,omitempty"`
+
+	// Notes and attachments are only loaded for a single order
+	Notes       []OrderNote       `json:"notes,omitempty"`
+	Attachments []OrderAttachment `json:"attachments,omitempty"`
+	Note        string            `json:"-"` // Note added when the order is created
 }
 
 type UserDetails struct {
@@ -51,23 +116,30 @@ type UserDetails struct {
 }
 
 type OrderItemRequest struct {
-	MedicineID   uint   `json:"medicineId"`
-	MedicineName string `json:"medicineName,omitempty"`
-	CompanyID    uint   `json:"companyId"`
-	CompanyName  string `json:"companyName,omitempty"`
-	Quantity     int    `json:"quantity"`
+	MedicineID   uint    `json:"medicineId"`
+	MedicineName string  `json:"medicineName,omitempty"`
+	CompanyID    uint    `json:"companyId"`
+	CompanyName  string  `json:"companyName,omitempty"`
+	Quantity     int     `json:"quantity"`
+	UnitPrice    float64 `json:"unitPrice"`
+	Offer        string  `json:"offer,omitempty"`
+	FreeQuantity int     `json:"freeQuantity,omitempty"`
+
+	LineStatus          string `json:"lineStatus,omitempty"`
+	FulfilledQuantity   int    `json:"fulfilledQuantity,omitempty"`
+	CancelledQuantity   int    `json:"cancelledQuantity,omitempty"`
+	BackorderedQuantity int    `json:"backorderedQuantity,omitempty"`
 }
 
 func ConvertOrderToOrderRequest(order *Order, includeUserDetails bool) *OrderRequest {
 	var items []OrderItemRequest
 	for _, item := range order.Items {
-		items = append(items, OrderItemRequest{
-			MedicineID:   item.MedicineID,
-			MedicineName: item.Medicine.Name,
-			CompanyID:    item.CompanyID,
-			CompanyName:  item.Company.CompanyName,
-			Quantity:     item.Quantity,
-		})
+		items = append(items, convertOrderItem(item, order.Status))
+	}
+	for _, child := range order.Children {
+		for _, item := range child.Items {
+			items = append(items, convertOrderItem(item, child.Status))
+		}
 	}
 
 	orderRequest := &OrderRequest{
@@ -76,6 +148,18 @@ func ConvertOrderToOrderRequest(order *Order, includeUserDetails bool) *OrderReq
 		Items:     items,
 		Status:    order.Status,
 		CreatedAt: order.CreatedAt,
+		Deleted:   order.DeletedAt.Valid,
+
+		ParentOrderID: order.ParentID,
+		BackorderID:   order.BackorderID,
+		BackorderOf:   order.BackorderOfID,
+		Cancellation:  convertCancellation(order),
+		Notes:         order.Notes,
+		Attachments:   order.Attachments,
+	}
+
+	for i := range order.Children {
+		orderRequest.ChildOrders = append(orderRequest.ChildOrders, *ConvertOrderToOrderRequest(&order.Children[i], false))
 	}
 
 	// Include user details only if requested (for admin users)
@@ -90,62 +174,147 @@ func ConvertOrderToOrderRequest(order *Order, includeUserDetails bool) *OrderReq
 	return orderRequest
 }
 
-func CreateOrderWithItems(req OrderRequest, updatedBy string) (*OrderRequest, error) {
-	order := Order{
-		UserID:    req.UserID,
-		Status:    "pending",
-		UpdatedBy: updatedBy,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-	if err := db.Create(&order).Error; err != nil {
-		return nil, err
+// convertOrderItem converts an order item with its fulfilment status
+func convertOrderItem(item OrderItem, orderStatus string) OrderItemRequest {
+	return OrderItemRequest{
+		MedicineID:          item.MedicineID,
+		MedicineName:        item.Medicine.Name,
+		CompanyID:           item.CompanyID,
+		CompanyName:         item.Company.CompanyName,
+		Quantity:            item.Quantity,
+		UnitPrice:           item.UnitPrice,
+		Offer:               item.Offer,
+		FreeQuantity:        item.FreeQuantity,
+		LineStatus:          lineStatus(item, orderStatus),
+		FulfilledQuantity:   item.FulfilledQuantity,
+		CancelledQuantity:   item.CancelledQuantity,
+		BackorderedQuantity: item.BackorderedQuantity,
 	}
+}
 
+// allItems returns the items of an order, or of its child orders when it was split
+func (o *Order) allItems() []OrderItem {
+	if len(o.Children) == 0 {
+		return o.Items
+	}
 	var items []OrderItem
-	for _, item := range req.Items {
-		items = append(items, OrderItem{
-			OrderID:    order.ID,
-			MedicineID: item.MedicineID,
-			CompanyID:  item.CompanyID,
-			Quantity:   item.Quantity,
-		})
+	for _, child := range o.Children {
+		items = append(items, child.Items...)
 	}
-	if err := db.Create(&items).Error; err != nil {
+	return items
+}
+
+// orderRepo is the GORM implementation of OrderRepo
+type orderRepo struct {
+	db     *gorm.DB
+	broker OrderBroker
+}
+
+// NewOrderRepo creates an OrderRepo backed by the given connection that
+// publishes new orders and status changes to broker
+func NewOrderRepo(db *gorm.DB, broker OrderBroker) OrderRepo {
+	return &orderRepo{db: db, broker: broker}
+}
+
+// transaction runs fn in a transaction and publishes its order updates once
+// it committed
+func (r *orderRepo) transaction(fn func(tx *gorm.DB) error) error {
+	return publishingTransaction(r.db, r.broker, fn)
+}
+
+// Create creates an order with its items. Orders are pending unless the
+// request asks for a draft, and are split by company when requested.
+func (r *orderRepo) Create(req OrderRequest, actor Actor) (*OrderRequest, error) {
+	status := OrderStatusPending
+	if req.Status == OrderStatusDraft {
+		status = OrderStatusDraft
+	}
+
+	var order *Order
+	err := r.transaction(func(tx *gorm.DB) error {
+		var err error
+		if order, err = createOrder(tx, req.UserID, status, req.Items, actor); err != nil {
+			return err
+		}
+		if req.Note != "" {
+			if _, err = createOrderNote(tx, order.ID, req.Note, actor); err != nil {
+				return err
+			}
+		}
+		if req.SplitByCompany {
+			_, err = splitOrder(tx, order, actor)
+		}
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	// Reload with associations
-	db.Preload("Items.Medicine").Preload("Items.Company").First(&order)
+	order.Items = nil
+	preloadItems(r.db).Preload("Notes").First(order)
 
-	return ConvertOrderToOrderRequest(&order, false), nil
+	return ConvertOrderToOrderRequest(order, false), nil
 }
 
-func GetOrderByID(id uint) (*OrderRequest, error) {
-	var order Order
-	if err := db.Preload("Items.Medicine").Preload("Items.Company").First(&order, id).Error; err != nil {
+// createOrder inserts an order with its items and records it in the audit log
+func createOrder(tx *gorm.DB, userID uint, status string, items []OrderItemRequest, actor Actor) (*Order, error) {
+	order := &Order{
+		UserID:    userID,
+		Status:    status,
+		UpdatedBy: actor.String(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := tx.Create(order).Error; err != nil {
 		return nil, err
 	}
-	return ConvertOrderToOrderRequest(&order, false), nil
+
+	created, err := createOrderItems(tx, order.ID, items)
+	if err != nil {
+		return nil, err
+	}
+	if status != OrderStatusDraft {
+		if err := reserveStock(tx, created); err != nil {
+			return nil, err
+		}
+	}
+	order.Items = created
+
+	if err := recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionCreate, nil, orderAuditState(order)); err != nil {
+		return nil, err
+	}
+	if err := recordOrderCreated(tx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
 }
 
-func GetOrderByIDWithUserDetails(id uint, includeUserDetails bool) (*OrderRequest, error) {
+// Get retrieves an order with its notes and attachments, including the
+// customer's details when requested (for admin users)
+func (r *orderRepo) Get(id uint, includeUserDetails bool) (*OrderRequest, error) {
 	var order Order
-	query := db.Preload("Items.Medicine").Preload("Items.Company")
+	byID := func(db *gorm.DB) *gorm.DB { return db.Order("id") }
+	query := preloadItems(r.db).Preload("Notes", byID).Preload("Attachments", byID)
 
 	if includeUserDetails {
 		query = query.Preload("User")
 	}
 
 	if err := query.First(&order, id).Error; err != nil {
-		return nil, err
+		return nil, dbError(err, "Order")
 	}
 	return ConvertOrderToOrderRequest(&order, includeUserDetails), nil
 }
 
-func GetAllOrders(userID uint, isAdmin bool) ([]OrderRequest, error) {
+// List retrieves all orders for admins, or only the user's own orders
+// otherwise. Admins can include soft-deleted orders.
+func (r *orderRepo) List(userID uint, isAdmin, includeDeleted bool) ([]OrderRequest, error) {
 	var orders []Order
-	query := db.Preload("Items.Medicine").Preload("Items.Company")
+	query := preloadItems(r.db)
+	if isAdmin && includeDeleted {
+		query = query.Unscoped()
+	}
 
 	// Preload user data only if admin is requesting
 	if isAdmin {
@@ -156,7 +325,8 @@ func GetAllOrders(userID uint, isAdmin bool) ([]OrderRequest, error) {
 		query = query.Where("user_id = ?", userID)
 	}
 
-	if err := query.Find(&orders).Error; err != nil {
+	// The parts of split orders are listed under their parent
+	if err := query.Where("parent_id IS NULL").Find(&orders).Error; err != nil {
 		return nil, err
 	}
 
@@ -167,71 +337,295 @@ func GetAllOrders(userID uint, isAdmin bool) ([]OrderRequest, error) {
 	return result, nil
 }
 
-func UpdateOrder(id uint, req OrderRequest, updatedBy string) (*OrderRequest, error) {
+// Update replaces the items of an order
+func (r *orderRepo) Update(id uint, req OrderRequest, actor Actor) (*OrderRequest, error) {
 	var order Order
-	if err := db.First(&order, id).Error; err != nil {
-		return nil, err
-	}
+	var items []OrderItem
 
-	if err := db.Where("order_id = ?", id).Delete(&OrderItem{}).Error; err != nil {
-		return nil, err
-	}
+	err := r.transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Items").Preload("Children").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if len(order.Children) > 0 {
+			return NewConflictError("Order is split by company; update its child orders instead")
+		}
+		switch order.Status {
+		case OrderStatusDraft, OrderStatusPending, OrderStatusProcessing:
+		case OrderStatusCancelled:
+			return NewConflictError("Order is cancelled; its items can no longer be changed")
+		default:
+			return NewConflictError("Order has been shipped; its items can no longer be changed")
+		}
+		// Replacing the items would lose the fulfilment recorded on them
+		for _, item := range order.Items {
+			if item.FulfilledQuantity > 0 || item.CancelledQuantity > 0 || item.BackorderedQuantity > 0 {
+				return NewConflictError("Order has recorded fulfilment; its items can no longer be changed")
+			}
+		}
+		before := orderAuditState(&order)
 
-	var items []OrderItem
-	for _, item := range req.Items {
-		items = append(items, OrderItem{
-			OrderID:    id,
-			MedicineID: item.MedicineID,
-			CompanyID:  item.CompanyID,
-			Quantity:   item.Quantity,
-		})
-	}
-	if err := db.Create(&items).Error; err != nil {
-		return nil, err
-	}
+		if err := releaseOrderStock(tx, order.Items); err != nil {
+			return err
+		}
+		if err := tx.Where("order_id = ?", id).Delete(&OrderItem{}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if items, err = createOrderItems(tx, id, req.Items); err != nil {
+			return err
+		}
+		if order.Status != OrderStatusDraft {
+			if err := reserveStock(tx, items); err != nil {
+				return err
+			}
+		}
+
+		order.Items = nil
+		order.UpdatedAt = time.Now()
+		order.UpdatedBy = actor.String()
+		if err := tx.Save(&order).Error; err != nil {
+			return err
+		}
 
-	order.UserID = req.UserID
-	order.UpdatedAt = time.Now()
-	order.UpdatedBy = updatedBy
-	if err := db.Save(&order).Error; err != nil {
+		order.Items = items
+		return recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionUpdate, before, orderAuditState(&order))
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	db.Preload("Items.Medicine").Preload("Items.Company").First(&order)
+	preloadItems(r.db).First(&order)
 
 	order.Items = items
 	return ConvertOrderToOrderRequest(&order, false), nil
 }
 
-func UpdateOrderStatus(id uint, status string, updatedBy string) (*OrderRequest, error) {
+// UpdateStatus moves an order on to a later status
+func (r *orderRepo) UpdateStatus(id uint, status string, actor Actor) (*OrderRequest, error) {
 	var order Order
-	if err := db.First(&order, id).Error; err != nil {
-		return nil, err
-	}
 
-	order.Status = status
-	order.UpdatedBy = updatedBy
-	order.UpdatedAt = time.Now()
+	err := r.transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Children").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if len(order.Children) > 0 {
+			return NewConflictError("Order is split by company; update the status of its child orders instead")
+		}
+		before := order.Status
+		if err := checkStatusChange(before, status); err != nil {
+			return err
+		}
 
-	if err := db.Save(&order).Error; err != nil {
+		if before == OrderStatusDraft && status != OrderStatusDraft {
+			var items []OrderItem
+			if err := tx.Where("order_id = ?", id).Find(&items).Error; err != nil {
+				return err
+			}
+			if err := reserveStock(tx, items); err != nil {
+				return err
+			}
+		}
+
+		order.Status = status
+		order.UpdatedBy = actor.String()
+		order.UpdatedAt = time.Now()
+
+		if err := tx.Save(&order).Error; err != nil {
+			return err
+		}
+
+		err := recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionStatusChange,
+			map[string]string{"status": before}, map[string]string{"status": status})
+		if err != nil {
+			return err
+		}
+		if err := recordOrderStatusChanged(tx, &order, before, status); err != nil || order.ParentID == nil {
+			return err
+		}
+		return syncSplitStatus(tx, *order.ParentID, actor)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	// Reload with associations
-	if err := db.Preload("Items.Medicine").Preload("Items.Company").First(&order, id).Error; err != nil {
+	if err := preloadItems(r.db).First(&order, id).Error; err != nil {
 		return nil, err
 	}
 
 	return ConvertOrderToOrderRequest(&order, false), nil
 }
 
-func DeleteOrder(id uint) error {
-	var order Order
-	if err := db.First(&order, id).Error; err != nil {
-		return err
+// checkStatusChange returns an error unless UpdateStatus may move an order
+// from one status to another. Orders only move forward through
+// OrderStatuses: shipped orders, in full or in part, can only be marked
+// delivered, and cancelled and delivered orders are final. Cancellations and
+// partial shipments have their own paths.
+func checkStatusChange(from, to string) error {
+	switch from {
+	case OrderStatusCancelled, OrderStatusDelivered:
+		return NewConflictError(fmt.Sprintf("Order is %s; its status can no longer be changed", from))
+	case OrderStatusShipped, OrderStatusPartiallyShipped:
+		if to != OrderStatusDelivered {
+			return NewConflictError("Shipped orders can only be marked delivered")
+		}
+		return nil
 	}
-	if err := db.Delete(&OrderItem{}, "order_id = ?", id).Error; err != nil {
-		return err
+
+	position := func(status string) int {
+		for i, s := range OrderStatuses {
+			if s == status {
+				return i
+			}
+		}
+		return -1
+	}
+	if position(to) <= position(from) {
+		return NewConflictError(fmt.Sprintf("Order cannot move from %s back to %s", from, to))
+	}
+	return nil
+}
+
+// Delete soft-deletes an order, together with its child orders when it was
+// split. Its items are kept so that it can be restored, but stock reserved
+// for them is released and not reserved again on restore.
+func (r *orderRepo) Delete(id uint, actor Actor) error {
+	return r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Preload("Items").Preload("Children.Items").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if order.ParentID != nil {
+			return NewConflictError(fmt.Sprintf("Order is part of split order %d; delete that order instead", *order.ParentID))
+		}
+
+		// Stock reserved for orders that were not shipped goes back to stock
+		for _, deleted := range append([]Order{order}, order.Children...) {
+			if deleted.Status != OrderStatusPending && deleted.Status != OrderStatusProcessing {
+				continue
+			}
+			if err := releaseOrderStock(tx, deleted.Items); err != nil {
+				return err
+			}
+		}
+
+		orders := append([]Order{order}, order.Children...)
+		for i := range orders {
+			if err := tx.Model(&Order{}).Where("id = ?", orders[i].ID).Update("updated_by", actor.String()).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&Order{}, orders[i].ID).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, actor, AuditEntityOrder, orders[i].ID, AuditActionDelete, orderAuditState(&orders[i]), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore undoes the soft deletion of an order, together with its child
+// orders when it was split
+func (r *orderRepo) Restore(id uint, actor Actor) (*OrderRequest, error) {
+	err := r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Unscoped().First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if order.ParentID != nil {
+			return NewConflictError(fmt.Sprintf("Order is part of split order %d; restore that order instead", *order.ParentID))
+		}
+		if !order.DeletedAt.Valid {
+			return NewConflictError("Order is not deleted")
+		}
+
+		var children []Order
+		if err := tx.Unscoped().Where("parent_id = ?", id).Find(&children).Error; err != nil {
+			return err
+		}
+
+		for _, restored := range append([]Order{order}, children...) {
+			err := tx.Unscoped().Model(&Order{}).Where("id = ?", restored.ID).Updates(map[string]interface{}{
+				"deleted_at": nil,
+				"updated_by": actor.String(),
+				"updated_at": time.Now(),
+			}).Error
+			if err != nil {
+				return err
+			}
+			err = recordAudit(tx, actor, AuditEntityOrder, restored.ID, AuditActionRestore,
+				map[string]bool{"deleted": true}, map[string]bool{"deleted": false})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(id, true)
+}
+
+// preloadItems loads the items of orders and of their child orders with their
+// medicine and company, including soft-deleted ones so that past orders stay
+// complete
+func preloadItems(db *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	return db.Preload("Items.Medicine", unscoped).Preload("Items.Company", unscoped).
+		Preload("Children", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Children.Items.Medicine", unscoped).Preload("Children.Items.Company", unscoped)
+}
+
+// createOrderItems inserts the items of an order with the company, price and
+// offer of their medicines
+func createOrderItems(tx *gorm.DB, orderID uint, requested []OrderItemRequest) ([]OrderItem, error) {
+	var items []OrderItem
+	for i, item := range requested {
+		var medicine Medicine
+		err := tx.Select("id", "company_id", "price", "offer").First(&medicine, item.MedicineID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewValidationError(fmt.Sprintf("items[%d].medicineId", i), "medicine does not exist")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item.CompanyID != 0 && item.CompanyID != medicine.CompanyID {
+			return nil, NewValidationError(fmt.Sprintf("items[%d].companyId", i), "is not the company of the medicine")
+		}
+
+		items = append(items, OrderItem{
+			OrderID:      orderID,
+			MedicineID:   item.MedicineID,
+			CompanyID:    medicine.CompanyID,
+			Quantity:     item.Quantity,
+			UnitPrice:    medicine.Price,
+			Offer:        medicine.Offer,
+			FreeQuantity: FreeQuantity(medicine.Offer, item.Quantity),
+		})
+	}
+	if err := tx.Create(&items).Error; err != nil {
+		return nil, dbError(err, "Order item")
+	}
+	return items, nil
+}
+
+// orderAuditState is the part of an order recorded in the audit log
+func orderAuditState(order *Order) map[string]interface{} {
+	items := []OrderItemRequest{}
+	for _, item := range order.Items {
+		items = append(items, OrderItemRequest{
+			MedicineID: item.MedicineID,
+			CompanyID:  item.CompanyID,
+			Quantity:   item.Quantity,
+		})
+	}
+	return map[string]interface{}{
+		"user_id": order.UserID,
+		"status":  order.Status,
+		"items":   items,
 	}
-	return db.Delete(&order).Error
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckStatusChange(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		allowed  bool
+	}{
+		{OrderStatusDraft, OrderStatusPending, true},
+		{OrderStatusPending, OrderStatusProcessing, true},
+		{OrderStatusPending, OrderStatusShipped, true},
+		{OrderStatusProcessing, OrderStatusPartiallyShipped, true},
+		{OrderStatusProcessing, OrderStatusCancelled, true},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusPartiallyShipped, OrderStatusDelivered, true},
+		{OrderStatusPending, OrderStatusPending, false},
+		{OrderStatusProcessing, OrderStatusPending, false},
+		{OrderStatusPending, OrderStatusDraft, false},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusPartiallyShipped, OrderStatusShipped, false},
+		{OrderStatusDelivered, OrderStatusCancelled, false},
+		{OrderStatusCancelled, OrderStatusPending, false},
+	} {
+		err := checkStatusChange(tc.from, tc.to)
+		if tc.allowed && err != nil {
+			t.Errorf("%s to %s: %v, want it allowed", tc.from, tc.to, err)
+		}
+		if !tc.allowed && !errors.As(err, new(*ConflictError)) {
+			t.Errorf("%s to %s: %v, want a ConflictError", tc.from, tc.to, err)
+		}
+	}
+}
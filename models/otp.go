@@ -0,0 +1,146 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// OTP settings for phone login
+const (
+	otpLength         = 6
+	otpTTL            = 5 * time.Minute
+	otpResendInterval = time.Minute
+	otpMaxPerHour     = 5
+	otpMaxAttempts    = 5
+)
+
+// Errors returned by the OTP login flow
+var (
+	ErrOTPRateLimited = errors.New("too many OTP requests, please try again later")
+	ErrOTPInvalid     = errors.New("invalid or expired OTP")
+)
+
+// OTPCode stores a hashed one-time password issued for phone login
+type OTPCode struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Phone      string     `json:"phone" gorm:"index"`
+	CodeHash   string     `json:"-"`
+	Attempts   int        `json:"attempts"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for GORM to use
+func (OTPCode) TableName() string {
+	return "otp_code"
+}
+
+// RequestOTP issues a new login code for the given phone and sends it by SMS.
+// Every phone number is rate limited and answered the same way, but codes are
+// only sent to registered numbers, so the endpoint can't be used to discover
+// which numbers are registered.
+func (a *AuthService) RequestOTP(phone string) error {
+	code, err := generateOTP()
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		// The limits are checked by the insert itself so that concurrent
+		// requests can't both pass them
+		result := tx.Exec(`INSERT INTO otp_code (phone, code_hash, attempts, expires_at, created_at)
+			SELECT ?, ?, 0, ?, ?
+			WHERE NOT EXISTS (SELECT 1 FROM otp_code WHERE phone = ? AND created_at > ?)
+			AND (SELECT COUNT(*) FROM otp_code WHERE phone = ? AND created_at > ?) < ?`,
+			phone, string(hash), now.Add(otpTTL), now,
+			phone, now.Add(-otpResendInterval),
+			phone, now.Add(-time.Hour), otpMaxPerHour)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOTPRateLimited
+		}
+
+		// Issuing a new code invalidates any earlier ones still outstanding
+		return tx.Model(&OTPCode{}).Where("phone = ? AND consumed_at IS NULL AND created_at < ?", phone, now).Update("consumed_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.users.GetByPhone(phone); err != nil {
+		return nil
+	}
+	message := fmt.Sprintf("Your pharmacy login code is %s. It expires in %d minutes.", code, int(otpTTL.Minutes()))
+	return a.sms.SendSMS(phone, message)
+}
+
+// VerifyOTP checks a login code and starts a new session for the user on
+// success. Each code can be used once and allows a limited number of wrong guesses.
+func (a *AuthService) VerifyOTP(phone, code string) (*TokenPair, *User, error) {
+	var otp OTPCode
+	if err := a.db.Where("phone = ? AND consumed_at IS NULL AND expires_at > ?", phone, time.Now()).
+		Order("created_at desc").First(&otp).Error; err != nil {
+		return nil, nil, ErrOTPInvalid
+	}
+
+	if otp.Attempts >= otpMaxAttempts {
+		return nil, nil, ErrOTPInvalid
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(otp.CodeHash), []byte(code)); err != nil {
+		a.db.Model(&otp).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		return nil, nil, ErrOTPInvalid
+	}
+
+	// Consume the code atomically so two concurrent requests can't both use it
+	result := a.db.Model(&OTPCode{}).Where("id = ? AND consumed_at IS NULL", otp.ID).Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrOTPInvalid
+	}
+
+	user, err := a.users.GetByPhone(phone)
+	if err != nil {
+		return nil, nil, ErrOTPInvalid
+	}
+
+	if err := checkCanLogin(user); err != nil {
+		return nil, user, err
+	}
+
+	tokens, err := a.CreateSession(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, user, nil
+}
+
+// generateOTP returns a random numeric code of otpLength digits
+func generateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpLength, n), nil
+}
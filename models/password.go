@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password reset settings
+const (
+	minPasswordLength   = 6
+	resetTokenTTL       = 30 * time.Minute
+	resetResendInterval = time.Minute
+)
+
+// Errors returned by the password functions
+var (
+	ErrPasswordTooShort  = NewValidationError("password", fmt.Sprintf("must be at least %d characters", minPasswordLength))
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrResetRateLimited  = errors.New("a reset link was sent recently, please try again later")
+)
+
+// PasswordResetToken is a single-use token for the forgot-password flow.
+// Only a hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for GORM to use
+func (PasswordResetToken) TableName() string {
+	return "password_reset_token"
+}
+
+// ChangePassword sets a new password for the actor after checking the current
+// one. Every other session of the user is revoked; keepSessionID stays logged in.
+func (a *AuthService) ChangePassword(actor Actor, keepSessionID uint, oldPassword, newPassword string) error {
+	userID := actor.UserID
+	user, err := a.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	if err := a.setPassword(user, newPassword, actor); err != nil {
+		return err
+	}
+
+	return a.db.Model(&Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RequestPasswordReset issues a reset token for the user with the given phone
+// and delivers it through the configured notifier. Unknown phone numbers are
+// silently ignored.
+func (a *AuthService) RequestPasswordReset(phone string) error {
+	user, err := a.users.GetByPhone(phone)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	var last PasswordResetToken
+	if err := a.db.Where("user_id = ?", user.ID).Order("created_at desc").First(&last).Error; err == nil && now.Sub(last.CreatedAt) < resetResendInterval {
+		return ErrResetRateLimited
+	}
+
+	token, err := generateRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	reset := PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(resetTokenTTL),
+		CreatedAt: now,
+	}
+	if err := a.db.Create(&reset).Error; err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your pharmacy password reset code is %s. It expires in %d minutes. Ignore this message if you did not request it.", token, int(resetTokenTTL.Minutes()))
+	return a.notifier.Notify(user, "Password reset", message)
+}
+
+// ResetPassword sets a new password using a reset token. The token and any
+// other outstanding tokens for the user are invalidated, and every existing
+// session is revoked. The change is attributed to the token's user, seen from
+// the actor's IP address.
+func (a *AuthService) ResetPassword(token, newPassword string, actor Actor) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	now := time.Now()
+	var reset PasswordResetToken
+	if err := a.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), now).First(&reset).Error; err != nil {
+		return ErrInvalidResetToken
+	}
+
+	// Mark every unused token of the user as used, atomically claiming this one
+	result := a.db.Model(&PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", reset.UserID).Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidResetToken
+	}
+
+	user, err := a.users.GetByID(reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	actor.UserID = user.ID
+	if err := a.setPassword(user, newPassword, actor); err != nil {
+		return err
+	}
+
+	_, err = a.RevokeUserSessions(user.ID)
+	return err
+}
+
+// SetPassword replaces a user's password without the old one, e.g. when an
+// operator resets it, and revokes every session of the user
+func (a *AuthService) SetPassword(userID uint, newPassword string, actor Actor) error {
+	user, err := a.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.setPassword(user, newPassword, actor); err != nil {
+		return err
+	}
+
+	_, err = a.RevokeUserSessions(user.ID)
+	return err
+}
+
+func (a *AuthService) setPassword(user *User, password string, actor Actor) error {
+	if len(password) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	return a.users.UpdatePassword(user.ID, password, actor)
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReorderSuggestion is a medicine a customer orders regularly, with the
+// quantity they usually order and when they are expected to order it next
+type ReorderSuggestion struct {
+	MedicineID    uint      `json:"medicineId"`
+	MedicineName  string    `json:"medicineName"`
+	CompanyID     uint      `json:"companyId"`
+	CompanyName   string    `json:"companyName"`
+	Price         float64   `json:"price"`
+	Offer         string    `json:"offer,omitempty"`
+	UsualQuantity int       `json:"usualQuantity"` // Median quantity per order
+	Orders        int       `json:"orders"`        // Orders containing the medicine in the lookback window
+	CadenceDays   float64   `json:"cadenceDays"`   // Median days between those orders
+	LastOrderedAt time.Time `json:"lastOrderedAt"`
+	NextOrderAt   time.Time `json:"nextOrderAt"`
+	Due           bool      `json:"due"` // Next order is expected within the requested horizon
+}
+
+// ReorderQuery selects the order history used for reorder suggestions
+type ReorderQuery struct {
+	UserID    uint
+	Since     time.Time // Only orders created after this time are considered
+	MinOrders int       // Medicines need to appear in at least this many orders
+	DueBefore time.Time // Suggestions expected before this time are marked as due
+}
+
+// ReorderResult is the outcome of repeating a past order: the new order or
+// the updated cart, and how the items differ from the original order
+type ReorderResult struct {
+	Order   *OrderRequest   `json:"order,omitempty"`
+	Cart    *Cart           `json:"cart,omitempty"`
+	Dropped []ReorderChange `json:"dropped"` // Items left out because their medicine is no longer available
+	Changed []ReorderChange `json:"changed"` // Items whose price or offer changed since the original order
+}
+
+// ReorderChange describes an item of the original order that was dropped or
+// whose price or offer changed
+type ReorderChange struct {
+	MedicineID    uint    `json:"medicineId"`
+	MedicineName  string  `json:"medicineName"`
+	Quantity      int     `json:"quantity"`
+	PreviousPrice float64 `json:"previousPrice"`
+	Price         float64 `json:"price"`
+	PreviousOffer string  `json:"previousOffer,omitempty"`
+	Offer         string  `json:"offer,omitempty"`
+}
+
+// Reorder copies the items of a past order owned by userID into a new
+// pending order, or into the user's cart when toCart is set, at the current
+// prices and offers. Medicines that were deleted since are left out.
+func (r *orderRepo) Reorder(id, userID uint, toCart bool, actor Actor) (*ReorderResult, error) {
+	var original Order
+	if err := preloadItems(r.db).First(&original, id).Error; err != nil {
+		return nil, dbError(err, "Order")
+	}
+	if original.UserID != userID {
+		return nil, NewForbiddenError("You can only reorder your own orders")
+	}
+
+	result := &ReorderResult{Dropped: []ReorderChange{}, Changed: []ReorderChange{}}
+	var items []OrderItemRequest
+	for _, item := range original.allItems() {
+		medicine := item.Medicine
+		change := ReorderChange{
+			MedicineID:    item.MedicineID,
+			MedicineName:  medicine.Name,
+			Quantity:      item.Quantity,
+			PreviousPrice: item.UnitPrice,
+			Price:         medicine.Price,
+			PreviousOffer: item.Offer,
+			Offer:         medicine.Offer,
+		}
+		if medicine.ID == 0 || medicine.DeletedAt.Valid {
+			change.Price, change.Offer = 0, ""
+			result.Dropped = append(result.Dropped, change)
+			continue
+		}
+		if medicine.Price != item.UnitPrice || medicine.Offer != item.Offer {
+			result.Changed = append(result.Changed, change)
+		}
+		items = append(items, OrderItemRequest{
+			MedicineID: item.MedicineID,
+			CompanyID:  medicine.CompanyID,
+			Quantity:   item.Quantity,
+		})
+	}
+	if len(items) == 0 {
+		return nil, NewValidationError("items", "none of the order's medicines are available any more")
+	}
+
+	if toCart {
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			for _, item := range items {
+				if err := addCartItem(tx, userID, item.MedicineID, item.Quantity); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.Cart, err = NewCartRepo(r.db, r.broker).Get(userID); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	order, err := r.Create(OrderRequest{UserID: userID, Items: items}, actor)
+	if err != nil {
+		return nil, err
+	}
+	result.Order = order
+	return result, nil
+}
+
+// reorderLine is the quantity of one medicine in one order
+type reorderLine struct {
+	OrderID      uint
+	CreatedAt    time.Time
+	MedicineID   uint
+	MedicineName string
+	CompanyID    uint
+	CompanyName  string
+	Price        float64
+	Offer        string
+	Quantity     int
+}
+
+// ReorderSuggestions derives reorder suggestions from the customer's placed
+// orders, soonest first. Medicines that were deleted since are left out, and
+// backorders count as part of the order they were created for.
+func (r *orderRepo) ReorderSuggestions(q ReorderQuery) ([]ReorderSuggestion, error) {
+	var lines []reorderLine
+	err := r.db.Table("order_item AS oi").
+		Select("o.id AS order_id, o.created_at, m.id AS medicine_id, m.name AS medicine_name, "+
+			"m.company_id, c.company_name, m.price, m.offer, SUM(oi.quantity - oi.cancelled_quantity) AS quantity").
+		Joins(`JOIN "order" o ON o.id = oi.order_id`).
+		Joins("JOIN medicine m ON m.id = oi.medicine_id AND m.deleted_at IS NULL").
+		Joins("JOIN company c ON c.id = m.company_id").
+		Where("o.user_id = ? AND o.deleted_at IS NULL AND o.backorder_of_id IS NULL AND o.status IN ? AND o.created_at >= ?",
+			q.UserID, PlacedOrderStatuses, q.Since.UTC()).
+		Group("o.id, o.created_at, m.id, m.name, m.company_id, c.company_name, m.price, m.offer").
+		Order("o.created_at").
+		Scan(&lines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byMedicine := map[uint][]reorderLine{}
+	var medicineIDs []uint
+	for _, line := range lines {
+		if _, seen := byMedicine[line.MedicineID]; !seen {
+			medicineIDs = append(medicineIDs, line.MedicineID)
+		}
+		byMedicine[line.MedicineID] = append(byMedicine[line.MedicineID], line)
+	}
+
+	suggestions := []ReorderSuggestion{}
+	for _, id := range medicineIDs {
+		history := byMedicine[id]
+		if len(history) < q.MinOrders || len(history) < 2 {
+			continue
+		}
+		suggestions = append(suggestions, reorderSuggestion(history, q.DueBefore))
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].NextOrderAt.Before(suggestions[j].NextOrderAt)
+	})
+	return suggestions, nil
+}
+
+// reorderSuggestion summarises the order history of one medicine, oldest first
+func reorderSuggestion(history []reorderLine, dueBefore time.Time) ReorderSuggestion {
+	quantities := make([]float64, 0, len(history))
+	intervals := make([]float64, 0, len(history)-1)
+	for i, line := range history {
+		quantities = append(quantities, float64(line.Quantity))
+		if i > 0 {
+			intervals = append(intervals, line.CreatedAt.Sub(history[i-1].CreatedAt).Hours()/24)
+		}
+	}
+
+	last := history[len(history)-1]
+	cadence := median(intervals)
+	next := last.CreatedAt.Add(time.Duration(cadence * float64(24*time.Hour)))
+
+	return ReorderSuggestion{
+		MedicineID:    last.MedicineID,
+		MedicineName:  last.MedicineName,
+		CompanyID:     last.CompanyID,
+		CompanyName:   last.CompanyName,
+		Price:         last.Price,
+		Offer:         last.Offer,
+		UsualQuantity: int(median(quantities) + 0.5),
+		Orders:        len(history),
+		CadenceDays:   float64(int(cadence*10+0.5)) / 10,
+		LastOrderedAt: last.CreatedAt,
+		NextOrderAt:   next,
+		Due:           next.Before(dueBefore),
+	}
+}
+
+// median returns the middle value of values, or the mean of the two middle values
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
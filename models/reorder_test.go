@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMedian(t *testing.T) {
+	for _, tc := range []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{7}, 7},
+		{[]float64{9, 1, 5}, 5},
+		{[]float64{30, 10, 20, 12}, 16},
+	} {
+		if got := median(tc.values); got != tc.want {
+			t.Errorf("median(%v) = %v, want %v", tc.values, got, tc.want)
+		}
+	}
+
+	values := []float64{3, 1, 2}
+	median(values)
+	if values[0] != 3 || values[1] != 1 {
+		t.Fatalf("median sorted its argument: %v", values)
+	}
+}
+
+func TestReorderSuggestion(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	line := func(day float64, quantity int) reorderLine {
+		return reorderLine{
+			CreatedAt:    start.Add(time.Duration(day * float64(24*time.Hour))),
+			MedicineID:   3,
+			MedicineName: "Paracetamol",
+			Price:        10,
+			Quantity:     quantity,
+		}
+	}
+
+	history := []reorderLine{line(0, 10), line(10, 20), line(24, 12), line(36, 30)}
+	last := history[len(history)-1].CreatedAt
+	suggestion := reorderSuggestion(history, last.Add(13*24*time.Hour))
+	if suggestion.CadenceDays != 12 || suggestion.UsualQuantity != 16 || suggestion.Orders != 4 {
+		t.Fatalf("suggestion = %+v, want a 12 day cadence of 16 units over 4 orders", suggestion)
+	}
+	if !suggestion.LastOrderedAt.Equal(last) || !suggestion.NextOrderAt.Equal(last.Add(12*24*time.Hour)) {
+		t.Fatalf("last and next order = %v and %v, want the next 12 days after the last", suggestion.LastOrderedAt, suggestion.NextOrderAt)
+	}
+	if !suggestion.Due || suggestion.MedicineID != 3 || suggestion.MedicineName != "Paracetamol" {
+		t.Fatalf("suggestion = %+v, want Paracetamol due within 13 days", suggestion)
+	}
+	if reorderSuggestion(history, last.Add(12*24*time.Hour)).Due {
+		t.Fatal("suggestion due before its next order date")
+	}
+
+	suggestion = reorderSuggestion([]reorderLine{line(0, 5), line(1.5, 6), line(2.5, 6)}, start)
+	if suggestion.CadenceDays != 1.3 || suggestion.UsualQuantity != 6 {
+		t.Fatalf("suggestion = %+v, want the cadence rounded to 1.3 days and 6 units", suggestion)
+	}
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// UserRepo stores user accounts
+type UserRepo interface {
+	Create(name, email, phone, password, firmName, city string, actor Actor) (*User, error)
+	CreateAdmin(name, email, phone, password, firmName string, actor Actor) (*User, error)
+	GetByID(id uint) (*User, error)
+	GetByPhone(phone string) (*User, error)
+	Update(id uint, name, phone, firmName, city string, tier *string, isAdmin *bool, actor Actor) (*User, error)
+	UpdatePassword(id uint, password string, actor Actor) error
+	ListByStatus(status string) ([]User, error)
+	Approve(id uint, actor Actor) (*User, error)
+	Reject(id uint, reason string, actor Actor) (*User, error)
+}
+
+// CompanyRepo stores companies
+type CompanyRepo interface {
+	Create(companyName, description, logoUrl string, actor Actor) (*Company, error)
+	Get(id uint) (*Company, error)
+	Update(id uint, companyName, description, logoUrl string, actor Actor) (*Company, error)
+	Delete(id uint, actor Actor) error
+	Restore(id uint, actor Actor) (*Company, error)
+	List(includeDeleted bool) ([]Company, error)
+}
+
+// MedicineRepo stores medicines and their offers
+type MedicineRepo interface {
+	Create(name, description string, companyID uint, price float64, offer string, actor Actor) (*Medicine, error)
+	Get(id uint) (*Medicine, error)
+	Update(id uint, name, description string, companyID uint, price float64, offer string, actor Actor) (*Medicine, error)
+	Delete(id uint, actor Actor) error
+	Restore(id uint, actor Actor) (*Medicine, error)
+	ListByCompany(includeDeleted bool) ([]CompanyMedicinesResponse, error)
+	ImportCSV(filePath string, actor Actor) error
+	UpdateOffer(medicineID uint, companyID uint, offer string, actor Actor) error
+	SetStock(id uint, stock *int, actor Actor) (*Medicine, error)
+}
+
+// OrderRepo stores orders and their items
+type OrderRepo interface {
+	Create(req OrderRequest, actor Actor) (*OrderRequest, error)
+	Get(id uint, includeUserDetails bool) (*OrderRequest, error)
+	List(userID uint, isAdmin, includeDeleted bool) ([]OrderRequest, error)
+	Update(id uint, req OrderRequest, actor Actor) (*OrderRequest, error)
+	UpdateStatus(id uint, status string, actor Actor) (*OrderRequest, error)
+	Delete(id uint, actor Actor) error
+	Restore(id uint, actor Actor) (*OrderRequest, error)
+	Split(id uint, actor Actor) (*OrderRequest, error)
+	Fulfil(id uint, fulfilments []Fulfilment, actor Actor) (*OrderRequest, error)
+	Cancel(id uint, reason, note string, isAdmin bool, actor Actor) (*OrderRequest, error)
+	ApproveCancellation(id uint, actor Actor) (*OrderRequest, error)
+	RejectCancellation(id uint, actor Actor) (*OrderRequest, error)
+	ReorderSuggestions(query ReorderQuery) ([]ReorderSuggestion, error)
+	Reorder(id, userID uint, toCart bool, actor Actor) (*ReorderResult, error)
+	AddNote(orderID uint, body string, actor Actor) (*OrderNote, error)
+	AddAttachment(attachment *OrderAttachment, actor Actor) error
+	GetAttachment(orderID, attachmentID uint) (*OrderAttachment, error)
+	DeleteAttachment(orderID, attachmentID uint, actor Actor) (*OrderAttachment, error)
+}
+
+// CartRepo stores each user's cart
+type CartRepo interface {
+	Get(userID uint) (*Cart, error)
+	AddItem(userID, medicineID uint, quantity int) (*Cart, error)
+	SetItem(userID, medicineID uint, quantity int) (*Cart, error)
+	RemoveItem(userID, medicineID uint) (*Cart, error)
+	Clear(userID uint) error
+	Checkout(userID uint, actor Actor) (*OrderRequest, error)
+}
+
+// AuditRepo reads the audit log. Records are written by the other
+// repositories in the same transaction as the change they describe.
+type AuditRepo interface {
+	List(entityType string, entityID uint, limit int) ([]AuditLog, error)
+}
+
+// SalesRepo aggregates order data for reporting
+type SalesRepo interface {
+	Report(query SalesQuery) (*SalesReport, error)
+	OfferReport(query OfferQuery) ([]OfferEffectiveness, error)
+}
+
+// WebhookRepo stores webhook endpoints and the log of deliveries to them
+type WebhookRepo interface {
+	Create(url, description string, events []string, actor Actor) (*WebhookEndpoint, error)
+	Get(id uint) (*WebhookEndpoint, error)
+	List() ([]WebhookEndpoint, error)
+	Update(id uint, url, description string, events []string, active bool, actor Actor) (*WebhookEndpoint, error)
+	Delete(id uint, actor Actor) error
+	Deliveries(endpointID uint, status string, limit int) ([]WebhookDelivery, error)
+	Redeliver(deliveryID uint, actor Actor) (*WebhookDelivery, error)
+}
+
+// NotificationRepo stores notification templates, users' channel
+// preferences and devices, and the history of notifications sent to them
+type NotificationRepo interface {
+	Templates() ([]NotificationTemplate, error)
+	UpdateTemplate(event, channel, subject, body string, actor Actor) (*NotificationTemplate, error)
+	ResetTemplate(event, channel string, actor Actor) (*NotificationTemplate, error)
+	Preferences(userID uint) (map[string][]string, error)
+	UpdatePreferences(userID uint, channels map[string][]string) (map[string][]string, error)
+	RegisterDevice(userID uint, token, platform string) (*UserDevice, error)
+	Devices(userID uint) ([]UserDevice, error)
+	RemoveDevice(userID, id uint) error
+	ForgetDevice(token string) error
+	History(userID uint, status string, limit int) ([]Notification, error)
+}
+
+// CampaignRepo stores offer campaigns, sends them to their audience and
+// reports on their delivery and the orders that followed
+type CampaignRepo interface {
+	Create(campaign Campaign, actor Actor) (*Campaign, error)
+	Get(id uint) (*Campaign, error)
+	List(status string) ([]Campaign, error)
+	Update(id uint, changes Campaign, actor Actor) (*Campaign, error)
+	Delete(id uint, actor Actor) error
+	Preview(id uint) (*CampaignPreview, error)
+	Send(id uint, actor Actor) (*Campaign, error)
+	Report(id uint) (*CampaignReport, error)
+}
+
+// Repositories bundles the repositories handed to the HTTP handlers
+type Repositories struct {
+	Users     UserRepo
+	Companies CompanyRepo
+	Medicines MedicineRepo
+	Orders    OrderRepo
+	Carts     CartRepo
+	Audit     AuditRepo
+	Sales     SalesRepo
+	Webhooks  WebhookRepo
+	Notify    NotificationRepo
+	Campaigns CampaignRepo
+
+	// OrderUpdates carries new orders and status changes to streaming clients
+	OrderUpdates OrderBroker
+}
+
+// NewRepositories creates GORM-backed repositories on the given connection.
+// The connection can be Postgres in production or SQLite for local runs, and
+// an OpenInMemory database for tests.
+func NewRepositories(db *gorm.DB) *Repositories {
+	broker := NewInProcessBroker()
+	return &Repositories{
+		Users:     NewUserRepo(db),
+		Companies: NewCompanyRepo(db),
+		Medicines: NewMedicineRepo(db),
+		Orders:    NewOrderRepo(db, broker),
+		Carts:     NewCartRepo(db, broker),
+		Audit:     NewAuditRepo(db),
+		Sales:     NewSalesRepo(db),
+		Webhooks:  NewWebhookRepo(db),
+		Notify:    NewNotificationRepo(db),
+		Campaigns: NewCampaignRepo(db),
+
+		OrderUpdates: broker,
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// testActor makes the changes in model tests
+var testActor = SystemActor("test")
+
+// newTestRepos returns repositories on a private in-memory database
+func newTestRepos(t *testing.T) *Repositories {
+	t.Helper()
+
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewRepositories(db)
+}
+
+func TestUserRepo(t *testing.T) {
+	repos := newTestRepos(t)
+
+	user, err := repos.Users.Create("Retailer", "", "9000000001", "secret123", "Firm", "Pune", testActor)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.Status != UserStatusPendingApproval || user.IsAdmin {
+		t.Fatalf("new user = %+v, want a customer pending approval", user)
+	}
+	if _, err := repos.Users.Create("Other", "", "9000000001", "secret123", "", "", testActor); !errors.As(err, new(*ConflictError)) {
+		t.Fatalf("Create with a taken phone: %v, want a ConflictError", err)
+	}
+
+	pending, err := repos.Users.ListByStatus(UserStatusPendingApproval)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending users = %+v, %v", pending, err)
+	}
+	if _, err := repos.Users.Approve(user.ID, testActor); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+
+	found, err := repos.Users.GetByPhone("9000000001")
+	if err != nil || found.ID != user.ID || found.Status != UserStatusApproved {
+		t.Fatalf("GetByPhone = %+v, %v", found, err)
+	}
+	if _, err := repos.Users.GetByID(999); !errors.As(err, new(*NotFoundError)) {
+		t.Fatalf("GetByID of a missing user: %v, want a NotFoundError", err)
+	}
+}
+
+func TestCompanyRepoSoftDelete(t *testing.T) {
+	repos := newTestRepos(t)
+
+	company, err := repos.Companies.Create("Cipla", "", "", testActor)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repos.Companies.Delete(company.ID, testActor); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repos.Companies.Get(company.ID); !errors.As(err, new(*NotFoundError)) {
+		t.Fatalf("Get of a deleted company: %v, want a NotFoundError", err)
+	}
+	if companies, _ := repos.Companies.List(false); len(companies) != 0 {
+		t.Fatalf("companies = %+v, want the deleted one hidden", companies)
+	}
+	if companies, _ := repos.Companies.List(true); len(companies) != 1 {
+		t.Fatalf("companies with deleted = %+v, want one", companies)
+	}
+
+	if _, err := repos.Companies.Restore(company.ID, testActor); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := repos.Companies.Get(company.ID); err != nil {
+		t.Fatalf("Get after restoring: %v", err)
+	}
+
+	if _, err := repos.Medicines.Create("Paracetamol", "", 999, 10, "", testActor); !errors.As(err, new(*ValidationError)) {
+		t.Fatalf("medicine of a missing company: %v, want a ValidationError", err)
+	}
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Errors returned by the session functions
+var (
+	ErrInvalidAccessToken  = errors.New("invalid or expired token")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+)
+
+// Session is a server-side login session. The refresh token is rotated on
+// every use; only hashes of the current and previous token are stored.
+type Session struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"user_id" gorm:"index"`
+	RefreshTokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	PreviousTokenHash string     `json:"-" gorm:"index"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM to use
+func (Session) TableName() string {
+	return "session"
+}
+
+// TokenPair is returned on login and refresh
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // Access token lifetime in seconds
+}
+
+// CreateSession starts a new session for the user and issues its tokens
+func (a *AuthService) CreateSession(user *User) (*TokenPair, error) {
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        now.Add(a.jwt.RefreshTokenTTL),
+		LastUsedAt:       now,
+	}
+	if err := a.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+
+	return a.issueTokenPair(user, session.ID, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new token pair, rotating the
+// refresh token. Presenting an already-rotated token revokes the session,
+// since it means the token was copied.
+func (a *AuthService) RefreshSession(refreshToken string) (*TokenPair, *User, error) {
+	hash := hashToken(refreshToken)
+	now := time.Now()
+
+	var session Session
+	if err := a.db.Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		var reused Session
+		if a.db.Where("previous_token_hash = ? AND revoked_at IS NULL", hash).First(&reused).Error == nil {
+			a.db.Model(&reused).Update("revoked_at", now)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := a.users.GetByID(session.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err := checkCanLogin(user); err != nil {
+		return nil, user, err
+	}
+
+	newToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rotate only if nobody else rotated this token in the meantime
+	result := a.db.Model(&Session{}).Where("id = ? AND refresh_token_hash = ?", session.ID, hash).Updates(map[string]interface{}{
+		"refresh_token_hash":  hashToken(newToken),
+		"previous_token_hash": hash,
+		"last_used_at":        now,
+	})
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := a.issueTokenPair(user, session.ID, newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// RevokeSession ends a single session
+func (a *AuthService) RevokeSession(id uint) error {
+	return a.db.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions ends every active session of a user and returns how many were revoked
+func (a *AuthService) RevokeUserSessions(userID uint) (int64, error) {
+	result := a.db.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// CheckSessionClaims verifies that the session referenced by an access
+// token's claims is still active
+func (a *AuthService) CheckSessionClaims(claims jwt.MapClaims) error {
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return ErrSessionRevoked
+	}
+
+	var session Session
+	if err := a.db.Select("id", "revoked_at", "expires_at").First(&session, uint(sid)).Error; err != nil {
+		return ErrSessionRevoked
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func (a *AuthService) issueTokenPair(user *User, sessionID uint, refreshToken string) (*TokenPair, error) {
+	accessToken, err := a.GenerateJWT(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(a.jwt.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
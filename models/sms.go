@@ -0,0 +1,20 @@
+package models
+
+import (
+	"log"
+)
+
+// SMSSender delivers text messages to a phone number. Implementations wrap an
+// SMS gateway; LogSMSSender is used when no gateway is configured.
+type SMSSender interface {
+	SendSMS(phone, message string) error
+}
+
+// LogSMSSender writes messages to the application log instead of sending them
+type LogSMSSender struct{}
+
+// SendSMS logs the message that would have been sent
+func (LogSMSSender) SendSMS(phone, message string) error {
+	log.Printf("SMS to %s: %s", phone, message)
+	return nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Split moves the items of an order into one child order per company, so
+// that each company's part is fulfilled and invoiced on its own. The order
+// keeps no items of its own and shows the aggregated status of its children.
+func (r *orderRepo) Split(id uint, actor Actor) (*OrderRequest, error) {
+	err := r.transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Preload("Items").Preload("Children").First(&order, id).Error; err != nil {
+			return dbError(err, "Order")
+		}
+		if order.ParentID != nil {
+			return NewConflictError("Order is already part of a split order")
+		}
+		if len(order.Children) > 0 {
+			return NewConflictError("Order is already split")
+		}
+		if order.Status != OrderStatusPending && order.Status != OrderStatusProcessing {
+			return NewConflictError("Only pending or processing orders can be split")
+		}
+
+		split, err := splitOrder(tx, &order, actor)
+		if err != nil {
+			return err
+		}
+		if !split {
+			return NewConflictError("Order only has items from one company")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(id, false)
+}
+
+// splitOrder moves the items of an order into one child order per company,
+// in the order the companies first appear. Orders with items from a single
+// company are left alone and false is returned.
+func splitOrder(tx *gorm.DB, order *Order, actor Actor) (bool, error) {
+	var companyIDs []uint
+	byCompany := map[uint][]OrderItem{}
+	for _, item := range order.Items {
+		if _, seen := byCompany[item.CompanyID]; !seen {
+			companyIDs = append(companyIDs, item.CompanyID)
+		}
+		byCompany[item.CompanyID] = append(byCompany[item.CompanyID], item)
+	}
+	if len(companyIDs) < 2 {
+		return false, nil
+	}
+
+	before := orderAuditState(order)
+	var childIDs []uint
+	for _, companyID := range companyIDs {
+		child := &Order{
+			UserID:    order.UserID,
+			ParentID:  &order.ID,
+			Status:    order.Status,
+			UpdatedBy: actor.String(),
+			CreatedAt: order.CreatedAt,
+			UpdatedAt: time.Now(),
+		}
+		if err := tx.Create(child).Error; err != nil {
+			return false, err
+		}
+
+		var itemIDs []uint
+		for _, item := range byCompany[companyID] {
+			itemIDs = append(itemIDs, item.ID)
+		}
+		if err := tx.Model(&OrderItem{}).Where("id IN ?", itemIDs).Update("order_id", child.ID).Error; err != nil {
+			return false, err
+		}
+
+		child.Items = byCompany[companyID]
+		if err := recordAudit(tx, actor, AuditEntityOrder, child.ID, AuditActionCreate, nil, orderAuditState(child)); err != nil {
+			return false, err
+		}
+		childIDs = append(childIDs, child.ID)
+	}
+
+	err := tx.Model(&Order{}).Where("id = ?", order.ID).
+		Updates(map[string]interface{}{"updated_by": actor.String(), "updated_at": time.Now()}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, recordAudit(tx, actor, AuditEntityOrder, order.ID, AuditActionSplit, before,
+		map[string]interface{}{"child_orders": childIDs})
+}
+
+// syncSplitStatus sets the status of a split order to the aggregated status
+// of its children
+func syncSplitStatus(tx *gorm.DB, parentID uint, actor Actor) error {
+	var parent Order
+	if err := tx.Preload("Children").First(&parent, parentID).Error; err != nil {
+		return dbError(err, "Order")
+	}
+
+	status := splitOrderStatus(parent.Children)
+	if status == parent.Status {
+		return nil
+	}
+
+	before := parent.Status
+	err := tx.Model(&Order{}).Where("id = ?", parent.ID).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_by": actor.String(),
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	err = recordAudit(tx, actor, AuditEntityOrder, parent.ID, AuditActionStatusChange,
+		map[string]string{"status": before}, map[string]string{"status": status})
+	if err != nil {
+		return err
+	}
+	return recordOrderStatusChanged(tx, &parent, before, status)
+}
+
+// splitOrderStatus is the least advanced status of the child orders that
+// were not cancelled, or cancelled when all of them were
+func splitOrderStatus(children []Order) string {
+	status := OrderStatusCancelled
+	for _, child := range children {
+		if child.Status == OrderStatusCancelled {
+			continue
+		}
+		if status == OrderStatusCancelled || statusRank(child.Status) < statusRank(status) {
+			status = child.Status
+		}
+	}
+	return status
+}
+
+// statusRank is the position of a status in the order workflow
+func statusRank(status string) int {
+	for i, known := range OrderStatuses {
+		if known == status {
+			return i
+		}
+	}
+	return len(OrderStatuses)
+}
@@ -0,0 +1,80 @@
+package models
+
+import "testing"
+
+func TestSplitOrderStatus(t *testing.T) {
+	for _, tc := range []struct {
+		children []string
+		want     string
+	}{
+		{[]string{OrderStatusShipped, OrderStatusPending, OrderStatusDelivered}, OrderStatusPending},
+		{[]string{OrderStatusDelivered, OrderStatusShipped}, OrderStatusShipped},
+		{[]string{OrderStatusCancelled, OrderStatusProcessing}, OrderStatusProcessing},
+		{[]string{OrderStatusCancelled, OrderStatusDelivered}, OrderStatusDelivered},
+		{[]string{OrderStatusCancelled, OrderStatusCancelled}, OrderStatusCancelled},
+		{nil, OrderStatusCancelled},
+	} {
+		children := make([]Order, len(tc.children))
+		for i, status := range tc.children {
+			children[i].Status = status
+		}
+		if got := splitOrderStatus(children); got != tc.want {
+			t.Errorf("splitOrderStatus(%v) = %q, want %q", tc.children, got, tc.want)
+		}
+	}
+}
+
+func TestSyncSplitStatus(t *testing.T) {
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	user, err := NewRepositories(db).Users.Create("Retailer", "", "9000000001", "secret123", "Firm", "Pune", testActor)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	parent := Order{UserID: user.ID, Status: OrderStatusPending}
+	if err := db.Create(&parent).Error; err != nil {
+		t.Fatal(err)
+	}
+	children := []Order{
+		{UserID: user.ID, Status: OrderStatusShipped, ParentID: &parent.ID},
+		{UserID: user.ID, Status: OrderStatusCancelled, ParentID: &parent.ID},
+	}
+	if err := db.Create(&children).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	sync := func() string {
+		t.Helper()
+		if err := syncSplitStatus(db, parent.ID, testActor); err != nil {
+			t.Fatalf("syncSplitStatus: %v", err)
+		}
+		var synced Order
+		db.First(&synced, parent.ID)
+		return synced.Status
+	}
+	audits := func() int64 {
+		var count int64
+		db.Model(&AuditLog{}).Where("entity_type = ? AND entity_id = ?", AuditEntityOrder, parent.ID).Count(&count)
+		return count
+	}
+
+	if status := sync(); status != OrderStatusShipped || audits() != 1 {
+		t.Fatalf("parent status = %q with %d audit records, want shipped with one", status, audits())
+	}
+	if status := sync(); status != OrderStatusShipped || audits() != 1 {
+		t.Fatalf("parent status = %q with %d audit records, want no change recorded", status, audits())
+	}
+
+	db.Model(&children[0]).Update("status", OrderStatusDelivered)
+	if status := sync(); status != OrderStatusDelivered || audits() != 2 {
+		t.Fatalf("parent status = %q with %d audit records, want delivered with two", status, audits())
+	}
+}
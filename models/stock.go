@@ -0,0 +1,69 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reserveStock takes the ordered units of medicines whose stock is tracked
+// out of stock, as far as there is stock left, and records them on the items
+// as reserved. Orders are accepted beyond the stock; carts warn about it.
+// The medicine rows are locked until the transaction ends so that concurrent
+// orders cannot reserve the same units.
+func reserveStock(tx *gorm.DB, items []OrderItem) error {
+	for i := range items {
+		item := &items[i]
+
+		var medicine Medicine
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "stock").First(&medicine, item.MedicineID).Error
+		if err != nil {
+			return err
+		}
+		if medicine.Stock == nil {
+			continue
+		}
+		reserved := min(*medicine.Stock, item.Quantity-item.ReservedQuantity)
+		if reserved <= 0 {
+			continue
+		}
+
+		err = tx.Unscoped().Model(&Medicine{}).Where("id = ?", item.MedicineID).
+			UpdateColumn("stock", gorm.Expr("stock - ?", reserved)).Error
+		if err != nil {
+			return err
+		}
+		item.ReservedQuantity += reserved
+		if err := tx.Model(&OrderItem{}).Where("id = ?", item.ID).UpdateColumn("reserved_quantity", item.ReservedQuantity).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseStock returns the units reserved for an item beyond keep to stock.
+// Units of medicines whose stock is no longer tracked are dropped.
+func releaseStock(tx *gorm.DB, item *OrderItem, keep int) error {
+	released := item.ReservedQuantity - min(keep, item.ReservedQuantity)
+	if released <= 0 {
+		return nil
+	}
+
+	err := tx.Unscoped().Model(&Medicine{}).Where("id = ? AND stock IS NOT NULL", item.MedicineID).
+		UpdateColumn("stock", gorm.Expr("stock + ?", released)).Error
+	if err != nil {
+		return err
+	}
+	item.ReservedQuantity -= released
+	return tx.Model(&OrderItem{}).Where("id = ?", item.ID).UpdateColumn("reserved_quantity", item.ReservedQuantity).Error
+}
+
+// releaseOrderStock returns all units reserved for the items to stock
+func releaseOrderStock(tx *gorm.DB, items []OrderItem) error {
+	for i := range items {
+		if err := releaseStock(tx, &items[i], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
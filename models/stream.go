@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// orderSubscriberBuffer is the number of updates a subscriber can fall behind
+// before it is dropped
+const orderSubscriberBuffer = 64
+
+// OrderUpdate is a new order or an order status change, pushed to the clients
+// streaming orders
+type OrderUpdate struct {
+	Type           string    `json:"type"` // EventOrderCreated or EventOrderStatusChanged
+	OrderID        uint      `json:"orderId"`
+	UserID         uint      `json:"userId"`
+	ParentOrderID  *uint     `json:"parentOrderId,omitempty"`
+	BackorderOf    *uint     `json:"backorderOf,omitempty"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previousStatus,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+// OrderBroker fans order updates out to the subscribed clients. The
+// in-process broker only reaches clients connected to the same server; a
+// broker backed by Postgres LISTEN/NOTIFY can replace it once the server runs
+// on several instances.
+type OrderBroker interface {
+	// Publish hands an update to every subscriber without blocking
+	Publish(update OrderUpdate)
+	// Subscribe returns a channel of updates, closed when cancel is called or
+	// when the subscriber falls too far behind
+	Subscribe() (updates <-chan OrderUpdate, cancel func())
+}
+
+type inProcessBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan OrderUpdate]struct{}
+}
+
+// NewInProcessBroker creates an OrderBroker for a single server instance
+func NewInProcessBroker() OrderBroker {
+	return &inProcessBroker{subscribers: map[chan OrderUpdate]struct{}{}}
+}
+
+// Publish hands the update to every subscriber. Subscribers whose buffer is
+// full are dropped rather than slowing down the request that made the change;
+// they reconnect and reload the orders they missed.
+func (b *inProcessBroker) Publish(update OrderUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- update:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber
+func (b *inProcessBroker) Subscribe() (<-chan OrderUpdate, func()) {
+	ch := make(chan OrderUpdate, orderSubscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// stagedUpdatesKey is the context key of the updates staged by a transaction
+type stagedUpdatesKey struct{}
+
+// stagedUpdates are the order updates of a transaction, published once it
+// committed so that clients never see a change that was rolled back
+type stagedUpdates struct {
+	updates []OrderUpdate
+}
+
+// stageOrderUpdate adds an update to the transaction's staged updates. It is
+// a no-op for transactions that don't publish.
+func stageOrderUpdate(tx *gorm.DB, update OrderUpdate) {
+	if staged, ok := tx.Statement.Context.Value(stagedUpdatesKey{}).(*stagedUpdates); ok {
+		staged.updates = append(staged.updates, update)
+	}
+}
+
+// publishingTransaction runs fn in a transaction and publishes the order
+// updates it staged after the commit
+func publishingTransaction(db *gorm.DB, broker OrderBroker, fn func(tx *gorm.DB) error) error {
+	staged := &stagedUpdates{}
+	ctx := context.WithValue(db.Statement.Context, stagedUpdatesKey{}, staged)
+
+	if err := db.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	for _, update := range staged.updates {
+		broker.Publish(update)
+	}
+	return nil
+}
@@ -1,158 +1,283 @@
 package models
 
 import (
+	"errors"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // User struct represents the user model in the database
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Phone     string    `json:"phone" gorm:"unique"`
-	Password  string    `json:"password"`
-	FirmName  string    `json:"firm_name"`
-	IsAdmin   bool      `json:"is_admin"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	UpdatedBy string    `json:"updated_by"`
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name"`
+	Email        string     `json:"email"`
+	Phone        string     `json:"phone" gorm:"unique"`
+	Password     string     `json:"password"`
+	FirmName     string     `json:"firm_name"`
+	City         string     `json:"city"`
+	Tier         string     `json:"tier"` // Customer tier assigned by admins, used to target campaigns
+	IsAdmin      bool       `json:"is_admin"`
+	Status       string     `json:"status" gorm:"default:'approved'"` // Existing accounts stay approved; Create sets pending_approval
+	StatusReason string     `json:"status_reason"`                    // Reason given by the admin on rejection
+	ReviewedBy   string     `json:"reviewed_by"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UpdatedBy    string     `json:"updated_by"`
 }
 
+// Account states for the signup approval workflow
+const (
+	UserStatusPendingApproval = "pending_approval"
+	UserStatusApproved        = "approved"
+	UserStatusRejected        = "rejected"
+)
+
 type UserResponse struct {
 	ID          uint   `json:"id"`
 	PhoneNumber string `json:"phoneNumber"`
 	Name        string `json:"name"`
 	Email       string `json:"email"`
 	FirmName    string `json:"firmName"`
+	City        string `json:"city"`
+	Tier        string `json:"tier"`
 	IsAdmin     bool   `json:"isAdmin"`
+	Status      string `json:"status"`
 }
 
-var db *gorm.DB
-var jwtSecret = []byte("RaghavSureka")
-
-// SetDB initializes the database connection for GORM
-func SetDB(d *gorm.DB) {
-	db = d
+// ToResponse converts a user into the public response shape
+func (u *User) ToResponse() UserResponse {
+	return UserResponse{
+		ID:          u.ID,
+		PhoneNumber: u.Phone,
+		Name:        u.Name,
+		Email:       u.Email,
+		FirmName:    u.FirmName,
+		City:        u.City,
+		Tier:        u.Tier,
+		IsAdmin:     u.IsAdmin,
+		Status:      u.Status,
+	}
 }
 
-// GenerateJWT creates a JWT token for the given user
-func GenerateJWT(user *User) (string, error) {
-	claims := jwt.MapClaims{
-		"userId":   user.ID,
-		"name":     user.Name,
-		"email":    user.Email,
-		"phone":    user.Phone,
-		"firmName": user.FirmName,
-		"isAdmin":  user.IsAdmin,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
-	}
+// userRepo is the GORM implementation of UserRepo
+type userRepo struct {
+	db *gorm.DB
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+// NewUserRepo creates a UserRepo backed by the given connection
+func NewUserRepo(db *gorm.DB) UserRepo {
+	return &userRepo{db: db}
 }
 
-// CreateUser creates a new user in the database
-func CreateUser(name, email, phone, password, firmName string, isAdmin bool) (string, *User, error) {
+// Create creates a new user in the database. New accounts are never
+// admins and start in the pending_approval state until an admin reviews them.
+func (r *userRepo) Create(name, email, phone, password, firmName, city string, actor Actor) (*User, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	user := &User{
-		Name:     name,
-		Email:    email,
-		Phone:    phone,
-		Password: string(hashedPassword),
-		FirmName: firmName,
-		IsAdmin:  isAdmin,
+		Name:      name,
+		Email:     email,
+		Phone:     phone,
+		Password:  string(hashedPassword),
+		FirmName:  firmName,
+		City:      city,
+		IsAdmin:   false,
+		Status:    UserStatusPendingApproval,
+		UpdatedBy: actor.String(),
 	}
 
-	if err := db.Create(user).Error; err != nil {
-		return "", nil, err
+	if err := r.create(user, actor); err != nil {
+		return nil, err
 	}
 
-	token, err := GenerateJWT(user)
+	return user, nil
+}
+
+// CreateAdmin creates an approved admin account, used to bootstrap a new
+// installation where no admin exists yet to approve signups
+func (r *userRepo) CreateAdmin(name, email, phone, password, firmName string, actor Actor) (*User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
-	return token, user, nil
+	now := time.Now()
+	user := &User{
+		Name:       name,
+		Email:      email,
+		Phone:      phone,
+		Password:   string(hashedPassword),
+		FirmName:   firmName,
+		IsAdmin:    true,
+		Status:     UserStatusApproved,
+		ReviewedBy: actor.String(),
+		ReviewedAt: &now,
+		UpdatedBy:  actor.String(),
+	}
+
+	if err := r.create(user, actor); err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
-// AuthenticateUser authenticates a user by phone and password
-func AuthenticateUser(identifier, password string) (string, *User, error) {
-	var user User
+func (r *userRepo) create(user *User, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return phoneConflict(err)
+		}
+		return recordAudit(tx, actor, AuditEntityUser, user.ID, AuditActionCreate, nil, user)
+	})
+}
 
-	if err := db.Where("phone = ?", identifier).First(&user).Error; err != nil {
-		return "", nil, err
+// GetByID retrieves a user by ID
+func (r *userRepo) GetByID(id uint) (*User, error) {
+	var user User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, dbError(err, "User")
 	}
+	return &user, nil
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", nil, err // Invalid password
+// GetByPhone retrieves a user by phone number
+func (r *userRepo) GetByPhone(phone string) (*User, error) {
+	var user User
+	if err := r.db.Where("phone = ?", phone).First(&user).Error; err != nil {
+		return nil, dbError(err, "User")
 	}
+	return &user, nil
+}
 
-	token, err := GenerateJWT(&user)
-	if err != nil {
-		return "", nil, err
-	}
+// Update updates a user's data (name, phone, firm_name, city, tier, is_admin,
+// updated_at). A nil tier or isAdmin keeps the current value.
+func (r *userRepo) Update(id uint, name, phone, firmName, city string, tier *string, isAdmin *bool, actor Actor) (*User, error) {
+	return r.change(id, AuditActionUpdate, actor, func(tx *gorm.DB, user *User) error {
+		if phone != user.Phone {
+			var count int64
+			if err := tx.Model(&User{}).Where("phone = ? AND id <> ?", phone, id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errPhoneInUse
+			}
+		}
 
-	return token, &user, nil
+		user.Name = name
+		user.Phone = phone
+		user.FirmName = firmName
+		user.City = city
+		if tier != nil {
+			user.Tier = *tier
+		}
+		if isAdmin != nil {
+			user.IsAdmin = *isAdmin
+		}
+		return nil
+	})
 }
 
-// UpdateUser updates a user's data (name, phone, firm_name, is_admin, updated_at)
-func UpdateUser(id int, name, phone, firmName string, isAdmin bool, updatedBy string) (*User, error) {
-	var user User
-
-	if err := db.First(&user, id).Error; err != nil {
-		return nil, err
+// UpdatePassword hashes and stores a new password for the user
+func (r *userRepo) UpdatePassword(id uint, password string, actor Actor) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
 	}
 
-	user.Name = name
-	user.Phone = phone
-	user.FirmName = firmName
-	user.IsAdmin = isAdmin
-	user.UpdatedAt = time.Now()
-	user.UpdatedBy = updatedBy
+	_, err = r.change(id, AuditActionPasswordChange, actor, func(tx *gorm.DB, user *User) error {
+		user.Password = string(hashedPassword)
+		return nil
+	})
+	return err
+}
 
-	if err := db.Save(&user).Error; err != nil {
+// ListByStatus retrieves all users in the given approval state, oldest first
+func (r *userRepo) ListByStatus(status string) ([]User, error) {
+	var users []User
+	if err := r.db.Where("status = ?", status).Order("created_at asc").Find(&users).Error; err != nil {
 		return nil, err
 	}
+	return users, nil
+}
 
-	return &user, nil
+// Approve marks a pending or rejected account as approved
+func (r *userRepo) Approve(id uint, actor Actor) (*User, error) {
+	return r.review(id, UserStatusApproved, "", AuditActionApprove, actor)
 }
 
-// Helper function to check if a string is an email
-func isEmail(str string) bool {
-	return strings.Contains(str, "@") && strings.Contains(str, ".")
+// Reject marks an account as rejected with the given reason
+func (r *userRepo) Reject(id uint, reason string, actor Actor) (*User, error) {
+	return r.review(id, UserStatusRejected, reason, AuditActionReject, actor)
 }
 
-// AuthMiddleware decodes JWT token and sets user context
-func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return echo.ErrUnauthorized
+func (r *userRepo) review(id uint, status, reason, action string, actor Actor) (*User, error) {
+	return r.change(id, action, actor, func(tx *gorm.DB, user *User) error {
+		now := time.Now()
+		user.Status = status
+		user.StatusReason = reason
+		user.ReviewedBy = actor.String()
+		user.ReviewedAt = &now
+		return nil
+	})
+}
+
+// change loads a user, applies apply to it and saves it together with an
+// audit record of the difference
+func (r *userRepo) change(id uint, action string, actor Actor, apply func(tx *gorm.DB, user *User) error) (*User, error) {
+	var user User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return dbError(err, "User")
+		}
+		before := user
+
+		if err := apply(tx, &user); err != nil {
+			return err
 		}
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+		user.UpdatedAt = time.Now()
+		user.UpdatedBy = actor.String()
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			return echo.ErrUnauthorized
+		if err := tx.Save(&user).Error; err != nil {
+			return phoneConflict(err)
 		}
+		return recordAudit(tx, actor, AuditEntityUser, user.ID, action, &before, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
 
-		claims := token.Claims.(jwt.MapClaims)
-		c.Set("user_name", claims["name"])
-		c.Set("user_phoneNumber", claims["phone"])
-		c.Set("user_isAdmin", claims["is_admin"])
+// errPhoneInUse is returned when another account already has the phone number
+var errPhoneInUse = NewConflictError("Phone number already in use")
 
-		return next(c)
+// phoneConflict reports a unique violation on users.phone as errPhoneInUse
+func phoneConflict(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errPhoneInUse
 	}
+	return err
+}
+
+// checkCanLogin reports whether the account's approval state allows logging in
+func checkCanLogin(user *User) error {
+	switch user.Status {
+	case UserStatusPendingApproval:
+		return ErrAccountPendingApproval
+	case UserStatusRejected:
+		return ErrAccountRejected
+	}
+	return nil
+}
+
+// Helper function to check if a string is an email
+func isEmail(str string) bool {
+	return strings.Contains(str, "@") && strings.Contains(str, ".")
 }
@@ -0,0 +1,420 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook event types
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventMedicineUpdated    = "medicine.updated"
+	EventOfferChanged       = "offer.changed"
+)
+
+// WebhookEventTypes lists every event type endpoints can subscribe to
+var WebhookEventTypes = []string{EventOrderCreated, EventOrderStatusChanged, EventMedicineUpdated, EventOfferChanged}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Gave up after the last retry
+)
+
+// WebhookEndpoint is a URL that receives the events it subscribes to.
+// Deliveries are signed with Secret, which is only returned when the endpoint
+// is created.
+type WebhookEndpoint struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	URL         string         `json:"url"`
+	Description string         `json:"description"`
+	Events      StringList     `json:"events"`
+	Secret      string         `json:"secret,omitempty"`
+	Active      bool           `json:"active"` // Inactive endpoints get no new events; queued deliveries wait
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	UpdatedBy   string         `json:"updated_by"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+// TableName specifies the table name for GORM to use
+func (WebhookEndpoint) TableName() string {
+	return "webhook_endpoint"
+}
+
+// StringList is a list of strings without commas, such as event types,
+// stored as comma-separated text
+type StringList []string
+
+// GormDataType stores the list in a text column
+func (StringList) GormDataType() string {
+	return "text"
+}
+
+// Value joins the strings with commas
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan splits the stored text into strings
+func (l *StringList) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+
+	*l = nil
+	for _, item := range strings.Split(text, ",") {
+		if item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// WebhookEvent is an entry of the outbox. Events are written in the same
+// transaction as the change they describe and handed to the subscribed
+// endpoints by the WebhookDispatcher.
+type WebhookEvent struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Type         string     `json:"type"`
+	Payload      AuditJSON  `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"dispatched_at" gorm:"index"` // When deliveries were created for it
+}
+
+// TableName specifies the table name for GORM to use
+func (WebhookEvent) TableName() string {
+	return "webhook_event"
+}
+
+// WebhookDelivery is the delivery of an event to an endpoint and the
+// outcome of its latest attempt
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	EventID        uint       `json:"event_id" gorm:"index"`
+	EndpointID     uint       `json:"endpoint_id" gorm:"index"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"` // nil once delivered or given up
+	ResponseStatus int        `json:"response_status"`              // HTTP status of the latest attempt, 0 if there was no response
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM to use
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// recordEvent writes an event to the outbox using tx, so that it is
+// committed or rolled back together with the change. Nothing is written
+// while no active endpoint subscribes to the event type.
+func recordEvent(tx *gorm.DB, eventType string, payload interface{}) error {
+	var subscribers int64
+	err := tx.Model(&WebhookEndpoint{}).
+		Where("active = ? AND ',' || events || ',' LIKE ?", true, "%,"+eventType+",%").
+		Count(&subscribers).Error
+	if err != nil || subscribers == 0 {
+		return err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&WebhookEvent{Type: eventType, Payload: AuditJSON(data), CreatedAt: time.Now()}).Error
+}
+
+// recordOrderCreated writes an order.created event, stages the update for the
+// clients streaming orders and notifies the customer unless the order is a
+// draft
+func recordOrderCreated(tx *gorm.DB, order *Order) error {
+	stageOrderUpdate(tx, OrderUpdate{
+		Type:        EventOrderCreated,
+		OrderID:     order.ID,
+		UserID:      order.UserID,
+		BackorderOf: order.BackorderOfID,
+		Status:      order.Status,
+		At:          order.CreatedAt,
+	})
+
+	items := []map[string]interface{}{}
+	for _, item := range order.Items {
+		items = append(items, map[string]interface{}{
+			"medicineId":   item.MedicineID,
+			"companyId":    item.CompanyID,
+			"quantity":     item.Quantity,
+			"unitPrice":    item.UnitPrice,
+			"offer":        item.Offer,
+			"freeQuantity": item.FreeQuantity,
+		})
+	}
+	if order.Status != OrderStatusDraft {
+		err := recordNotification(tx, EventOrderCreated, &order.UserID, map[string]interface{}{
+			"orderId":     order.ID,
+			"status":      order.Status,
+			"backorderOf": order.BackorderOfID,
+			"itemCount":   len(order.Items),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return recordEvent(tx, EventOrderCreated, map[string]interface{}{
+		"orderId":     order.ID,
+		"userId":      order.UserID,
+		"status":      order.Status,
+		"backorderOf": order.BackorderOfID,
+		"items":       items,
+		"createdAt":   order.CreatedAt,
+	})
+}
+
+// recordOrderStatusChanged writes an order.status_changed event, stages the
+// update for the clients streaming orders and notifies the customer, if the
+// status changed. Customers follow split orders through their parent.
+func recordOrderStatusChanged(tx *gorm.DB, order *Order, previous, status string) error {
+	if previous == status {
+		return nil
+	}
+	stageOrderUpdate(tx, OrderUpdate{
+		Type:           EventOrderStatusChanged,
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		ParentOrderID:  order.ParentID,
+		Status:         status,
+		PreviousStatus: previous,
+		At:             time.Now(),
+	})
+	if order.ParentID == nil {
+		err := recordNotification(tx, EventOrderStatusChanged, &order.UserID, map[string]interface{}{
+			"orderId":        order.ID,
+			"status":         status,
+			"previousStatus": previous,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return recordEvent(tx, EventOrderStatusChanged, map[string]interface{}{
+		"orderId":        order.ID,
+		"userId":         order.UserID,
+		"parentOrderId":  order.ParentID,
+		"previousStatus": previous,
+		"status":         status,
+	})
+}
+
+// recordMedicineUpdated writes a medicine.updated event
+func recordMedicineUpdated(tx *gorm.DB, medicine *Medicine) error {
+	return recordEvent(tx, EventMedicineUpdated, map[string]interface{}{
+		"medicineId":  medicine.ID,
+		"name":        medicine.Name,
+		"description": medicine.Description,
+		"companyId":   medicine.CompanyID,
+		"price":       medicine.Price,
+		"offer":       medicine.Offer,
+		"stock":       medicine.Stock,
+		"deleted":     medicine.DeletedAt.Valid,
+	})
+}
+
+// webhookRepo is the GORM implementation of WebhookRepo
+type webhookRepo struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepo creates a WebhookRepo backed by the given connection
+func NewWebhookRepo(db *gorm.DB) WebhookRepo {
+	return &webhookRepo{db: db}
+}
+
+// Create registers an endpoint with a new signing secret, which is returned
+// in the result and never again
+func (r *webhookRepo) Create(url, description string, events []string, actor Actor) (*WebhookEndpoint, error) {
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &WebhookEndpoint{
+		URL:         url,
+		Description: description,
+		Events:      events,
+		Secret:      secret,
+		Active:      true,
+		UpdatedBy:   actor.String(),
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(endpoint).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityWebhook, endpoint.ID, AuditActionCreate, nil, endpoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// Get retrieves an endpoint without its secret
+func (r *webhookRepo) Get(id uint) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	if err := r.db.First(&endpoint, id).Error; err != nil {
+		return nil, dbError(err, "Webhook")
+	}
+	endpoint.Secret = ""
+	return &endpoint, nil
+}
+
+// List retrieves all endpoints without their secrets
+func (r *webhookRepo) List() ([]WebhookEndpoint, error) {
+	var endpoints []WebhookEndpoint
+	if err := r.db.Order("id").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	return endpoints, nil
+}
+
+// Update changes the URL, description, subscriptions and activation of an endpoint
+func (r *webhookRepo) Update(id uint, url, description string, events []string, active bool, actor Actor) (*WebhookEndpoint, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var endpoint WebhookEndpoint
+		if err := tx.First(&endpoint, id).Error; err != nil {
+			return dbError(err, "Webhook")
+		}
+		before := endpoint
+
+		endpoint.URL = url
+		endpoint.Description = description
+		endpoint.Events = events
+		endpoint.Active = active
+		endpoint.UpdatedBy = actor.String()
+		endpoint.UpdatedAt = time.Now()
+		if err := tx.Save(&endpoint).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityWebhook, endpoint.ID, AuditActionUpdate, &before, &endpoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(id)
+}
+
+// Delete removes an endpoint. Its pending deliveries are given up.
+func (r *webhookRepo) Delete(id uint, actor Actor) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var endpoint WebhookEndpoint
+		if err := tx.First(&endpoint, id).Error; err != nil {
+			return dbError(err, "Webhook")
+		}
+
+		err := tx.Model(&WebhookDelivery{}).Where("endpoint_id = ? AND status = ?", id, DeliveryPending).
+			Updates(map[string]interface{}{
+				"status":          DeliveryFailed,
+				"next_attempt_at": nil,
+				"last_error":      "endpoint was deleted",
+				"updated_at":      time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&WebhookEndpoint{}).Where("id = ?", id).Update("updated_by", actor.String()).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&WebhookEndpoint{}, id).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityWebhook, id, AuditActionDelete, &endpoint, nil)
+	})
+}
+
+// Deliveries returns the newest deliveries to an endpoint first, optionally
+// only those with the given status
+func (r *webhookRepo) Deliveries(endpointID uint, status string, limit int) ([]WebhookDelivery, error) {
+	if err := r.db.Unscoped().Select("id").First(&WebhookEndpoint{}, endpointID).Error; err != nil {
+		return nil, dbError(err, "Webhook")
+	}
+
+	query := r.db.Where("endpoint_id = ?", endpointID).Order("id desc").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Redeliver schedules a failed delivery to be attempted again right away,
+// with a fresh set of retries
+func (r *webhookRepo) Redeliver(deliveryID uint, actor Actor) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&delivery, deliveryID).Error; err != nil {
+			return dbError(err, "Delivery")
+		}
+		if delivery.Status != DeliveryFailed {
+			return NewConflictError("Only failed deliveries can be redelivered")
+		}
+		if err := tx.Select("id").First(&WebhookEndpoint{}, delivery.EndpointID).Error; err != nil {
+			return NewConflictError("The webhook of this delivery was deleted")
+		}
+
+		now := time.Now()
+		err := tx.Model(&WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"updated_at":      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEntityWebhook, delivery.EndpointID, AuditActionRedeliver, nil,
+			map[string]interface{}{"delivery_id": delivery.ID, "event_id": delivery.EventID})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.db.First(&delivery, deliveryID).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// generateWebhookSecret returns a random secret for signing deliveries
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"pharmacy/config"
+	"pharmacy/models"
+	"strconv"
+	"time"
+)
+
+// SMTPNotifier sends notifications as plain text email through an SMTP
+// server. The connection is upgraded with STARTTLS when the server offers it;
+// credentials are only sent over encrypted connections, or to localhost.
+type SMTPNotifier struct {
+	cfg  config.EmailConfig
+	from *mail.Address
+}
+
+// NewSMTPNotifier creates a notifier for the configured server
+func NewSMTPNotifier(cfg config.EmailConfig) (*SMTPNotifier, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email sender %q: %w", cfg.From, err)
+	}
+	return &SMTPNotifier{cfg: cfg, from: from}, nil
+}
+
+// Notify emails the message to the user
+func (n *SMTPNotifier) Notify(user *models.User, subject, message string) error {
+	if user.Email == "" {
+		return errors.New("user has no email address")
+	}
+	to := &mail.Address{Name: user.Name, Address: user.Email}
+	body, err := n.message(to, subject, message)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port)), requestTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(requestTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message formats the email with its headers and a quoted-printable body
+func (n *SMTPNotifier) message(to *mail.Address, subject, text string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(text)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
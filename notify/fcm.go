@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"pharmacy/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// fcmScope is the OAuth scope needed to send messages
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// fcmSendURL is the FCM HTTP v1 endpoint, formatted with the project ID
+const fcmSendURL = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+
+// errUnregistered is returned when FCM no longer knows a device token
+var errUnregistered = errors.New("device token is no longer registered")
+
+// FCMNotifier sends push notifications to every device a user registered,
+// through the Firebase Cloud Messaging HTTP v1 API. It signs in with a
+// service account key and forgets the tokens FCM reports as unregistered.
+type FCMNotifier struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         *rsa.PrivateKey
+	devices     DeviceStore
+	client      *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// serviceAccount is the part of a Google service account key file the
+// notifier uses
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	PrivateKey  string `json:"private_key"`
+	ClientEmail string `json:"client_email"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCMNotifier creates a notifier signing in with the service account key
+// in credentialsFile
+func NewFCMNotifier(credentialsFile string, devices DeviceStore) (*FCMNotifier, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read FCM credentials: %w", err)
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("could not parse FCM credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, errors.New("FCM credentials need project_id, client_email and token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM private key: %w", err)
+	}
+
+	return &FCMNotifier{
+		projectID:   account.ProjectID,
+		clientEmail: account.ClientEmail,
+		tokenURI:    account.TokenURI,
+		key:         key,
+		devices:     devices,
+		client:      &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// Notify pushes the message to the user's devices. It succeeds if at least
+// one device accepted it.
+func (n *FCMNotifier) Notify(user *models.User, subject, message string) error {
+	devices, err := n.devices.Devices(user.ID)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("user has no registered devices")
+	}
+
+	accessToken, err := n.token()
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	var lastErr error
+	for _, device := range devices {
+		err := n.send(accessToken, device.Token, subject, message)
+		switch {
+		case errors.Is(err, errUnregistered):
+			if forgetErr := n.devices.ForgetDevice(device.Token); forgetErr != nil {
+				return forgetErr
+			}
+			lastErr = err
+		case err != nil:
+			lastErr = err
+		default:
+			sent++
+		}
+	}
+	if sent == 0 {
+		return lastErr
+	}
+	return nil
+}
+
+// send pushes a message to one device
+func (n *FCMNotifier) send(accessToken, deviceToken, title, body string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        deviceToken,
+			"notification": map[string]string{"title": title, "body": body},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(fcmSendURL, n.projectID), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errUnregistered
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("FCM responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// token returns an OAuth access token, exchanging a signed assertion for a
+// new one shortly before the current one expires
+func (n *FCMNotifier) token() (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.accessToken != "" && time.Until(n.expiresAt) > time.Minute {
+		return n.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   n.clientEmail,
+		"scope": fcmScope,
+		"aud":   n.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(n.key)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := n.client.PostForm(n.tokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return "", fmt.Errorf("FCM sign-in failed with %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	n.accessToken = result.AccessToken
+	n.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return n.accessToken, nil
+}
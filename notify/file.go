@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"pharmacy/models"
+	"sync"
+	"time"
+)
+
+// fileMu serializes the writes of the file notifiers of all channels
+var fileMu sync.Mutex
+
+// FileNotifier writes notifications to a file, one JSON object per line, or
+// to the application log when Path is empty. It stands in for a real
+// channel during development.
+type FileNotifier struct {
+	Channel string
+	Path    string
+}
+
+// fileEntry is a line written by FileNotifier
+type fileEntry struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	UserID  uint      `json:"userId"`
+	Phone   string    `json:"phone,omitempty"`
+	Email   string    `json:"email,omitempty"`
+	Subject string    `json:"subject"`
+	Message string    `json:"message"`
+}
+
+// Notify records the notification that would have been sent
+func (n *FileNotifier) Notify(user *models.User, subject, message string) error {
+	if n.Path == "" {
+		log.Printf("Notification (%s) to user %d: %s - %s", n.Channel, user.ID, subject, message)
+		return nil
+	}
+
+	entry := fileEntry{Time: time.Now(), Channel: n.Channel, UserID: user.ID, Subject: subject, Message: message}
+	switch n.Channel {
+	case models.ChannelSMS:
+		entry.Phone = user.Phone
+	case models.ChannelEmail:
+		entry.Email = user.Email
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,74 @@
+// Package notify sends notifications through external services: an SMTP
+// server for email, an HTTP gateway for SMS and Firebase Cloud Messaging for
+// push. The log driver of each channel writes the messages to a file or the
+// application log instead, for development.
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"pharmacy/config"
+	"pharmacy/models"
+	"time"
+)
+
+// requestTimeout limits each request to a notification service
+const requestTimeout = 15 * time.Second
+
+// DeviceStore looks up the devices users registered for push notifications
+type DeviceStore interface {
+	Devices(userID uint) ([]models.UserDevice, error)
+	// ForgetDevice removes a token the push service no longer accepts
+	ForgetDevice(token string) error
+}
+
+// New creates the notifier of every channel selected by the configuration
+func New(cfg config.NotifyConfig, devices DeviceStore) (map[string]models.Notifier, error) {
+	notifiers := map[string]models.Notifier{}
+
+	switch cfg.SMS.Driver {
+	case config.NotifyLog:
+		notifiers[models.ChannelSMS] = &FileNotifier{Channel: models.ChannelSMS, Path: cfg.LogFile}
+	case config.SMSHTTP:
+		notifiers[models.ChannelSMS] = models.SMSNotifier{Sender: NewSMSSender(cfg.SMS)}
+	default:
+		return nil, fmt.Errorf("unknown SMS driver %q", cfg.SMS.Driver)
+	}
+
+	switch cfg.Email.Driver {
+	case config.NotifyLog:
+		notifiers[models.ChannelEmail] = &FileNotifier{Channel: models.ChannelEmail, Path: cfg.LogFile}
+	case config.EmailSMTP:
+		notifier, err := NewSMTPNotifier(cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[models.ChannelEmail] = notifier
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", cfg.Email.Driver)
+	}
+
+	switch cfg.Push.Driver {
+	case config.NotifyLog:
+		notifiers[models.ChannelPush] = &FileNotifier{Channel: models.ChannelPush, Path: cfg.LogFile}
+	case config.PushFCM:
+		notifier, err := NewFCMNotifier(cfg.Push.CredentialsFile, devices)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[models.ChannelPush] = notifier
+	default:
+		return nil, fmt.Errorf("unknown push driver %q", cfg.Push.Driver)
+	}
+
+	return notifiers, nil
+}
+
+// NewSMSSender creates the sender of the configured SMS gateway. Messages
+// are written to the application log when no gateway is configured.
+func NewSMSSender(cfg config.SMSConfig) models.SMSSender {
+	if cfg.Driver == config.SMSHTTP {
+		return &HTTPSMSSender{URL: cfg.URL, APIKey: cfg.APIKey, client: &http.Client{Timeout: requestTimeout}}
+	}
+	return models.LogSMSSender{}
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pharmacy/config"
+	"pharmacy/models"
+	"strings"
+	"testing"
+)
+
+func TestNewWithLogDrivers(t *testing.T) {
+	notifiers, err := New(config.Default().Notify, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, channel := range models.NotificationChannels {
+		if _, ok := notifiers[channel].(*FileNotifier); !ok {
+			t.Errorf("%s notifier = %T, want a FileNotifier", channel, notifiers[channel])
+		}
+	}
+
+	cfg := config.Default().Notify
+	cfg.Push.Driver = "pigeon"
+	if _, err := New(cfg, nil); err == nil {
+		t.Fatal("New accepted an unknown push driver")
+	}
+}
+
+func TestHTTPSMSSender(t *testing.T) {
+	var got map[string]string
+	var auth string
+	status := http.StatusAccepted
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+		w.Write([]byte("quota exceeded"))
+	}))
+	defer gateway.Close()
+
+	sender := NewSMSSender(config.SMSConfig{Driver: config.SMSHTTP, URL: gateway.URL, APIKey: "key"})
+	if err := sender.SendSMS("9000000001", "Hello"); err != nil {
+		t.Fatalf("SendSMS: %v", err)
+	}
+	if got["to"] != "9000000001" || got["message"] != "Hello" || auth != "Bearer key" {
+		t.Fatalf("gateway received %v with %q", got, auth)
+	}
+
+	status = http.StatusTooManyRequests
+	if err := sender.SendSMS("9000000001", "Hello"); err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("SendSMS error = %v, want the gateway's answer", err)
+	}
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	user := &models.User{ID: 7, Phone: "9000000001", Email: "a@example.com"}
+
+	for _, channel := range []string{models.ChannelSMS, models.ChannelEmail} {
+		notifier := &FileNotifier{Channel: channel, Path: path}
+		if err := notifier.Notify(user, "Subject", "Body"); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var sms, email fileEntry
+	json.Unmarshal([]byte(lines[0]), &sms)
+	json.Unmarshal([]byte(lines[1]), &email)
+	if sms.Phone != user.Phone || sms.Email != "" || email.Email != user.Email || email.Phone != "" || email.UserID != 7 {
+		t.Fatalf("entries = %+v and %+v, want each addressed on its channel", sms, email)
+	}
+}
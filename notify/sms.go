@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPSMSSender sends text messages through an HTTP gateway. Each message is
+// POSTed as {"to": phone, "message": text} with the API key as bearer token;
+// any 2xx response counts as accepted.
+type HTTPSMSSender struct {
+	URL    string
+	APIKey string
+	client *http.Client
+}
+
+// SendSMS hands the message to the gateway
+func (s *HTTPSMSSender) SendSMS(phone, message string) error {
+	body, err := json.Marshal(map[string]string{"to": phone, "message": message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("SMS gateway responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "orders/12/invoice.pdf"
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing file: %v, want ErrNotFound", err)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := store.Put(ctx, key, strings.NewReader(content), int64(len(content)), "application/pdf"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	f, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "second" {
+		t.Fatalf("content = %q, want the replaced file", data)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of a missing file: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStoreRejectsKeysOutsideItsDirectory(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "..", "../secret", "orders/../../secret", "/etc/passwd"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Package storage keeps uploaded files, such as order attachments, on local
+// disk or in an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"pharmacy/config"
+)
+
+// ErrNotFound is returned by Get when no file is stored under the key
+var ErrNotFound = errors.New("file not found")
+
+// Store keeps files under slash-separated keys such as "orders/12/ab12.pdf"
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any existing file
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the file stored under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key. Missing files are not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the store selected by the configuration
+func New(cfg config.StorageConfig) (Store, error) {
+	switch cfg.Driver {
+	case config.StorageLocal:
+		return NewLocalStore(cfg.Dir)
+	case config.StorageS3:
+		return NewS3Store(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+}